@@ -0,0 +1,170 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ohshell/cli/pkg/api"
+	"github.com/ohshell/cli/pkg/auth"
+	"github.com/ohshell/cli/pkg/library"
+	"github.com/ohshell/cli/pkg/output"
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/spf13/cobra"
+)
+
+var execMarkdownFile string
+var execJSONFile string
+var execUpload bool
+
+// execCmd is the Cobra command for 'ohsh exec <script> [args...]'
+var execCmd = &cobra.Command{
+	Use:   "exec <script> [args...]",
+	Short: "Run a script unattended and document each of its commands",
+	Long: `Run a bash or sh script and record each of its top-level commands with
+its output and exit status, without a terminal and without asking anything,
+for scripted jobs such as CI pipelines.
+
+The script's output goes to stdout as it runs and ohsh exits with the
+script's status. Comments in the script narrate the document as they do
+when typed at the prompt. Once the script has finished, the session is
+written with --markdown, --json-file and --html, uploaded with --upload, or
+else printed as Markdown (or JSON with --json). On machines where no one
+can run ohsh login, give the token in $OHSH_TOKEN.
+
+Everything after the script is passed to it:
+
+  ohsh exec --markdown rotate.md --upload ./rotate-keys.sh --region eu-west-1`,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var token string
+		if execUpload || slackAuditFlag {
+			var err error
+			if token, err = auth.GetToken(auth.RealKeyring{}); err != nil {
+				return fmt.Errorf("no token to upload with: run ohsh login or set $%s", auth.TokenEnv)
+			}
+		}
+		redactor, err := newRedactor()
+		if err != nil {
+			return err
+		}
+		env, err := environmentOptions()
+		if err != nil {
+			return err
+		}
+
+		opts := append([]record.SessionOption{
+			record.WithContextVars(contextVars...),
+			record.WithRedactor(redactor),
+		}, env...)
+		if keepColors || htmlFile != "" {
+			opts = append(opts, record.WithColors())
+		}
+		jnl, err := createJournal()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] ⚠️  Session journal unavailable, the session is only kept in memory: %v\n", err)
+		} else {
+			opts = append(opts, record.WithJournal(jnl))
+		}
+		policy, err := newCapturePolicy(jnl)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, record.WithCapturePolicy(policy))
+		subscribers, err := subscriberOptions(jnl, token)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, subscribers...)
+		session, err := record.ExecScript(args[0], args[1:], opts...)
+		if err != nil {
+			if jnl != nil {
+				_ = jnl.Close(&record.Session{ExitCode: 1})
+				_ = os.Remove(jnl.Path())
+			}
+			return err
+		}
+		exitCode = session.ExitCode
+		fmt.Fprintf(os.Stderr, "[ohsh] 📊 Script exited with status %d after %d commands in %s\n", session.ExitCode, len(session.Commands), output.FormatDuration(session.Duration()))
+
+		id := library.NewID(session.StartTime)
+		if jnl != nil {
+			id = jnl.ID()
+		}
+		savedID := saveSession(session, id)
+		if jnl != nil && (savedID != "" || noSave) {
+			_ = os.Remove(jnl.Path())
+		}
+		return writeExecSession(session, token)
+	},
+}
+
+func init() {
+	execCmd.Flags().StringVar(&execMarkdownFile, "markdown", "", "Write the session as Markdown to this file")
+	execCmd.Flags().StringVar(&execJSONFile, "json-file", "", "Write the session as JSON to this file")
+	execCmd.Flags().BoolVar(&execUpload, "upload", false, "Upload the document without asking (to Notion or Google Docs too with --notion or --google)")
+	// Flags after the script are the script's own.
+	execCmd.Flags().SetInterspersed(false)
+	RootCmd.AddCommand(execCmd)
+}
+
+// writeExecSession writes a session recorded by ohsh exec where it was
+// asked to go, without prompting.
+func writeExecSession(session *record.Session, token string) error {
+	markdown := output.ToMarkdown(session)
+	written := false
+	write := func(path, what string, data []byte) error {
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", what, err)
+		}
+		fmt.Fprintf(os.Stderr, "[ohsh] 💾 %s written to %s\n", what, path)
+		written = true
+		return nil
+	}
+	if execMarkdownFile != "" {
+		if err := write(execMarkdownFile, "Markdown", []byte(markdown)); err != nil {
+			return err
+		}
+	}
+	if execJSONFile != "" {
+		data, err := output.ToJSON(session)
+		if err != nil {
+			return fmt.Errorf("failed to generate JSON: %w", err)
+		}
+		if err := write(execJSONFile, "JSON", data); err != nil {
+			return err
+		}
+	}
+	if htmlFile != "" {
+		if err := write(htmlFile, "HTML", []byte(output.ToHTML(session))); err != nil {
+			return err
+		}
+	}
+
+	docURL := ""
+	if execUpload && !noUpload {
+		resp, err := api.SendMarkdownWithDest(markdown, token, notionFlag, googleFlag)
+		if err != nil {
+			return fmt.Errorf("failed to upload doc: %w", err)
+		}
+		docURL = fmt.Sprintf("%s/app/runbooks/%s", api.ResolveAPIURL(), resp.ID)
+		fmt.Fprintf(os.Stderr, "[ohsh] ✅ Document uploaded: %s\n", docURL)
+		written = true
+	}
+	if session.SlackThreadTS != "" {
+		api.SendSlackCompletionAudit(slackChannel, token, session.SlackThreadTS, docURL)
+	}
+
+	switch {
+	case written:
+	case jsonFlag:
+		data, err := output.ToJSONString(session)
+		if err != nil {
+			return fmt.Errorf("failed to generate JSON: %w", err)
+		}
+		fmt.Println(data)
+	default:
+		fmt.Print(markdown)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ohshell/cli/pkg/output"
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/spf13/cobra"
+)
+
+var exportOutput string
+
+// exportCmd groups the commands that convert a saved session to other
+// formats.
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a recorded session to another format",
+}
+
+// exportCastCmd is the Cobra command for 'ohsh export cast <session>'
+var exportCastCmd = &cobra.Command{
+	Use:   "cast <session>",
+	Short: "Export a session as an asciicast v2 recording for asciinema",
+	Long: `Export a saved session, given by its ID as listed by ohsh sessions, or a
+session file saved with --json as an asciicast v2 recording.
+
+The session only holds the rendered output of each command, so the
+recording shows each command and its output at the times they ran. Use
+--cast while recording to keep the exact terminal stream.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session, err := loadSession(args[0])
+		if err != nil {
+			return err
+		}
+		var w io.Writer = os.Stdout
+		if exportOutput != "" {
+			f, err := os.Create(exportOutput)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", exportOutput, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		if err := output.ToCast(w, session); err != nil {
+			return fmt.Errorf("failed to write asciicast: %w", err)
+		}
+		return nil
+	},
+}
+
+func init() {
+	exportCastCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "File to write to (default: stdout)")
+	exportCmd.AddCommand(exportCastCmd)
+	RootCmd.AddCommand(exportCmd)
+}
+
+// loadSession reads the saved session with the ID or ID prefix ref or,
+// failing that, the session file, saved with --json, at path ref.
+func loadSession(ref string) (*record.Session, error) {
+	session, data, err := loadSavedOrFile(ref)
+	if err != nil || session != nil {
+		return session, err
+	}
+	session, err = output.FromJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a session file: %w", ref, err)
+	}
+	return session, nil
+}
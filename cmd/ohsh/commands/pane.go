@@ -0,0 +1,495 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ohshell/cli/pkg/auth"
+	"github.com/ohshell/cli/pkg/journal"
+	"github.com/ohshell/cli/pkg/library"
+	"github.com/ohshell/cli/pkg/mux"
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/sys/unix"
+)
+
+// paneExt is the file extension of the files describing the panes being
+// recorded, kept next to the sessions.
+const paneExt = ".pane"
+
+// paneTimeout is how long pane start and stop wait for the recorder.
+const paneTimeout = 10 * time.Second
+
+var paneTarget string
+var paneRecordMux string
+var paneRecordShell string
+
+// paneRecording describes a pane being recorded by a background ohsh.
+type paneRecording struct {
+	Mux       string    `json:"mux"`
+	Pane      string    `json:"pane"`
+	PID       int       `json:"pid"`
+	Session   string    `json:"session"` // ID the session is saved under
+	StartTime time.Time `json:"start_time"`
+}
+
+// paneCmd groups the commands that record a tmux pane or screen window in
+// place.
+var paneCmd = &cobra.Command{
+	Use:   "pane",
+	Short: "Record a tmux pane or screen window in place",
+	Long: `Record the shell of a tmux pane or screen window in place, without
+starting a new shell, so every pane can have a session of its own.
+
+Run ohsh pane start in the pane to record, or name another pane with -t.
+ohsh loads its hooks into the pane's shell (bash, zsh or fish) and records
+in the background until ohsh pane stop, which then offers the session for
+upload as usual. Sessions are also saved if the pane is closed first.`,
+}
+
+// paneStartCmd is the Cobra command for 'ohsh pane start'
+var paneStartCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start recording a pane in the background",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, pane, err := targetPane()
+		if err != nil {
+			return err
+		}
+		if rec, ok := readPaneRecording(m, pane); ok {
+			return fmt.Errorf("pane %s is already being recorded as %s", pane, rec.Session)
+		}
+		shell, err := paneShell(m, pane)
+		if err != nil {
+			return err
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		logPath, err := paneFile(m, pane, ".log")
+		if err != nil {
+			return err
+		}
+		logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", logPath, err)
+		}
+		defer logFile.Close()
+		recorder := exec.Command(exe, append([]string{"pane", "record", "--mux", m.Name(), "--target", pane, "--shell", shell}, recordingFlags(cmd)...)...)
+		recorder.Stdout, recorder.Stderr = logFile, logFile
+		recorder.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		if err := recorder.Start(); err != nil {
+			return fmt.Errorf("failed to start the recorder: %w", err)
+		}
+		exited := make(chan struct{})
+		go func() {
+			_ = recorder.Wait()
+			close(exited)
+		}()
+
+		deadline := time.After(paneTimeout)
+		for {
+			if rec, ok := readPaneRecording(m, pane); ok && rec.PID == recorder.Process.Pid {
+				fmt.Printf("[ohsh] 🎥 Recording %s pane %s as %s. Stop with: ohsh pane stop\n", m.Name(), pane, rec.Session)
+				_ = os.Remove(logPath)
+				return nil
+			}
+			select {
+			case <-exited:
+				out, _ := os.ReadFile(logPath)
+				return fmt.Errorf("the recorder stopped: %s", strings.TrimSpace(string(out)))
+			case <-deadline:
+				_ = recorder.Process.Kill()
+				return fmt.Errorf("the recorder did not start in %s, see %s", paneTimeout, logPath)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	},
+}
+
+// paneStopCmd is the Cobra command for 'ohsh pane stop'
+var paneStopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop recording a pane and upload the session",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := auth.GetToken(auth.RealKeyring{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ohsh] You must login first: ohsh login")
+			os.Exit(1)
+		}
+		m, pane, err := targetPane()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] %v\n", err)
+			os.Exit(1)
+		}
+		rec, ok := readPaneRecording(m, pane)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "[ohsh] Pane %s is not being recorded\n", pane)
+			os.Exit(1)
+		}
+		// Stopped from inside the recorded pane, the running command is
+		// this one, which is not part of the session.
+		sig := syscall.SIGTERM
+		if _, current, _ := mux.Detect(); paneID(m, current) == pane {
+			sig = syscall.SIGUSR1
+		}
+		if err := syscall.Kill(rec.PID, sig); err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] Failed to stop the recorder: %v\n", err)
+			os.Exit(1)
+		}
+		for deadline := time.Now().Add(paneTimeout); processRunning(rec.PID); time.Sleep(50 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				fmt.Fprintf(os.Stderr, "[ohsh] The recorder (process %d) did not stop in %s\n", rec.PID, paneTimeout)
+				os.Exit(1)
+			}
+		}
+		session, _, err := loadSaved(rec.Session)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] The session was not saved: %v (try ohsh sessions recover)\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("[ohsh] 🛑 Stopped recording pane %s\n", pane)
+		savedID := rec.Session
+		if noSave {
+			if e, err := findSaved(rec.Session); err == nil {
+				_ = library.Remove(e)
+			}
+			savedID = ""
+		}
+		publishSession(session, token, savedID)
+	},
+}
+
+// paneListCmd is the Cobra command for 'ohsh pane list'
+var paneListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the panes being recorded",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := journal.Dir()
+		if err != nil {
+			return err
+		}
+		paths, _ := filepath.Glob(filepath.Join(dir, "*"+paneExt))
+		var recs []paneRecording
+		for _, path := range paths {
+			if rec, err := loadPaneRecording(path); err == nil && processRunning(rec.PID) {
+				recs = append(recs, rec)
+			}
+		}
+		if len(recs) == 0 {
+			fmt.Println("No panes are being recorded")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MUX\tPANE\tSESSION\tSTARTED")
+		for _, rec := range recs {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", rec.Mux, rec.Pane, rec.Session, rec.StartTime.Local().Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+	},
+}
+
+// paneRecordCmd is the Cobra command for 'ohsh pane record', the
+// background recorder started by 'ohsh pane start'.
+var paneRecordCmd = &cobra.Command{
+	Use:    "record",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		m, err := mux.ByName(paneRecordMux)
+		if err != nil {
+			return err
+		}
+		pane := paneTarget
+		redactor, err := newRedactor()
+		if err != nil {
+			return err
+		}
+		jnl, err := createJournal()
+		if err != nil {
+			return err
+		}
+		policy, err := newCapturePolicy(jnl)
+		if err != nil {
+			return err
+		}
+		opts := []record.SessionOption{
+			record.WithContextVars(contextVars...),
+			record.WithRedactor(redactor),
+			record.WithCapturePolicy(policy),
+			record.WithJournal(jnl),
+		}
+		if keepColors || htmlFile != "" {
+			opts = append(opts, record.WithColors())
+		}
+		if cols, rows, err := m.Size(pane); err == nil {
+			opts = append(opts, record.WithTerminalSize(cols, rows))
+		}
+		var token string
+		if slackAuditFlag {
+			if token, err = auth.GetToken(auth.RealKeyring{}); err != nil {
+				return errors.New("you must login first: ohsh login")
+			}
+		}
+		subscribers, err := subscriberOptions(jnl, token)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, subscribers...)
+
+		hook, cleanup, err := record.HookCommand(paneRecordShell, contextVars)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		dir, err := os.MkdirTemp("", "ohsh-pane-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		fifo := filepath.Join(dir, "output")
+		if err := unix.Mkfifo(fifo, 0o600); err != nil {
+			return fmt.Errorf("failed to create %s: %w", fifo, err)
+		}
+		if err := m.Pipe(pane, fifo); err != nil {
+			return err
+		}
+		defer func() { _ = m.Unpipe(pane) }()
+		out, err := openFIFO(fifo)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		rec := paneRecording{Mux: m.Name(), Pane: pane, PID: os.Getpid(), Session: jnl.ID(), StartTime: time.Now()}
+		statePath, err := paneFile(m, pane, paneExt)
+		if err == nil {
+			err = writePaneRecording(statePath, rec)
+		}
+		if err != nil {
+			return err
+		}
+		defer os.Remove(statePath)
+		if err := m.Type(pane, hook); err != nil {
+			return err
+		}
+
+		var dropRunning atomic.Bool
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP, syscall.SIGUSR1)
+		go func() {
+			sig := <-sigs
+			dropRunning.Store(sig == syscall.SIGUSR1)
+			// Closing the pipe ends the stream.
+			_ = m.Unpipe(pane)
+		}()
+		session := record.RecordStream(out, opts...)
+		// A shell recorded before still has the hooks loaded, and reports
+		// the line loading them again as a command of its own.
+		if len(session.Commands) > 0 && strings.TrimSpace(session.Commands[0].Input) == strings.TrimSpace(hook) {
+			session.Commands = session.Commands[1:]
+		}
+		if n := len(session.Commands); dropRunning.Load() && n > 0 && session.Commands[n-1].ExitCode == nil {
+			session.Commands = session.Commands[:n-1]
+		}
+
+		// The session is handed to pane stop through the library, so it is
+		// saved even with --no-save, which pane stop applies.
+		if keepSession(session, rec.Session) != "" {
+			_ = os.Remove(jnl.Path())
+		}
+		return nil
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{paneStartCmd, paneStopCmd, paneRecordCmd} {
+		c.Flags().StringVarP(&paneTarget, "target", "t", "", "Pane to record: a tmux target such as %3 or a screen window number (default: this one)")
+	}
+	paneRecordCmd.Flags().StringVar(&paneRecordMux, "mux", "", "Multiplexer holding the pane")
+	paneRecordCmd.Flags().StringVar(&paneRecordShell, "shell", "", "Shell running in the pane")
+	paneCmd.AddCommand(paneStartCmd, paneStopCmd, paneListCmd, paneRecordCmd)
+	RootCmd.AddCommand(paneCmd)
+}
+
+// targetPane returns the multiplexer ohsh runs in and the pane named by
+// --target, or the one ohsh runs in.
+func targetPane() (mux.Multiplexer, string, error) {
+	m, current, ok := mux.Detect()
+	if !ok {
+		return nil, "", errors.New("not running inside tmux or screen")
+	}
+	target := paneTarget
+	if target == "" {
+		target = current
+	}
+	pane, err := m.Pane(target)
+	if err != nil {
+		return nil, "", err
+	}
+	return m, pane, nil
+}
+
+// paneID resolves target, returning "" if it does not name a pane.
+func paneID(m mux.Multiplexer, target string) string {
+	pane, err := m.Pane(target)
+	if err != nil {
+		return ""
+	}
+	return pane
+}
+
+// paneShell returns the shell to load the hooks into. It has to be waiting
+// at its prompt: in the pane ohsh runs in, that is the shell that started
+// ohsh, about to get its prompt back.
+func paneShell(m mux.Multiplexer, pane string) (string, error) {
+	var shell string
+	if _, current, _ := mux.Detect(); paneID(m, current) == pane {
+		shell = record.ProcessName(os.Getppid())
+	} else {
+		name, err := m.Command(pane)
+		if errors.Is(err, mux.ErrUnknown) {
+			return "", fmt.Errorf("%s cannot tell what window %s runs: run ohsh pane start in it", m.Name(), pane)
+		}
+		if err != nil {
+			return "", err
+		}
+		shell = name
+	}
+	switch strings.TrimPrefix(shell, "-") {
+	case "bash", "zsh", "fish":
+		return strings.TrimPrefix(shell, "-"), nil
+	case "":
+		return "", fmt.Errorf("cannot tell which shell pane %s runs", pane)
+	}
+	return "", fmt.Errorf("pane %s is running %s, not bash, zsh or fish at its prompt", pane, shell)
+}
+
+// recordingFlags returns the flags set on the command line that change how
+// a session is recorded, to pass on to the background recorder.
+func recordingFlags(cmd *cobra.Command) []string {
+	var args []string
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		switch f.Name {
+		case "debug", "slack-audit", "slack-channel", "keep-colors", "html", "redact-pattern", "no-redact", "context-var",
+			"max-output", "capture-rule", "failed-output-only", "spill-dir", "audit-sink":
+		default:
+			return
+		}
+		if sv, ok := f.Value.(pflag.SliceValue); ok {
+			for _, v := range sv.GetSlice() {
+				args = append(args, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		args = append(args, "--"+f.Name+"="+f.Value.String())
+	})
+	return args
+}
+
+// paneFile returns the path of a file about pane next to the sessions.
+func paneFile(m mux.Multiplexer, pane, ext string) (string, error) {
+	dir, err := journal.Dir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	name := m.Name() + "-" + strings.NewReplacer("%", "", "/", "_", ":", "_").Replace(pane)
+	if s, ok := m.(*mux.Screen); ok {
+		name = m.Name() + "-" + strings.ReplaceAll(s.Session, "/", "_") + "-" + pane
+	}
+	return filepath.Join(dir, name+ext), nil
+}
+
+// readPaneRecording returns the recording of pane, if one is running.
+func readPaneRecording(m mux.Multiplexer, pane string) (paneRecording, bool) {
+	path, err := paneFile(m, pane, paneExt)
+	if err != nil {
+		return paneRecording{}, false
+	}
+	rec, err := loadPaneRecording(path)
+	if err != nil || !processRunning(rec.PID) {
+		return paneRecording{}, false
+	}
+	return rec, true
+}
+
+func loadPaneRecording(path string) (paneRecording, error) {
+	var rec paneRecording
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &rec)
+	}
+	return rec, err
+}
+
+func writePaneRecording(path string, rec paneRecording) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// processRunning reports whether process pid exists.
+func processRunning(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// openFIFO opens the FIFO at path for reading once the multiplexer has
+// opened it for writing.
+func openFIFO(path string) (*os.File, error) {
+	type result struct {
+		f   *os.File
+		err error
+	}
+	opened := make(chan result)
+	abandoned := make(chan struct{})
+	go func() {
+		f, err := os.Open(path)
+		select {
+		case opened <- result{f, err}:
+		case <-abandoned:
+			if f != nil {
+				_ = f.Close()
+			}
+		}
+	}()
+	select {
+	case r := <-opened:
+		return r.f, r.err
+	case <-time.After(paneTimeout):
+		close(abandoned)
+		// Unblock the open so the goroutine can finish.
+		if w, err := os.OpenFile(path, os.O_WRONLY, 0); err == nil {
+			_ = w.Close()
+		}
+		return nil, fmt.Errorf("the pane's output did not arrive in %s", paneTimeout)
+	}
+}
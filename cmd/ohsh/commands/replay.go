@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ohshell/cli/pkg/cast"
+	"github.com/ohshell/cli/pkg/output"
+	"github.com/ohshell/cli/pkg/replay"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var replaySpeed float64
+var replayIdleLimit time.Duration
+var replayStep int
+
+// replayCmd is the Cobra command for 'ohsh replay <session>'
+var replayCmd = &cobra.Command{
+	Use:   "replay <session>",
+	Short: "Play back a recorded session in the terminal",
+	Long: `Play back a saved session, given by its ID as listed by ohsh sessions, a
+session file saved with --json or a recording made with --cast.
+
+Keys while playing:
+  space         pause / resume
+  right, l      forward 5s
+  left, h       back 5s
+  n, ]          next step
+  p, [          previous step
+  +, -          faster / slower
+  q, Ctrl-C     quit`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		events, err := loadReplayEvents(args[0])
+		if err != nil {
+			return err
+		}
+		player := replay.New(events, os.Stdout, replay.Options{
+			Speed:     replaySpeed,
+			IdleLimit: replayIdleLimit,
+			Step:      replayStep,
+		})
+
+		controls := make(chan replay.Control, 16)
+		fd := int(os.Stdin.Fd())
+		if term.IsTerminal(fd) {
+			oldState, err := term.MakeRaw(fd)
+			if err != nil {
+				return fmt.Errorf("failed to set terminal to raw mode: %w", err)
+			}
+			defer term.Restore(fd, oldState)
+			go replay.Keys(os.Stdin, controls)
+		}
+
+		err = player.Play(context.Background(), controls)
+		fmt.Print("\x1b[0m\r\n")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[ohsh] Replay finished (%d steps)\r\n", player.Steps())
+		return nil
+	},
+}
+
+// loadReplayEvents reads the saved session with the ID or ID prefix ref or,
+// failing that, the asciicast recording or session file at path ref.
+// Sessions are converted to a recording.
+func loadReplayEvents(ref string) ([]cast.Event, error) {
+	session, data, err := loadSavedOrFile(ref)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		if _, events, err := cast.Read(bytes.NewReader(data)); err == nil {
+			return events, nil
+		}
+		if session, err = output.FromJSON(data); err != nil {
+			return nil, fmt.Errorf("%s is neither a session file nor an asciicast recording", ref)
+		}
+	}
+	var buf bytes.Buffer
+	if err := output.ToCast(&buf, session); err != nil {
+		return nil, err
+	}
+	_, events, err := cast.Read(&buf)
+	return events, err
+}
+
+func init() {
+	replayCmd.Flags().Float64Var(&replaySpeed, "speed", 1, "Playback speed multiplier")
+	replayCmd.Flags().DurationVar(&replayIdleLimit, "idle-limit", 2*time.Second, "Shorten pauses longer than this (0 keeps them)")
+	replayCmd.Flags().IntVar(&replayStep, "step", 0, "Start at step N")
+	RootCmd.AddCommand(replayCmd)
+}
@@ -3,6 +3,8 @@ package commands
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"bytes"
@@ -14,9 +16,15 @@ import (
 	"github.com/manifoldco/promptui"
 	"github.com/ohshell/cli/build"
 	"github.com/ohshell/cli/pkg/api"
+	"github.com/ohshell/cli/pkg/audit"
 	"github.com/ohshell/cli/pkg/auth"
+	"github.com/ohshell/cli/pkg/capture"
+	"github.com/ohshell/cli/pkg/delivery"
+	"github.com/ohshell/cli/pkg/journal"
+	"github.com/ohshell/cli/pkg/library"
 	"github.com/ohshell/cli/pkg/output"
 	"github.com/ohshell/cli/pkg/record"
+	"github.com/ohshell/cli/pkg/redact"
 	"github.com/ohshell/cli/pkg/spinner"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -116,10 +124,46 @@ var slackAuditFlag bool
 var slackChannel string
 var noUpload bool
 var jsonFlag bool
+var contextVars []string
+var redactPatterns []string
+var noRedact bool
+var keepColors bool
+var htmlFile string
+var screenSnapshots bool
+var castFile string
+var escapeKey string
+var noSave bool
+var shellFlag string
+var shellArgs string
+var envVars []string
+var workDir string
+var maxOutput string
+var captureRules []string
+var failedOutputOnly bool
+var spillDir string
+var auditSinks []string
+
+// exitCode is the status ohsh exits with once the command has run: the
+// recorded shell's, so scripts wrapping ohsh see how the session ended.
+var exitCode int
+
+// ExitCode returns the status ohsh should exit with.
+func ExitCode() int {
+	return exitCode
+}
 
 var RootCmd = &cobra.Command{
-	Use:   "ohsh",
+	Use:   "ohsh [flags] [-- program [args...]]",
 	Short: "ohshell records your shell session for documentation",
+	Long: `ohshell records your shell session for documentation.
+
+Your $SHELL is recorded unless another shell is given with --shell, or a
+program to record follows --, such as a database console:
+
+  ohsh --shell zsh --shell-args -l
+  ohsh -- psql -h db
+  ohsh --cwd deploy -- kubectl exec -it api-0 -- sh`,
+	Args: programArgs,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		logrus.SetFormatter(&CRLFFormatter{&logrus.TextFormatter{}})
 		if debug || os.Getenv("OHSHELL_DEBUG") == "1" || os.Getenv("OHSHELL_DEBUG") == "true" {
@@ -141,186 +185,261 @@ var RootCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		var wg sync.WaitGroup
+		redactor, err := newRedactor()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] %v\n", err)
+			os.Exit(1)
+		}
+
+		key := byte(0)
+		if escapeKey != "none" {
+			if key, err = record.ParseKey(escapeKey); err != nil {
+				fmt.Fprintf(os.Stderr, "[ohsh] --escape-key: %v\n", err)
+				os.Exit(1)
+			}
+		}
 
-		var session *record.Session
+		program, err := programOptions(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] %v\n", err)
+			os.Exit(1)
+		}
+
+		opts := []record.SessionOption{
+			record.WithContextVars(contextVars...),
+			record.WithRedactor(redactor),
+			record.WithEscapeKey(key),
+		}
+		opts = append(opts, program...)
+		if keepColors || htmlFile != "" {
+			opts = append(opts, record.WithColors())
+		}
+		if screenSnapshots {
+			opts = append(opts, record.WithScreenSnapshots())
+		}
+		if castFile != "" {
+			f, err := os.Create(castFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "[ohsh] Failed to create %s: %v\n", castFile, err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			opts = append(opts, record.WithCast(f))
+		}
+		// Keep a journal on disk so the session can be recovered if ohsh
+		// does not get to finish it.
+		jnl, err := createJournal()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] ⚠️  Session journal unavailable, the session is only kept in memory: %v\n\r", err)
+		} else {
+			opts = append(opts, record.WithJournal(jnl))
+		}
+		policy, err := newCapturePolicy(jnl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] %v\n", err)
+			os.Exit(1)
+		}
+		opts = append(opts, record.WithCapturePolicy(policy))
+		subscribers, err := subscriberOptions(jnl, token)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] %v\n", err)
+			os.Exit(1)
+		}
+		opts = append(opts, subscribers...)
 		if slackAuditFlag {
 			fmt.Fprintf(os.Stderr, "[ohsh] 🎉 Slack audit enabled\n\r")
-			session = record.StartSession(record.WithSlackAudit(slackChannel, token))
-		} else {
-			session = record.StartSession()
 		}
+		session := record.StartSession(opts...)
+		exitCode = session.ExitCode
 
 		// Show recording feedback
 		fmt.Fprintf(os.Stderr, "[ohsh] 📝 Recording session... (commands will be captured)\n\r")
 		fmt.Fprintf(os.Stderr, "[ohsh] 💡 Tip: Use Ctrl+C to stop recording and upload your document\n\r")
 
-		// Handle JSON output
-		if jsonFlag {
-			jsonOutput, err := output.ToJSONString(session)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "[ohsh] Failed to generate JSON: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Println(jsonOutput)
-
-			// If slack audit is enabled, send completion message
-			if session.SlackThreadTS != "" {
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					api.SendSlackCompletionAudit(slackChannel, token, session.SlackThreadTS, "")
-				}()
+		if castFile != "" {
+			fmt.Fprintf(os.Stderr, "[ohsh] 🎬 Terminal recording written to %s\n", castFile)
+		}
+		if htmlFile != "" {
+			if err := os.WriteFile(htmlFile, []byte(output.ToHTML(session)), 0o644); err != nil {
+				fmt.Fprintf(os.Stderr, "[ohsh] Failed to write HTML: %v\n", err)
+			} else {
+				fmt.Fprintf(os.Stderr, "[ohsh] 💾 HTML written to %s\n", htmlFile)
 			}
-			wg.Wait()
-			return
 		}
 
-		markdown := output.ToMarkdown(session)
+		id := library.NewID(session.StartTime)
+		if jnl != nil {
+			id = jnl.ID()
+		}
+		savedID := saveSession(session, id)
+		if jnl != nil && (savedID != "" || noSave) {
+			_ = os.Remove(jnl.Path())
+		}
+		publishSession(session, token, savedID)
+	},
+}
+
+// publishSession hands a finished session to the user: printed as JSON, or
+// turned into a document that is uploaded once they confirm.
+func publishSession(session *record.Session, token, savedID string) {
+	var wg sync.WaitGroup
 
-		// Show session summary
-		fmt.Printf("[ohsh] 📊 Session captured %d commands\n", len(session.Commands))
+	// Handle JSON output
+	if jsonFlag {
+		jsonOutput, err := output.ToJSONString(session)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] Failed to generate JSON: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(jsonOutput)
 
-		// Check if session is empty
-		if len(session.Commands) == 0 {
-			fmt.Printf("[ohsh] ⚠️  No commands were captured in this session\n")
-			fmt.Printf("[ohsh] 💡 Try running some commands and then exit with Ctrl+C\n")
-			return
+		// If slack audit is enabled, send completion message
+		if session.SlackThreadTS != "" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				api.SendSlackCompletionAudit(slackChannel, token, session.SlackThreadTS, "")
+			}()
 		}
+		wg.Wait()
+		return
+	}
 
-		fmt.Printf("[ohsh] 🔄 Processing session and preparing document...\n")
+	markdown := output.ToMarkdown(session)
 
-		// Restore terminal to cooked mode before running bubbletea
-		if term.IsTerminal(int(os.Stdin.Fd())) {
-			// Get current terminal state and restore to cooked mode
-			oldState, err := raw.TcGetAttr(os.Stdin.Fd())
-			if err == nil {
-				raw.TcSetAttr(os.Stdin.Fd(), oldState)
-			}
+	// Show session summary
+	fmt.Printf("[ohsh] 📊 Session captured %d commands in %s\n", len(session.Commands), output.FormatDuration(session.Duration()))
+
+	// Check if session is empty
+	if len(session.Commands) == 0 {
+		fmt.Printf("[ohsh] ⚠️  No commands were captured in this session\n")
+		fmt.Printf("[ohsh] 💡 Try running some commands and then exit with Ctrl+C\n")
+		return
+	}
 
-			// Additional terminal reset
-			fmt.Print("\033[?25h")   // Show cursor
-			fmt.Print("\033[?2004l") // Disable bracketed paste
+	fmt.Printf("[ohsh] 🔄 Processing session and preparing document...\n")
+
+	// Restore terminal to cooked mode before running bubbletea
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		// Get current terminal state and restore to cooked mode
+		oldState, err := raw.TcGetAttr(os.Stdin.Fd())
+		if err == nil {
+			raw.TcSetAttr(os.Stdin.Fd(), oldState)
 		}
 
-		// Prompt user if they want to upload using bubbletea
-		// Drain any pending input to avoid requiring an extra Enter
-		drainStdin()
-		uploadPrompt := NewUploadPrompt()
-		var program *tea.Program
-		if tty, err := os.Open("/dev/tty"); err == nil {
-			defer tty.Close()
-			program = tea.NewProgram(uploadPrompt, tea.WithInput(tty))
+		// Additional terminal reset
+		fmt.Print("\033[?25h")   // Show cursor
+		fmt.Print("\033[?2004l") // Disable bracketed paste
+	}
+
+	// Prompt user if they want to upload using bubbletea
+	// Drain any pending input to avoid requiring an extra Enter
+	drainStdin()
+	uploadPrompt := NewUploadPrompt()
+	var program *tea.Program
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		defer tty.Close()
+		program = tea.NewProgram(uploadPrompt, tea.WithInput(tty))
+	} else {
+		program = tea.NewProgram(uploadPrompt)
+	}
+	result, err := program.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ohsh] Prompt error: %v\n", err)
+		os.Exit(1)
+	}
+
+	uploadResult := result.(*UploadPrompt)
+	if uploadResult.cursor == 1 {
+		if savedID != "" {
+			fmt.Printf("[ohsh] 👋 Exiting without uploading. Upload it later with: ohsh sessions upload %s\n", savedID)
 		} else {
-			program = tea.NewProgram(uploadPrompt)
+			fmt.Printf("[ohsh] 👋 Exiting without uploading. Your session was recorded but not saved.\n")
 		}
-		result, err := program.Run()
+		return
+	}
+
+	uploadSession(session, markdown, token)
+}
+
+// uploadSession uploads the session's document to Oh Shell, or to the
+// Notion page the user picks with --notion.
+func uploadSession(session *record.Session, markdown, token string) {
+	var wg sync.WaitGroup
+
+	if noUpload {
+		fmt.Println("[ohsh] --no-upload flag set, skipping upload.")
+		fmt.Printf("[ohsh] Markdown:\n%s\n", markdown)
+		if session.SlackThreadTS != "" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				api.SendSlackCompletionAudit(slackChannel, token, session.SlackThreadTS, "")
+			}()
+		}
+		wg.Wait()
+		return
+	}
+
+	if notionFlag {
+		s := spinner.New()
+		s.Start("Fetching Notion pages...")
+		tree, err := api.FetchNotionPageTree(token)
+		s.Stop()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[ohsh] Prompt error: %v\n", err)
+			fmt.Fprintf(os.Stderr, "[ohsh] Failed to fetch Notion pages: %v\n", err)
 			os.Exit(1)
 		}
 
-		uploadResult := result.(*UploadPrompt)
-		if uploadResult.cursor == 1 {
-			fmt.Printf("[ohsh] 👋 Exiting without uploading. Your session was recorded but not saved.\n")
-			return
-		}
-
-		if noUpload {
-			fmt.Println("[ohsh] --no-upload flag set, skipping upload.")
-			fmt.Printf("[ohsh] Markdown:\n%s\n", markdown)
-			if session.SlackThreadTS != "" {
-				wg.Add(1)
-				go func() {
-					defer wg.Done()
-					api.SendSlackCompletionAudit(slackChannel, token, session.SlackThreadTS, "")
-				}()
-			}
-			wg.Wait()
-			return
+		// Flatten tree for promptui
+		var flat []struct {
+			ID    string
+			Title string
 		}
-
-		if notionFlag {
-			s := spinner.New()
-			s.Start("Fetching Notion pages...")
-			tree, err := api.FetchNotionPageTree(token)
-			s.Stop()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "[ohsh] Failed to fetch Notion pages: %v\n", err)
-				os.Exit(1)
-			}
-
-			// Flatten tree for promptui
-			var flat []struct {
-				ID    string
-				Title string
-			}
-			var walk func(nodes []api.NotionTreeNode, prefix string)
-			walk = func(nodes []api.NotionTreeNode, prefix string) {
-				for _, n := range nodes {
-					flat = append(flat, struct{ ID, Title string }{n.ID, prefix + n.Title})
-					if len(n.Children) > 0 {
-						walk(n.Children, prefix+"  ")
-					}
+		var walk func(nodes []api.NotionTreeNode, prefix string)
+		walk = func(nodes []api.NotionTreeNode, prefix string) {
+			for _, n := range nodes {
+				flat = append(flat, struct{ ID, Title string }{n.ID, prefix + n.Title})
+				if len(n.Children) > 0 {
+					walk(n.Children, prefix+"  ")
 				}
 			}
-			walk(tree, "")
-
-			prompt := promptui.Select{
-				Label: "Select Notion parent page",
-				Items: flat,
-				Size:  15,
-				Templates: &promptui.SelectTemplates{
-					Label:    "{{ . }}",
-					Active:   "▶ {{ .Title | cyan }}",
-					Inactive: "  {{ .Title }}",
-					Selected: "✔ {{ .Title | green }}",
-				},
-				Searcher: func(input string, index int) bool {
-					item := flat[index]
-					return containsIgnoreCase(item.Title, input)
-				},
-			}
-			idx, _, err := prompt.Run()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "[ohsh] Prompt cancelled: %v\n", err)
-				os.Exit(1)
-			}
-			parentID := flat[idx].ID
-
-			// Send doc to Notion with parentID
-			uploadSpinner := spinner.New()
-			uploadSpinner.Start("Processing session and uploading to Notion...")
-			resp, err := api.SendMarkdownToNotionWithParent(markdown, token, parentID)
-			uploadSpinner.Stop()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "[ohsh] Failed to upload doc to Notion: %v\n", err)
-				os.Exit(1)
-			}
-			fmt.Printf("[ohsh] ✅ Document uploaded to Notion successfully!\n")
-			fmt.Printf("[ohsh] 📄 Document ID: %s\n", resp.ID)
-			if session.SlackThreadTS != "" {
-				wg.Add(1)
-				docURL := fmt.Sprintf("%s/app/runbooks/%s", api.ResolveAPIURL(), resp.ID)
-				go func() {
-					defer wg.Done()
-					api.SendSlackCompletionAudit(slackChannel, token, session.SlackThreadTS, docURL)
-				}()
-			}
-			wg.Wait()
-			return
 		}
-		docSpinner := spinner.New()
-		docSpinner.Start("Processing session and generating document...")
-		resp, err := api.SendMarkdownWithDest(markdown, token, notionFlag, googleFlag)
-		docSpinner.Stop()
+		walk(tree, "")
+
+		prompt := promptui.Select{
+			Label: "Select Notion parent page",
+			Items: flat,
+			Size:  15,
+			Templates: &promptui.SelectTemplates{
+				Label:    "{{ . }}",
+				Active:   "▶ {{ .Title | cyan }}",
+				Inactive: "  {{ .Title }}",
+				Selected: "✔ {{ .Title | green }}",
+			},
+			Searcher: func(input string, index int) bool {
+				item := flat[index]
+				return containsIgnoreCase(item.Title, input)
+			},
+		}
+		idx, _, err := prompt.Run()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "[ohsh] Failed to upload doc: %v\n", err)
+			fmt.Fprintf(os.Stderr, "[ohsh] Prompt cancelled: %v\n", err)
 			os.Exit(1)
 		}
+		parentID := flat[idx].ID
 
-		fmt.Printf("[ohsh] ✅ Document uploaded successfully!\n")
-		fmt.Printf("[ohsh] 📄 Document URL: %s/app/runbooks/%s\n", api.ResolveAPIURL(), resp.ID)
+		// Send doc to Notion with parentID
+		uploadSpinner := spinner.New()
+		uploadSpinner.Start("Processing session and uploading to Notion...")
+		resp, err := api.SendMarkdownToNotionWithParent(markdown, token, parentID)
+		uploadSpinner.Stop()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] Failed to upload doc to Notion: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("[ohsh] ✅ Document uploaded to Notion successfully!\n")
+		fmt.Printf("[ohsh] 📄 Document ID: %s\n", resp.ID)
 		if session.SlackThreadTS != "" {
 			wg.Add(1)
 			docURL := fmt.Sprintf("%s/app/runbooks/%s", api.ResolveAPIURL(), resp.ID)
@@ -330,7 +449,28 @@ var RootCmd = &cobra.Command{
 			}()
 		}
 		wg.Wait()
-	},
+		return
+	}
+	docSpinner := spinner.New()
+	docSpinner.Start("Processing session and generating document...")
+	resp, err := api.SendMarkdownWithDest(markdown, token, notionFlag, googleFlag)
+	docSpinner.Stop()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ohsh] Failed to upload doc: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("[ohsh] ✅ Document uploaded successfully!\n")
+	fmt.Printf("[ohsh] 📄 Document URL: %s/app/runbooks/%s\n", api.ResolveAPIURL(), resp.ID)
+	if session.SlackThreadTS != "" {
+		wg.Add(1)
+		docURL := fmt.Sprintf("%s/app/runbooks/%s", api.ResolveAPIURL(), resp.ID)
+		go func() {
+			defer wg.Done()
+			api.SendSlackCompletionAudit(slackChannel, token, session.SlackThreadTS, docURL)
+		}()
+	}
+	wg.Wait()
 }
 
 func init() {
@@ -342,6 +482,184 @@ func init() {
 	RootCmd.PersistentFlags().StringVar(&slackChannel, "slack-channel", "", "Slack channel to send audit logs to (e.g. #incident-audit)")
 	RootCmd.PersistentFlags().BoolVar(&noUpload, "no-upload", false, "Do not upload the generated doc, just print the markdown")
 	RootCmd.PersistentFlags().BoolVar(&jsonFlag, "json", false, "Output the session as JSON instead of uploading")
+	RootCmd.PersistentFlags().BoolVar(&keepColors, "keep-colors", false, "Keep the colours of command output (included in the JSON as styled_output)")
+	RootCmd.PersistentFlags().StringVar(&htmlFile, "html", "", "Also write the session as an HTML page with coloured output to this file")
+	RootCmd.PersistentFlags().BoolVar(&screenSnapshots, "screen-snapshots", false, "Record the last screen of full-screen programs such as vim or less")
+	RootCmd.PersistentFlags().StringVar(&castFile, "cast", "", "Also write the terminal stream with timing to this file in asciicast v2 format")
+	RootCmd.PersistentFlags().BoolVar(&noSave, "no-save", false, "Do not keep the session on this machine once it has been handled")
+	RootCmd.PersistentFlags().StringVar(&escapeKey, "escape-key", "^]", "Key that starts a recording control (pause, drop last step, add a note) when followed by another key, or none")
+	RootCmd.PersistentFlags().StringArrayVar(&redactPatterns, "redact-pattern", nil, "Regular expression for additional secrets to redact; only the first capture group is redacted if there is one (repeatable)")
+	RootCmd.PersistentFlags().BoolVar(&noRedact, "no-redact", false, "Disable the built-in secret detectors (--redact-pattern rules still apply)")
+	RootCmd.PersistentFlags().StringSliceVar(&contextVars, "context-var", record.DefaultContextVars, "Context recorded with each command: an environment variable name, kube-context or gcloud-project (repeatable)")
+	RootCmd.PersistentFlags().StringVar(&shellFlag, "shell", "", "Shell to record instead of $SHELL, by name or path")
+	RootCmd.PersistentFlags().StringVar(&shellArgs, "shell-args", "", "Arguments to start the shell with, separated by spaces (e.g. -l)")
+	RootCmd.PersistentFlags().StringArrayVar(&envVars, "env", nil, "Variable to set in the recorded shell's environment, as KEY=VALUE (repeatable)")
+	RootCmd.PersistentFlags().StringVar(&workDir, "cwd", "", "Directory to start the recorded shell in")
+	RootCmd.PersistentFlags().StringVar(&maxOutput, "max-output", "256K", "Output kept per command, from its start and end (e.g. 64K, 1M, or 0 for all of it)")
+	RootCmd.PersistentFlags().StringArrayVar(&captureRules, "capture-rule", nil, "Output to keep for commands matching a pattern, as keep:PATTERN, omit:PATTERN or limit:PATTERN, e.g. 'omit:cat *.log' (repeatable, first match wins)")
+	RootCmd.PersistentFlags().BoolVar(&failedOutputOnly, "failed-output-only", false, "Only keep the output of commands that failed or whose exit status is not known")
+	RootCmd.PersistentFlags().StringVar(&spillDir, "spill-dir", "", "Directory to write the whole output of commands that were cut short to (default: beside the saved session)")
+	RootCmd.PersistentFlags().StringArrayVar(&auditSinks, "audit-sink", nil, "Also send audit records of each command, as it starts and once it finishes, to file:PATH (JSON lines), syslog[:TAG] or webhook:URL[;template=PATH][;header=NAME: VALUE] (repeatable)")
+}
+
+// programArgs only accepts arguments given after --, as the program to
+// record, so a mistyped command is reported rather than recorded.
+func programArgs(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 || cmd.ArgsLenAtDash() == 0 {
+		return nil
+	}
+	if cmd.SuggestionsMinimumDistance <= 0 {
+		cmd.SuggestionsMinimumDistance = 2 // cobra's default
+	}
+	if suggestions := cmd.SuggestionsFor(args[0]); len(suggestions) > 0 {
+		return fmt.Errorf("unknown command %q for %q\n\nDid you mean this?\n\t%s\n",
+			args[0], cmd.CommandPath(), strings.Join(suggestions, "\n\t"))
+	}
+	return fmt.Errorf("unknown command %q for %q\n\nTo record a program, give it after --: %s -- %s",
+		args[0], cmd.CommandPath(), cmd.CommandPath(), strings.Join(args, " "))
+}
+
+// programOptions builds the options for what is recorded from --shell,
+// --shell-args, --env, --cwd and a program given after --.
+func programOptions(args []string) ([]record.SessionOption, error) {
+	var opts []record.SessionOption
+	switch {
+	case len(args) > 0 && (shellFlag != "" || shellArgs != ""):
+		return nil, fmt.Errorf("--shell and --shell-args cannot be used with a program to record")
+	case len(args) > 0:
+		opts = append(opts, record.WithCommand(args[0], args[1:]...))
+	case shellFlag != "" || shellArgs != "":
+		shell := shellFlag
+		if shell == "" {
+			shell = os.Getenv("SHELL")
+		}
+		if shell == "" {
+			shell = "/bin/bash"
+		}
+		path, err := exec.LookPath(shell)
+		if err != nil {
+			return nil, fmt.Errorf("--shell: %w", err)
+		}
+		opts = append(opts, record.WithCommand(path, strings.Fields(shellArgs)...))
+	}
+	env, err := environmentOptions()
+	if err != nil {
+		return nil, err
+	}
+	return append(opts, env...), nil
+}
+
+// environmentOptions builds the options for where the recorded program
+// runs from --env and --cwd.
+func environmentOptions() ([]record.SessionOption, error) {
+	var opts []record.SessionOption
+	for _, kv := range envVars {
+		if !strings.Contains(kv, "=") {
+			return nil, fmt.Errorf("--env %s: expected KEY=VALUE", kv)
+		}
+	}
+	if len(envVars) > 0 {
+		opts = append(opts, record.WithEnv(envVars...))
+	}
+	if workDir != "" {
+		if info, err := os.Stat(workDir); err != nil {
+			return nil, fmt.Errorf("--cwd: %w", err)
+		} else if !info.IsDir() {
+			return nil, fmt.Errorf("--cwd: %s is not a directory", workDir)
+		}
+		opts = append(opts, record.WithDir(workDir))
+	}
+	return opts, nil
+}
+
+// newRedactor builds the session's redactor from the built-in detectors and
+// any --redact-pattern rules.
+func newRedactor() (*redact.Redactor, error) {
+	var rules []redact.Rule
+	if !noRedact {
+		rules = redact.DefaultRules()
+	}
+	for i, pattern := range redactPatterns {
+		rule, err := redact.CustomRule(fmt.Sprintf("custom-%d", i+1), pattern)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return redact.New(rules...), nil
+}
+
+// newCapturePolicy builds the session's capture policy from --max-output,
+// --capture-rule and --failed-output-only. Output that is cut short is
+// spilled to --spill-dir or, unless --no-save is set, beside the session
+// once it is saved under the journal's ID.
+func newCapturePolicy(jnl *journal.Journal) (*capture.Policy, error) {
+	maxBytes, err := capture.ParseSize(maxOutput)
+	if err != nil {
+		return nil, fmt.Errorf("--max-output: %w", err)
+	}
+	policy := &capture.Policy{MaxBytes: maxBytes, FailedOnly: failedOutputOnly}
+	for _, r := range captureRules {
+		rule, err := capture.ParseRule(r)
+		if err != nil {
+			return nil, fmt.Errorf("--capture-rule: %w", err)
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+	switch {
+	case spillDir != "" && jnl != nil:
+		policy.SpillDir = filepath.Join(spillDir, jnl.ID())
+	case spillDir != "":
+		policy.SpillDir = spillDir
+	case jnl != nil && !noSave:
+		if dir, err := journal.Dir(); err == nil {
+			policy.SpillDir = library.OutputsDir(dir, jnl.ID())
+		}
+	}
+	return policy, nil
+}
+
+// subscriberOptions returns the options sending the session's commands to
+// the audit sinks given with --audit-sink and, with --slack-audit, to Slack
+// using token.
+func subscriberOptions(jnl *journal.Journal, token string) ([]record.SessionOption, error) {
+	var opts []record.SessionOption
+	auditSub, err := newAuditSubscriber(jnl)
+	if err != nil {
+		return nil, err
+	}
+	if auditSub != nil {
+		opts = append(opts, record.WithSubscriber(auditSub))
+	}
+	if slackAuditFlag {
+		opts = append(opts, record.WithSlackAudit(slackChannel, token))
+	}
+	return opts, nil
+}
+
+// newAuditSubscriber opens the sinks given with --audit-sink, if any, and
+// returns a subscriber sending the session's audit records to them, under
+// the journal's ID if there is one.
+func newAuditSubscriber(jnl *journal.Journal) (record.Subscriber, error) {
+	if len(auditSinks) == 0 {
+		return nil, nil
+	}
+	var sinks []audit.Sink
+	for _, spec := range auditSinks {
+		sink, err := audit.ParseSink(spec)
+		if err != nil {
+			for _, s := range sinks {
+				_ = s.Close()
+			}
+			return nil, fmt.Errorf("--audit-sink: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	var id string
+	if jnl != nil {
+		id = jnl.ID()
+	}
+	return audit.Subscriber(sinks, id, delivery.DefaultOptions, delivery.DefaultFlushTimeout), nil
 }
 
 // Helper for case-insensitive substring search
@@ -0,0 +1,366 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/manifoldco/promptui"
+	"github.com/ohshell/cli/pkg/auth"
+	"github.com/ohshell/cli/pkg/journal"
+	"github.com/ohshell/cli/pkg/library"
+	"github.com/ohshell/cli/pkg/output"
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/spf13/cobra"
+)
+
+var sessionsExportFormat string
+var sessionsExportOutput string
+var sessionsDeleteYes bool
+
+// sessionsCmd groups the commands that work with the sessions kept on this
+// machine.
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "Manage sessions kept on this machine",
+	Long: `Manage the sessions kept on this machine.
+
+Every session is saved under $XDG_STATE_HOME/ohsh/sessions (by default
+~/.local/state/ohsh/sessions) once it ends, whether or not it is uploaded,
+unless ohsh was run with --no-save. Sessions are named by when they
+started, e.g. 20240102-150405-1234; any unique prefix of a name will do.`,
+}
+
+// sessionsListCmd is the Cobra command for 'ohsh sessions list'
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved sessions, newest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := journal.Dir()
+		if err != nil {
+			return err
+		}
+		entries, err := library.List(dir)
+		if err != nil {
+			return fmt.Errorf("failed to list sessions: %w", err)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No saved sessions")
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tDATE\tCOMMANDS\tDURATION\tTITLE")
+			for _, e := range entries {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", e.ID, e.StartTime.Local().Format("2006-01-02 15:04"), e.Commands, output.FormatDuration(e.Duration), e.Title)
+			}
+			w.Flush()
+		}
+		if n := len(recoverable()); n > 0 {
+			fmt.Printf("\n%d interrupted session(s) can be brought back with: ohsh sessions recover\n", n)
+		}
+		return nil
+	},
+}
+
+// sessionsShowCmd is the Cobra command for 'ohsh sessions show <session>'
+var sessionsShowCmd = &cobra.Command{
+	Use:   "show <session>",
+	Short: "Print a saved session as Markdown",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session, _, err := loadSaved(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Print(output.ToMarkdown(session))
+		return nil
+	},
+}
+
+// sessionsExportCmd is the Cobra command for 'ohsh sessions export <session>'
+var sessionsExportCmd = &cobra.Command{
+	Use:   "export <session>",
+	Short: "Export a saved session as Markdown, JSON, HTML or asciicast",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		session, _, err := loadSaved(args[0])
+		if err != nil {
+			return err
+		}
+		var w io.Writer = os.Stdout
+		if sessionsExportOutput != "" {
+			f, err := os.Create(sessionsExportOutput)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", sessionsExportOutput, err)
+			}
+			defer f.Close()
+			w = f
+		}
+		switch sessionsExportFormat {
+		case "md", "markdown":
+			_, err = io.WriteString(w, output.ToMarkdown(session))
+		case "json":
+			var data string
+			if data, err = output.ToJSONString(session); err == nil {
+				_, err = io.WriteString(w, data+"\n")
+			}
+		case "html":
+			_, err = io.WriteString(w, output.ToHTML(session))
+		case "cast":
+			err = output.ToCast(w, session)
+		default:
+			return fmt.Errorf("unknown format %q: use md, json, html or cast", sessionsExportFormat)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to export session: %w", err)
+		}
+		return nil
+	},
+}
+
+// sessionsDeleteCmd is the Cobra command for 'ohsh sessions delete <session>...'
+var sessionsDeleteCmd = &cobra.Command{
+	Use:   "delete <session>...",
+	Short: "Delete saved sessions",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var entries []library.Entry
+		for _, ref := range args {
+			e, err := findSaved(ref)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, e)
+		}
+		if !sessionsDeleteYes {
+			prompt := promptui.Prompt{
+				Label:     fmt.Sprintf("Delete %d session(s)", len(entries)),
+				IsConfirm: true,
+			}
+			if _, err := prompt.Run(); err != nil {
+				fmt.Println("Nothing deleted")
+				return nil
+			}
+		}
+		for _, e := range entries {
+			if err := library.Remove(e); err != nil {
+				return fmt.Errorf("failed to delete %s: %w", e.ID, err)
+			}
+			fmt.Printf("[ohsh] 🗑️  Deleted %s\n", e.ID)
+		}
+		return nil
+	},
+}
+
+// sessionsUploadCmd is the Cobra command for 'ohsh sessions upload <session>'
+var sessionsUploadCmd = &cobra.Command{
+	Use:   "upload <session>",
+	Short: "Upload a saved session to Oh Shell (or Notion with --notion)",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := auth.GetToken(auth.RealKeyring{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ohsh] You must login first: ohsh login")
+			os.Exit(1)
+		}
+		session, _, err := loadSaved(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] %v\n", err)
+			os.Exit(1)
+		}
+		if len(session.Commands) == 0 {
+			fmt.Fprintln(os.Stderr, "[ohsh] ⚠️  The session has no commands to upload")
+			os.Exit(1)
+		}
+		uploadSession(session, output.ToMarkdown(session), token)
+	},
+}
+
+// sessionsRecoverCmd is the Cobra command for 'ohsh sessions recover [session]'
+var sessionsRecoverCmd = &cobra.Command{
+	Use:   "recover [session]",
+	Short: "Recover a session that ohsh did not get to finish",
+	Long: `Recover a session from its journal after ohsh was killed, the machine
+went to sleep or the connection dropped, save it and continue with the
+usual upload.
+
+Sessions are journaled next to the saved ones as they are recorded, and
+the journal is removed once the session is saved. Without an argument,
+the journals left behind are offered to pick from. Sessions still being
+recorded are skipped.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		token, err := auth.GetToken(auth.RealKeyring{})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[ohsh] You must login first: ohsh login")
+			os.Exit(1)
+		}
+		info, err := pickRecoverable(args)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] %v\n", err)
+			os.Exit(1)
+		}
+		session, info, err := journal.Load(info.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "[ohsh] Failed to read %s: %v\n", info.Path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("[ohsh] ♻️  Recovered session from %s\n", info.StartTime.Local().Format("2006-01-02 15:04"))
+		savedID := saveSession(session, info.ID)
+		if savedID != "" || noSave {
+			_ = os.Remove(info.Path)
+		}
+		publishSession(session, token, savedID)
+	},
+}
+
+func init() {
+	sessionsExportCmd.Flags().StringVarP(&sessionsExportFormat, "format", "f", "md", "Format to export: md, json, html or cast")
+	sessionsExportCmd.Flags().StringVarP(&sessionsExportOutput, "output", "o", "", "File to write to (default: stdout)")
+	sessionsDeleteCmd.Flags().BoolVarP(&sessionsDeleteYes, "yes", "y", false, "Delete without asking")
+	sessionsCmd.AddCommand(sessionsListCmd, sessionsShowCmd, sessionsExportCmd, sessionsDeleteCmd, sessionsUploadCmd, sessionsRecoverCmd)
+	RootCmd.AddCommand(sessionsCmd)
+}
+
+// createJournal starts the journal for a new session.
+func createJournal() (*journal.Journal, error) {
+	dir, err := journal.Dir()
+	if err != nil {
+		return nil, err
+	}
+	return journal.Create(dir)
+}
+
+// saveSession keeps a finished session on this machine under id, unless
+// --no-save is set. It returns the ID it was saved under, or "" if it was
+// not.
+func saveSession(session *record.Session, id string) string {
+	if noSave {
+		return ""
+	}
+	return keepSession(session, id)
+}
+
+// keepSession saves a finished session on this machine under id, whatever
+// --no-save says. It returns id, or "" if the session could not be saved.
+func keepSession(session *record.Session, id string) string {
+	dir, err := journal.Dir()
+	if err == nil {
+		_, err = library.Save(dir, id, session)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[ohsh] ⚠️  Failed to save the session locally: %v\n", err)
+		return ""
+	}
+	fmt.Printf("[ohsh] 💾 Session saved as %s (see ohsh sessions list)\n", id)
+	return id
+}
+
+// findSaved finds a saved session by ID or ID prefix.
+func findSaved(ref string) (library.Entry, error) {
+	dir, err := journal.Dir()
+	if err != nil {
+		return library.Entry{}, err
+	}
+	return library.Find(dir, ref)
+}
+
+// loadSaved reads a saved session by ID or ID prefix.
+func loadSaved(ref string) (*record.Session, library.Entry, error) {
+	e, err := findSaved(ref)
+	if err != nil {
+		return nil, e, err
+	}
+	session, err := library.Load(e.Path)
+	return session, e, err
+}
+
+// loadSavedOrFile reads the saved session with the ID or ID prefix ref or,
+// failing that, the file at path ref, whose contents it returns for the
+// caller to parse. If ref is neither, the error is loadSaved's.
+func loadSavedOrFile(ref string) (*record.Session, []byte, error) {
+	session, _, err := loadSaved(ref)
+	if err == nil {
+		return session, nil, nil
+	}
+	if _, statErr := os.Stat(ref); statErr != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, data, nil
+}
+
+// recoverable returns the journals of sessions that ended without being
+// saved and are no longer being recorded.
+func recoverable() []journal.Info {
+	dir, err := journal.Dir()
+	if err != nil {
+		return nil
+	}
+	infos, _ := journal.List(dir)
+	var left []journal.Info
+	for _, info := range infos {
+		if !info.Running() {
+			left = append(left, info)
+		}
+	}
+	return left
+}
+
+// pickRecoverable finds the journal to recover: the one named in args, the
+// only one left behind, or one the user picks.
+func pickRecoverable(args []string) (journal.Info, error) {
+	dir, err := journal.Dir()
+	if err != nil {
+		return journal.Info{}, err
+	}
+	infos, err := journal.List(dir)
+	if err != nil {
+		return journal.Info{}, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	var candidates []journal.Info
+	for _, info := range infos {
+		if len(args) > 0 && args[0] != info.ID && filepath.Base(args[0]) != info.ID+journal.Ext {
+			continue
+		}
+		if info.Running() {
+			if len(args) > 0 {
+				return info, fmt.Errorf("session %s is still being recorded by process %d", info.ID, info.PID)
+			}
+			continue
+		}
+		candidates = append(candidates, info)
+	}
+	switch {
+	case len(candidates) == 0 && len(args) > 0:
+		return journal.Info{}, fmt.Errorf("no session %s in %s", args[0], dir)
+	case len(candidates) == 0:
+		return journal.Info{}, fmt.Errorf("no sessions to recover")
+	case len(candidates) == 1:
+		return candidates[0], nil
+	}
+
+	items := make([]string, len(candidates))
+	for i, info := range candidates {
+		state := "interrupted"
+		if info.Finished {
+			state = "not saved"
+		}
+		items[i] = fmt.Sprintf("%s  %3d commands  %s", info.StartTime.Local().Format("2006-01-02 15:04"), info.Commands, state)
+	}
+	prompt := promptui.Select{
+		Label: "Select a session to recover",
+		Items: items,
+		Size:  15,
+	}
+	idx, _, err := prompt.Run()
+	if err != nil {
+		return journal.Info{}, fmt.Errorf("prompt cancelled: %w", err)
+	}
+	return candidates[idx], nil
+}
@@ -5,6 +5,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/ohshell/cli/build"
+	"github.com/ohshell/cli/pkg/delivery"
 	"github.com/sirupsen/logrus"
 )
 
@@ -41,6 +43,17 @@ func (e *RunbookNotFoundError) Error() string {
 	return "runbook not found: " + e.ID
 }
 
+// StatusError is returned when the backend answers with an unexpected
+// status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return "backend error: " + e.Status
+}
+
 func ResolveAPIURL() string {
 	if env := os.Getenv("OHSH_API_URL"); env != "" {
 		return env
@@ -257,29 +270,65 @@ func SendSlackCompletionAudit(channel, token, threadTS, docURL string) {
 	}
 }
 
+// SlackAuditCommand is a single command reported to the Slack audit log.
+type SlackAuditCommand struct {
+	Command       string
+	ExecutionTime time.Time
+	ExitCode      *int   // nil if the exit status is not known
+	Event         string // what happened to the command, such as command_finished, if known
+}
+
 // SendSlackAudit sends a command audit log to the backend Slack audit endpoint
-func SendSlackAudit(command, channel, token, threadTS string) {
+func SendSlackAudit(command, channel, token, threadTS string) error {
+	return SendSlackAuditCommand(SlackAuditCommand{Command: command, ExecutionTime: time.Now()}, channel, token, threadTS)
+}
+
+// SendSlackAuditCommand sends a command audit log, including the command's
+// exit status when known, to the backend Slack audit endpoint
+func SendSlackAuditCommand(cmd SlackAuditCommand, channel, token, threadTS string) error {
+	return SendSlackAuditCommandContext(context.Background(), cmd, channel, token, threadTS)
+}
+
+// SendSlackAuditCommandContext is SendSlackAuditCommand with a context that
+// can cancel the request. An answer other than 200 is a *StatusError. It and
+// missing credentials are marked delivery.Permanent unless sending the
+// command again may succeed.
+func SendSlackAuditCommandContext(ctx context.Context, cmd SlackAuditCommand, channel, token, threadTS string) error {
 	if token == "" || channel == "" {
-		return
+		return delivery.Permanent(fmt.Errorf("token and channel must be provided"))
 	}
 	body := map[string]interface{}{
 		"type":           "audit_command",
-		"command":        command,
-		"execution_time": time.Now().Format(time.RFC3339),
+		"command":        cmd.Command,
+		"execution_time": cmd.ExecutionTime.Format(time.RFC3339),
 		"channel":        channel,
 		"thread_ts":      threadTS,
 	}
+	if cmd.ExitCode != nil {
+		body["exit_code"] = *cmd.ExitCode
+	}
+	if cmd.Event != "" {
+		body["event"] = cmd.Event
+	}
 	b, _ := json.Marshal(body)
 	url := ResolveAPIURL() + "/api/slack/audit-log"
-	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
 	if err != nil {
-		return
+		return err
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return
+		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		if !delivery.Retryable(resp.StatusCode) {
+			return delivery.Permanent(err)
+		}
+		return err
+	}
+	return nil
 }
@@ -1,10 +1,12 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/ohshell/cli/build"
 	"github.com/stretchr/testify/suite"
@@ -119,6 +121,32 @@ func (suite *ClientTestSuite) TestSendMarkdown_Non200Response() {
 	suite.Contains(err.Error(), "backend error", "Error should mention backend error")
 }
 
+// TestSendSlackAuditCommand_IncludesExitCode tests that the exit status is sent when known
+func (suite *ClientTestSuite) TestSendSlackAuditCommand_IncludesExitCode() {
+	var got map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		suite.NoError(json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	oldEnv := os.Getenv("OHSH_API_URL")
+	os.Setenv("OHSH_API_URL", ts.URL)
+	defer os.Setenv("OHSH_API_URL", oldEnv)
+
+	code := 3
+	SendSlackAuditCommand(SlackAuditCommand{Command: "make deploy", ExecutionTime: time.Now(), ExitCode: &code, Event: "command_finished"}, "#ops", "token", "123.456")
+	suite.Equal("audit_command", got["type"])
+	suite.Equal("make deploy", got["command"])
+	suite.Equal(float64(3), got["exit_code"])
+	suite.Equal("command_finished", got["event"])
+
+	SendSlackAudit("ls", "#ops", "token", "123.456")
+	suite.NotContains(got, "exit_code", "exit_code should be omitted when unknown")
+	suite.NotContains(got, "event")
+}
+
 // Example of a simple unit test without the suite
 func TestClientBasicFunctionality(t *testing.T) {
 	// TODO: Replace with actual test implementation
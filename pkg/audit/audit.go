@@ -0,0 +1,141 @@
+// Package audit sends an audit trail of recorded sessions to sinks such as
+// a webhook, syslog or a local file: a record when a command starts, and
+// another with its status when it finishes, changes or is dropped.
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohshell/cli/pkg/delivery"
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/sirupsen/logrus"
+)
+
+// Record is the audit record of a command event. It carries what the Slack
+// audit log is sent, with the command's output and exit status. The output
+// is as recorded: redacted, and cut down by the capture policy.
+type Record struct {
+	Type          string `json:"type"`
+	Event         string `json:"event"`                // the record.EventKind, such as command_finished
+	CommandID     int    `json:"command_id,omitempty"` // ties the records of one command together
+	Command       string `json:"command"`
+	ExecutionTime string `json:"execution_time"` // RFC 3339
+	ExitCode      *int   `json:"exit_code,omitempty"`
+	Output        string `json:"output"`
+	Session       string `json:"session,omitempty"` // ID the session is saved under, if known
+}
+
+// NewRecord returns the audit record of a command event in the session
+// with the given ID.
+func NewRecord(e record.Event, session string) Record {
+	cmd := e.Command
+	return Record{
+		Type:          "audit_command",
+		Event:         e.Kind.String(),
+		CommandID:     e.ID,
+		Command:       cmd.Input,
+		ExecutionTime: cmd.Timestamp.Format(time.RFC3339),
+		ExitCode:      cmd.ExitCode,
+		Output:        cmd.Output,
+		Session:       session,
+	}
+}
+
+// Sink is somewhere audit records are sent. Send should give up when ctx
+// is cancelled, and mark errors that retrying will not fix as
+// delivery.Permanent.
+type Sink interface {
+	Send(ctx context.Context, r Record) error
+	Close() error
+	String() string
+}
+
+// ParseSink parses a sink given as KIND:TARGET:
+//
+//	file:PATH        appends a JSON line per record to PATH
+//	syslog[:TAG]     logs each record as JSON to the local syslog, which
+//	                 journald also reads, tagged ohsh unless TAG is given
+//	webhook:URL      posts each record as JSON to URL
+//
+// Webhooks take options after the URL, separated by semicolons:
+// template=PATH posts the output of the text/template in PATH instead of
+// the record, and header=NAME: VALUE adds a header to the request, with
+// $VARIABLES in the value taken from the environment.
+func ParseSink(spec string) (Sink, error) {
+	kind, target, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	switch kind {
+	case "file":
+		if target == "" {
+			return nil, errors.New("file sink needs a path, e.g. file:/var/log/ohsh/audit.jsonl")
+		}
+		return newFileSink(target)
+	case "syslog":
+		return newSyslogSink(target)
+	case "webhook":
+		return parseWebhookSink(target)
+	}
+	return nil, fmt.Errorf("unknown audit sink %q: use file:PATH, syslog[:TAG] or webhook:URL", spec)
+}
+
+// Subscriber sends the audit records of the commands of a session to the
+// sinks, for the events record.Event.Audited picks. Each sink has a queue of its own, so records reach
+// it in order without a slow sink holding up the session or the other
+// sinks. Once the session has ended, records still queued are given
+// flushTimeout to be sent, the sinks are closed, and records that could not
+// be delivered are reported.
+func Subscriber(sinks []Sink, session string, opts delivery.Options, flushTimeout time.Duration) record.Subscriber {
+	s := &subscriber{session: session, flushTimeout: flushTimeout}
+	for _, sink := range sinks {
+		s.sinks = append(s.sinks, sink)
+		s.queues = append(s.queues, delivery.New(sink.String(), sink.Send, opts))
+	}
+	return s
+}
+
+type subscriber struct {
+	sinks        []Sink
+	queues       []*delivery.Queue[Record]
+	session      string
+	flushTimeout time.Duration
+}
+
+func (s *subscriber) HandleEvent(e record.Event) {
+	switch {
+	case e.Audited():
+		rec := NewRecord(e, s.session)
+		for _, q := range s.queues {
+			q.Push(rec)
+		}
+	case e.Kind == record.SessionEnded:
+		var wg sync.WaitGroup
+		for i, q := range s.queues {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.flush(s.sinks[i], q)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+// flush sends the records left in a sink's queue and closes the sink.
+func (s *subscriber) flush(sink Sink, q *delivery.Queue[Record]) {
+	undelivered := q.Close(s.flushTimeout)
+	if err := sink.Close(); err != nil {
+		logrus.WithError(err).Debugf("Failed to close audit sink %s", sink)
+	}
+	if len(undelivered) == 0 {
+		return
+	}
+	cmds := make([]string, len(undelivered))
+	for i, rec := range undelivered {
+		cmds[i] = rec.Command
+	}
+	logrus.Warnf("Audit records not sent to %s, for commands: %s", sink, strings.Join(cmds, "; "))
+}
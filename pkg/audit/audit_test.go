@@ -0,0 +1,200 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ohshell/cli/pkg/delivery"
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exit(code int) *int { return &code }
+
+var started = time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+
+var ctx = context.Background()
+
+func TestParseSink(t *testing.T) {
+	dir := t.TempDir()
+	tmpl := filepath.Join(dir, "body.tmpl")
+	require.NoError(t, os.WriteFile(tmpl, []byte(`{"text": {{json .Command}}}`), 0o600))
+	t.Setenv("AUDIT_TOKEN", "s3cret")
+
+	sink, err := ParseSink("file:" + filepath.Join(dir, "audit.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, "file:"+filepath.Join(dir, "audit.jsonl"), sink.String())
+	require.NoError(t, sink.Close())
+
+	sink, err = ParseSink("webhook:https://hooks.example.com/T000/secret;template=" + tmpl + ";header=Authorization: Bearer $AUDIT_TOKEN")
+	require.NoError(t, err)
+	assert.Equal(t, "webhook:https://hooks.example.com", sink.String(), "the path is left out")
+	wh := sink.(*webhookSink)
+	assert.Equal(t, "Bearer s3cret", wh.header.Get("Authorization"))
+	assert.NotNil(t, wh.template)
+
+	for _, bad := range []string{
+		"", "file", "file:", "s3:bucket", "webhook:", "webhook:ftp://example.com",
+		"webhook:https://example.com;retries=3", "webhook:https://example.com;header=nocolon",
+		"webhook:https://example.com;template=" + filepath.Join(dir, "missing"),
+		"file:" + filepath.Join(dir, "missing", "audit.jsonl"),
+	} {
+		_, err := ParseSink(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{\"type\":\"earlier\"}\n"), 0o600))
+	sink, err := ParseSink("file:" + path)
+	require.NoError(t, err)
+	ls := record.Command{Input: "ls", Output: "file", Timestamp: started, ExitCode: exit(0)}
+	require.NoError(t, sink.Send(ctx, NewRecord(record.Event{Kind: record.CommandFinished, ID: 1, Command: ls}, "20240501-093000")))
+	require.NoError(t, sink.Send(ctx, NewRecord(record.Event{Kind: record.CommandStarted, Command: record.Command{Input: "sleep 1", Timestamp: started}}, "")))
+	require.NoError(t, sink.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"earlier"}
+{"type":"audit_command","event":"command_finished","command_id":1,"command":"ls","execution_time":"2024-05-01T09:30:00Z","exit_code":0,"output":"file","session":"20240501-093000"}
+{"type":"audit_command","event":"command_started","command":"sleep 1","execution_time":"2024-05-01T09:30:00Z","output":""}
+`, string(data), "appended, one record per line")
+}
+
+func TestWebhookSink(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	var headers []http.Header
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(body))
+		headers = append(headers, r.Header)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	rec := NewRecord(record.Event{Kind: record.CommandFinished, ID: 3, Command: record.Command{Input: `echo "hi"`, Output: "hi", Timestamp: started, ExitCode: exit(1)}}, "s1")
+
+	sink, err := ParseSink("webhook:" + server.URL + ";header=X-Team: sre")
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(ctx, rec))
+	var got Record
+	require.NoError(t, json.Unmarshal([]byte(bodies[0]), &got))
+	assert.Equal(t, rec, got)
+	assert.Equal(t, "application/json", headers[0].Get("Content-Type"))
+	assert.Equal(t, "sre", headers[0].Get("X-Team"))
+
+	tmpl := filepath.Join(t.TempDir(), "body.tmpl")
+	require.NoError(t, os.WriteFile(tmpl, []byte(`{"text": {{printf "%s: %s" .Session .Command | json}}, "failed": {{if .ExitCode}}{{ne (deref .ExitCode) 0}}{{else}}null{{end}}}`), 0o600))
+	_, err = ParseSink("webhook:" + server.URL + ";template=" + tmpl)
+	assert.ErrorContains(t, err, "invalid webhook template", "only json is added to the template functions")
+
+	require.NoError(t, os.WriteFile(tmpl, []byte(`{"text": {{printf "%s: %s" .Session .Command | json}}, "exit_code": {{json .ExitCode}}}`), 0o600))
+	sink, err = ParseSink("webhook:" + server.URL + ";template=" + tmpl)
+	require.NoError(t, err)
+	require.NoError(t, sink.Send(ctx, rec))
+	assert.Equal(t, `{"text": "s1: echo \"hi\"", "exit_code": 1}`, bodies[1])
+
+	require.NoError(t, os.WriteFile(tmpl, []byte(`{"text": {{.Command}}}`), 0o600))
+	sink, err = ParseSink("webhook:" + server.URL + ";template=" + tmpl)
+	require.NoError(t, err)
+	assert.ErrorContains(t, sink.Send(ctx, rec), "valid JSON")
+
+	status = http.StatusForbidden
+	sink, err = ParseSink("webhook:" + server.URL)
+	require.NoError(t, err)
+	assert.ErrorContains(t, sink.Send(ctx, rec), "403")
+}
+
+// memorySink keeps the records sent to it.
+type memorySink struct {
+	mu      sync.Mutex
+	records []Record
+	closed  bool
+}
+
+func (s *memorySink) Send(_ context.Context, r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *memorySink) Close() error   { s.closed = true; return nil }
+func (s *memorySink) String() string { return "memory" }
+
+func TestSubscriber(t *testing.T) {
+	a, b := &memorySink{}, &memorySink{}
+	sub := Subscriber([]Sink{a, b}, "s1", delivery.DefaultOptions, time.Second)
+	events := []record.Event{
+		{Kind: record.CommandStarted, ID: 1, Command: record.Command{Input: "ls", Timestamp: started}},
+		{Kind: record.CommandFinished, ID: 1, Command: record.Command{Input: "ls", Output: "file", Timestamp: started, ExitCode: exit(0)}},
+		{Kind: record.CommandStarted, ID: 2, Command: record.Command{Input: "bash", Timestamp: started}},
+		{Kind: record.CommandFinished, ID: 2, Command: record.Command{Input: "bash", Timestamp: started}},
+		{Kind: record.CommandUpdated, ID: 2, Command: record.Command{Input: "bash", Timestamp: started, ExitCode: exit(130)}},
+		{Kind: record.CommandStarted, ID: 3, Command: record.Command{Input: "cat secrets", Timestamp: started}},
+		{Kind: record.CommandDropped, ID: 3, Command: record.Command{Input: "cat secrets", Timestamp: started}},
+	}
+	sub.HandleEvent(record.Event{Kind: record.SessionStarted, Session: &record.Session{}})
+	var want []Record
+	for _, e := range events {
+		sub.HandleEvent(e)
+		if e.Kind == record.CommandStarted {
+			sub.HandleEvent(record.Event{Kind: record.OutputChunk, ID: e.ID, Output: []byte("file\r\n")})
+		}
+		want = append(want, NewRecord(e, "s1"))
+	}
+	sub.HandleEvent(record.Event{Kind: record.SessionEnded, Session: &record.Session{}})
+
+	for _, sink := range []*memorySink{a, b} {
+		assert.Equal(t, want, sink.records, "commands are audited as they start, and again with their status")
+		assert.True(t, sink.closed)
+	}
+}
+
+func TestSubscriber_DeliversInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	tries := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rec Record
+		_ = json.NewDecoder(r.Body).Decode(&rec)
+		mu.Lock()
+		defer mu.Unlock()
+		tries[rec.Command]++
+		switch {
+		case rec.Command == "rm -rf /tmp/cache":
+			w.WriteHeader(http.StatusBadRequest)
+		case rec.Command == "make deploy" && tries[rec.Command] < 3:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			got = append(got, rec.Command)
+		}
+	}))
+	defer server.Close()
+	sink, err := ParseSink("webhook:" + server.URL)
+	require.NoError(t, err)
+	opts := delivery.Options{Buffer: 10, Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	sub := Subscriber([]Sink{sink}, "s1", opts, time.Second)
+
+	for _, input := range []string{"git pull", "make deploy", "rm -rf /tmp/cache", "curl -f https://api/health"} {
+		sub.HandleEvent(record.Event{Kind: record.CommandFinished, Command: record.Command{Input: input, Timestamp: started}})
+	}
+	sub.HandleEvent(record.Event{Kind: record.SessionEnded, Session: &record.Session{}})
+
+	assert.Equal(t, []string{"git pull", "make deploy", "curl -f https://api/health"}, got, "all sent before the session ends, in order")
+	assert.Equal(t, 3, tries["make deploy"])
+	assert.Equal(t, 1, tries["rm -rf /tmp/cache"], "rejected records are not retried")
+}
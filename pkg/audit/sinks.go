@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/syslog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ohshell/cli/pkg/delivery"
+)
+
+// fileSink appends a line of JSON per record to a file.
+type fileSink struct {
+	mu   sync.Mutex
+	f    *os.File
+	path string
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file: %w", err)
+	}
+	return &fileSink{f: f, path: path}, nil
+}
+
+func (s *fileSink) Send(_ context.Context, r Record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// One write per line, so lines appended by other sessions at the same
+	// time are not interleaved.
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error   { return s.f.Close() }
+func (s *fileSink) String() string { return "file:" + s.path }
+
+// syslogSink logs each record as JSON to the local syslog.
+type syslogSink struct {
+	w   *syslog.Writer
+	tag string
+}
+
+func newSyslogSink(tag string) (*syslogSink, error) {
+	if tag == "" {
+		tag = "ohsh"
+	}
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &syslogSink{w: w, tag: tag}, nil
+}
+
+func (s *syslogSink) Send(_ context.Context, r Record) error {
+	msg, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.w.Info(string(msg))
+}
+
+func (s *syslogSink) Close() error   { return s.w.Close() }
+func (s *syslogSink) String() string { return "syslog:" + s.tag }
+
+// webhookTimeout is how long a webhook is given to take a record.
+const webhookTimeout = 10 * time.Second
+
+// webhookSink posts each record to a URL.
+type webhookSink struct {
+	url      string
+	header   http.Header
+	template *template.Template // renders the body, if set; the record as JSON otherwise
+	client   *http.Client
+}
+
+func parseWebhookSink(spec string) (*webhookSink, error) {
+	parts := strings.Split(spec, ";")
+	u, err := url.Parse(parts[0])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("webhook sink needs an http or https URL, got %q", parts[0])
+	}
+	s := &webhookSink{url: parts[0], header: http.Header{}, client: &http.Client{Timeout: webhookTimeout}}
+	for _, opt := range parts[1:] {
+		key, value, _ := strings.Cut(opt, "=")
+		switch strings.TrimSpace(key) {
+		case "template":
+			if s.template, err = parseTemplate(value); err != nil {
+				return nil, err
+			}
+		case "header":
+			name, v, ok := strings.Cut(value, ":")
+			if !ok || strings.TrimSpace(name) == "" {
+				return nil, fmt.Errorf("webhook header must be NAME: VALUE, got %q", value)
+			}
+			s.header.Add(strings.TrimSpace(name), os.ExpandEnv(strings.TrimSpace(v)))
+		default:
+			return nil, fmt.Errorf("unknown webhook option %q: use template=PATH or header=NAME: VALUE", opt)
+		}
+	}
+	return s, nil
+}
+
+// parseTemplate reads the template for a webhook's body from path. The
+// json function quotes a value for use in the body, e.g.
+//
+//	{"text": {{printf "%s ran %s" .Session .Command | json}}}
+func parseTemplate(path string) (*template.Template, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook template: %w", err)
+	}
+	tmpl, err := template.New(path).Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// body returns the body posted for r.
+func (s *webhookSink) body(r Record) ([]byte, error) {
+	if s.template == nil {
+		return json.Marshal(r)
+	}
+	var b bytes.Buffer
+	if err := s.template.Execute(&b, r); err != nil {
+		return nil, err
+	}
+	if !json.Valid(b.Bytes()) {
+		return nil, errors.New("webhook template did not produce valid JSON")
+	}
+	return b.Bytes(), nil
+}
+
+func (s *webhookSink) Send(ctx context.Context, r Record) error {
+	body, err := s.body(r)
+	if err != nil {
+		return delivery.Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = s.header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("webhook returned %s", resp.Status)
+		if !delivery.Retryable(resp.StatusCode) {
+			return delivery.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error { return nil }
+
+// String names the webhook by its host, leaving out the path and query,
+// which often hold a secret.
+func (s *webhookSink) String() string {
+	u, _ := url.Parse(s.url)
+	return "webhook:" + u.Scheme + "://" + u.Host
+}
@@ -11,6 +11,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -24,6 +25,11 @@ const (
 	KeyringTokenKey = "clerk-access-token"
 )
 
+// TokenEnv is the environment variable a token can be given in on machines
+// where no one can log in, such as CI runners. It takes precedence over the
+// keyring.
+const TokenEnv = "OHSH_TOKEN"
+
 type OAuthConfig struct {
 	ClientID    string
 	AuthURL     string
@@ -154,7 +160,11 @@ func StoreToken(store TokenStore, token string) error {
 	return store.Set(KeyringService, KeyringTokenKey, token)
 }
 
-// GetToken retrieves the access token using the provided TokenStore
+// GetToken retrieves the access token from $OHSH_TOKEN or, if it is not
+// set, using the provided TokenStore
 func GetToken(store TokenStore) (string, error) {
+	if token := os.Getenv(TokenEnv); token != "" {
+		return token, nil
+	}
 	return store.Get(KeyringService, KeyringTokenKey)
 }
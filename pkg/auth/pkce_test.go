@@ -124,6 +124,19 @@ func (suite *AuthTestSuite) TestStoreAndGetToken() {
 	_ = mock.Delete(KeyringService, KeyringTokenKey)
 }
 
+// TestGetTokenFromEnv tests that $OHSH_TOKEN is used before the keyring
+func (suite *AuthTestSuite) TestGetTokenFromEnv() {
+	mock := &mockKeyring{store: make(map[string]string)}
+	suite.T().Setenv(TokenEnv, "ci-token")
+	retrieved, err := GetToken(mock)
+	suite.NoError(err, "GetToken should not need the keyring")
+	suite.Equal("ci-token", retrieved)
+
+	suite.NoError(StoreToken(mock, "keyring-token"))
+	retrieved, _ = GetToken(mock)
+	suite.Equal("ci-token", retrieved, "OHSH_TOKEN should take precedence")
+}
+
 // Example of a simple unit test without the suite
 func TestPKCEBasicFunctionality(t *testing.T) {
 	// TODO: Replace with actual test implementation
@@ -0,0 +1,250 @@
+// Package capture decides how much of each command's output a session
+// keeps, so that one cat of a big log does not swamp the document, the
+// upload or the audit log. Output left out can be spilled to files on
+// this machine.
+package capture
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultMaxBytes is how much output a command keeps unless told otherwise.
+const DefaultMaxBytes = 256 << 10
+
+// Mode says what a rule does with the output of the commands it matches.
+type Mode int
+
+const (
+	// Limit applies the policy's size limit and FailedOnly.
+	Limit Mode = iota
+	// Keep keeps the whole output.
+	Keep
+	// Omit keeps none of the output.
+	Omit
+)
+
+var modeNames = map[string]Mode{"limit": Limit, "keep": Keep, "omit": Omit}
+
+// Rule applies a mode to the commands matching a pattern.
+type Rule struct {
+	Pattern string // glob matched against the command line or its first words
+	Mode    Mode
+	re      *regexp.Regexp
+}
+
+// NewRule compiles a rule. In the pattern, * matches any text and ? any
+// one character, and a pattern matches a command line if it matches the
+// whole line or the words it starts with: "kubectl get" matches
+// "kubectl get pods -A" and "cat *.log" matches "cat /var/log/app.log".
+func NewRule(pattern string, mode Mode) (Rule, error) {
+	pattern = strings.Join(strings.Fields(pattern), " ")
+	if pattern == "" {
+		return Rule{}, fmt.Errorf("empty capture rule pattern")
+	}
+	var sb strings.Builder
+	sb.WriteString(`(?s)^`)
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			sb.WriteString(`.*`)
+		case '?':
+			sb.WriteString(`.`)
+		case ' ':
+			sb.WriteString(`\s+`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString(`(\s.*)?$`)
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid capture rule pattern %q: %w", pattern, err)
+	}
+	return Rule{Pattern: pattern, Mode: mode, re: re}, nil
+}
+
+// ParseRule parses a rule written as mode:pattern, such as
+// "omit:cat *.log" or "keep:kubectl get".
+func ParseRule(s string) (Rule, error) {
+	name, pattern, ok := strings.Cut(s, ":")
+	mode, known := modeNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok || !known {
+		return Rule{}, fmt.Errorf("invalid capture rule %q: use keep:PATTERN, omit:PATTERN or limit:PATTERN", s)
+	}
+	return NewRule(pattern, mode)
+}
+
+// Matches reports whether the rule applies to a command line.
+func (r Rule) Matches(input string) bool {
+	return r.re != nil && r.re.MatchString(strings.TrimSpace(input))
+}
+
+// ParseSize parses a size in bytes with an optional K, M or G suffix (of
+// 1024), such as 64K. "0" means no limit.
+func ParseSize(s string) (int, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "I")
+	unit := 1
+	switch {
+	case strings.HasSuffix(t, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(t, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(t, "G"):
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		t = t[:len(t)-1]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(t))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: use bytes or a number with K, M or G, such as 64K", s)
+	}
+	return n * unit, nil
+}
+
+// FormatSize renders a number of bytes for people, such as 1.5 MB.
+func FormatSize(n int) string {
+	switch {
+	case n < 1<<10:
+		return fmt.Sprintf("%d bytes", n)
+	case n < 1<<20:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	case n < 1<<30:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	}
+}
+
+// Policy decides how much of each command's output is kept. The first
+// rule matching a command line decides; commands matching none are
+// limited. A nil Policy keeps everything.
+type Policy struct {
+	// MaxBytes is how much output a limited command keeps, half from the
+	// start and half from the end; 0 keeps it all.
+	MaxBytes int
+	// FailedOnly omits the output of limited commands that exited 0.
+	// Commands whose exit status is not known keep theirs.
+	FailedOnly bool
+	Rules      []Rule
+	// SpillDir, if set, is where the whole output of commands that did not
+	// keep all of it is written.
+	SpillDir string
+}
+
+// Apply cuts the output of a command down to what the policy keeps. The
+// styled output, with colours, is cut at the same lines, or dropped when
+// it cannot be. It returns how many bytes of output were left out.
+func (p *Policy) Apply(input string, exitCode *int, output, styled string) (string, string, int) {
+	if p == nil || output == "" {
+		return output, styled, 0
+	}
+	mode := p.mode(input)
+	switch {
+	case mode == Keep:
+		return output, styled, 0
+	case mode == Omit, p.FailedOnly && exitCode != nil && *exitCode == 0:
+		return "", "", len(output)
+	case p.MaxBytes <= 0 || len(output) <= p.MaxBytes:
+		return output, styled, 0
+	}
+
+	lines := strings.Split(output, "\n")
+	head, tail := 0, 0
+	for budget := p.MaxBytes / 2; head < len(lines) && len(lines[head])+1 <= budget; head++ {
+		budget -= len(lines[head]) + 1
+	}
+	for budget := p.MaxBytes / 2; tail < len(lines)-head && len(lines[len(lines)-1-tail])+1 <= budget; tail++ {
+		budget -= len(lines[len(lines)-1-tail]) + 1
+	}
+	if head == 0 && tail == 0 {
+		// Lines too long to keep whole, as in minified JSON.
+		h := runeStart(output, p.MaxBytes/2)
+		t := runeStart(output, len(output)-p.MaxBytes/2)
+		omitted := t - h
+		return output[:h] + "\n" + marker(omitted) + "\n" + output[t:], "", omitted
+	}
+	kept := strings.Join(lines[:head], "\n") + "\n" + strings.Join(lines[len(lines)-tail:], "\n")
+	omitted := len(output) - len(kept)
+	output = cutLines(lines, head, tail, omitted)
+	if styledLines := strings.Split(styled, "\n"); styled != "" && len(styledLines) == len(lines) {
+		styled = cutLines(styledLines, head, tail, omitted)
+	} else {
+		styled = ""
+	}
+	return output, styled, omitted
+}
+
+// Spill writes the whole output of a command to a new file in the spill
+// directory and returns its path, or "" if there is no directory. The file
+// is named after pattern as by os.CreateTemp, so sessions sharing the
+// directory do not overwrite each other's files. Spilled output holds what
+// the command printed, so only the user can read it.
+func (p *Policy) Spill(pattern, output string) (string, error) {
+	if p == nil || p.SpillDir == "" {
+		return "", nil
+	}
+	f, err := p.create(pattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(output)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return "", fmt.Errorf("failed to spill output: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// mode returns the mode of the first rule matching a command line.
+func (p *Policy) mode(input string) Mode {
+	for _, r := range p.Rules {
+		if r.Matches(input) {
+			return r.Mode
+		}
+	}
+	return Limit
+}
+
+// create creates a new spill file named after pattern.
+func (p *Policy) create(pattern string) (*os.File, error) {
+	if err := os.MkdirAll(p.SpillDir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create output spill dir: %w", err)
+	}
+	f, err := os.CreateTemp(p.SpillDir, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to spill output: %w", err)
+	}
+	return f, nil
+}
+
+// cutLines keeps head lines from the start and tail from the end, with a
+// line saying how much was left out between them.
+func cutLines(lines []string, head, tail, omitted int) string {
+	kept := make([]string, 0, head+tail+1)
+	kept = append(kept, lines[:head]...)
+	kept = append(kept, marker(omitted))
+	kept = append(kept, lines[len(lines)-tail:]...)
+	return strings.Join(kept, "\n")
+}
+
+func marker(omitted int) string {
+	return fmt.Sprintf("[… %s of output omitted …]", FormatSize(omitted))
+}
+
+// runeStart moves i back to the start of the UTF-8 sequence it falls in.
+func runeStart(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,156 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exit(code int) *int { return &code }
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		rule    string
+		input   string
+		matches bool
+	}{
+		{"keep:kubectl get", "kubectl get pods -A", true},
+		{"keep:kubectl get", "kubectl  get", true},
+		{"keep:kubectl get", "kubectl getx", false},
+		{"keep:kubectl get", "kubectl describe pod", false},
+		{"omit:cat *.log", "cat /var/log/app.log", true},
+		{"omit:cat *.log", "cat app.log | grep error", true},
+		{"omit:cat *.log", "cat app.txt", false},
+		{"omit:cat *.log", "tac app.log", false},
+		{"limit:journalctl -u ?ginx", "journalctl -u nginx -f", true},
+	}
+	for _, tt := range tests {
+		rule, err := ParseRule(tt.rule)
+		require.NoError(t, err, tt.rule)
+		assert.Equal(t, tt.matches, rule.Matches(tt.input), "%s on %s", tt.rule, tt.input)
+	}
+
+	rule, err := ParseRule(" Keep : kubectl get ")
+	require.NoError(t, err)
+	assert.Equal(t, Rule{Pattern: "kubectl get", Mode: Keep, re: rule.re}, rule)
+	for _, bad := range []string{"kubectl get", "drop:ls", "keep:", "keep:  "} {
+		_, err := ParseRule(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	for s, want := range map[string]int{"0": 0, "512": 512, "64K": 64 << 10, "64kb": 64 << 10, "2M": 2 << 20, "1MiB": 1 << 20, "1G": 1 << 30} {
+		got, err := ParseSize(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, got, s)
+	}
+	for _, bad := range []string{"", "K", "-1", "lots", "1T"} {
+		_, err := ParseSize(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "12 bytes", FormatSize(12))
+	assert.Equal(t, "1.5 KB", FormatSize(1536))
+	assert.Equal(t, "3.0 MB", FormatSize(3<<20))
+}
+
+func TestApply_HeadAndTail(t *testing.T) {
+	var lines, styled []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("line %03d", i))
+		styled = append(styled, fmt.Sprintf("\x1b[32mline %03d\x1b[0m", i))
+	}
+	output := strings.Join(lines, "\n")
+	p := &Policy{MaxBytes: 90}
+
+	got, gotStyled, omitted := p.Apply("seq 100", exit(0), output, strings.Join(styled, "\n"))
+	assert.Equal(t, "line 001\nline 002\nline 003\nline 004\nline 005\n"+
+		"[… 810 bytes of output omitted …]\n"+
+		"line 096\nline 097\nline 098\nline 099\nline 100", got)
+	assert.Equal(t, len(output)-10*len("line 001\n")+1, omitted)
+	assert.True(t, strings.HasPrefix(gotStyled, "\x1b[32mline 001\x1b[0m\n"), gotStyled)
+	assert.True(t, strings.HasSuffix(gotStyled, "[… 810 bytes of output omitted …]\n\x1b[32mline 096\x1b[0m\n\x1b[32mline 097\x1b[0m\n\x1b[32mline 098\x1b[0m\n\x1b[32mline 099\x1b[0m\n\x1b[32mline 100\x1b[0m"), gotStyled)
+
+	got, gotStyled, omitted = p.Apply("seq 5", exit(0), "1\n2\n3\n4\n5", "styled")
+	assert.Equal(t, "1\n2\n3\n4\n5", got, "output within the limit is kept")
+	assert.Equal(t, "styled", gotStyled)
+	assert.Zero(t, omitted)
+
+	got, _, _ = (&Policy{}).Apply("seq 100", nil, output, "")
+	assert.Equal(t, output, got, "no limit")
+	var nilPolicy *Policy
+	got, _, _ = nilPolicy.Apply("seq 100", nil, output, "")
+	assert.Equal(t, output, got)
+}
+
+func TestApply_LongLines(t *testing.T) {
+	output := strings.Repeat("é", 100) // 200 bytes on one line
+	got, styled, omitted := (&Policy{MaxBytes: 21}).Apply("cat min.json", nil, output, "\x1b[1m"+output)
+	assert.Equal(t, strings.Repeat("é", 5)+"\n[… 180 bytes of output omitted …]\n"+strings.Repeat("é", 5), got, "cut at a character boundary")
+	assert.Equal(t, 180, omitted)
+	assert.Empty(t, styled, "styled output that cannot be cut at the same place is dropped")
+}
+
+func TestApply_Rules(t *testing.T) {
+	keep, err := ParseRule("keep:kubectl get")
+	require.NoError(t, err)
+	omit, err := ParseRule("omit:cat *.log")
+	require.NoError(t, err)
+	p := &Policy{MaxBytes: 4, FailedOnly: true, Rules: []Rule{keep, omit}}
+
+	got, styled, omitted := p.Apply("kubectl get pods", exit(0), "NAME\napi-0", "NAME\napi-0")
+	assert.Equal(t, "NAME\napi-0", got, "kept whole even though it succeeded and is over the limit")
+	assert.Equal(t, "NAME\napi-0", styled)
+	assert.Zero(t, omitted)
+
+	got, styled, omitted = p.Apply("cat app.log", exit(1), "boom", "boom")
+	assert.Empty(t, got, "omitted even though it failed")
+	assert.Empty(t, styled)
+	assert.Equal(t, 4, omitted)
+
+	got, _, omitted = p.Apply("ls", exit(0), "file", "")
+	assert.Empty(t, got, "only failed commands keep output")
+	assert.Equal(t, 4, omitted)
+
+	got, _, omitted = p.Apply("ls", exit(2), "nope", "")
+	assert.Equal(t, "nope", got)
+	assert.Zero(t, omitted)
+
+	got, _, _ = p.Apply("ls", nil, "file", "")
+	assert.Equal(t, "file", got, "commands whose status is not known keep their output")
+}
+
+func TestSpill(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "s.outputs")
+	p := &Policy{SpillDir: dir}
+	path, err := p.Spill("command-3-*.txt", "all of it")
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(path))
+	assert.True(t, strings.HasPrefix(filepath.Base(path), "command-3-"), path)
+	assert.True(t, strings.HasSuffix(path, ".txt"), path)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "all of it", string(data))
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	other, err := p.Spill("command-3-*.txt", "another session's")
+	require.NoError(t, err)
+	assert.NotEqual(t, path, other, "sessions sharing the directory keep their own files")
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "all of it", string(data))
+
+	path, err = (&Policy{}).Spill("command-3-*.txt", "all of it")
+	assert.NoError(t, err)
+	assert.Empty(t, path, "nowhere to spill to")
+}
@@ -0,0 +1,232 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Stream applies a policy to the output of a command as it arrives, a
+// line at a time, so that no more of it is held than the policy keeps.
+// Once the output outgrows the limit, its start is kept along with a
+// rolling tail of the latest lines, and the lines in between are written
+// to the spill file as they drop out of the tail.
+type Stream struct {
+	policy  *Policy
+	input   string
+	pattern string
+	limit   int // bytes kept, or -1 for all of them
+
+	head, tail           []piece
+	headBytes, tailBytes int
+	cutting              bool // lines have been left out
+	omitted, total       int
+	styled               bool // some line came with styled text
+	unstyled             bool // some line came without it
+	spill                *os.File
+	newline              bool  // the last line spilled needs a newline before the next
+	err                  error // the first error writing the spill file
+}
+
+// piece is a line of output. A partial line goes on in the next one.
+type piece struct {
+	text, styled string
+	partial      bool
+}
+
+func (l piece) size() int {
+	if l.partial {
+		return len(l.text)
+	}
+	return len(l.text) + 1
+}
+
+// Stream starts applying the policy to the output of the command line
+// input. The spill file, if one is needed, is named after pattern as by
+// Spill. A nil Policy returns a nil Stream, which keeps everything.
+func (p *Policy) Stream(input, pattern string) *Stream {
+	if p == nil {
+		return nil
+	}
+	s := &Stream{policy: p, input: input, pattern: pattern, limit: -1}
+	switch p.mode(input) {
+	case Omit:
+		s.limit = 0
+	case Limit:
+		if p.MaxBytes > 0 {
+			s.limit = p.MaxBytes
+		}
+	}
+	return s
+}
+
+// Cuts reports whether the stream may leave lines out, and so whether it
+// is worth adding lines to it before the output is complete.
+func (s *Stream) Cuts() bool {
+	return s != nil && s.limit >= 0
+}
+
+// Add adds a line of output, with its styled text if it has any. A
+// partial line goes on in the next one.
+func (s *Stream) Add(text, styled string, partial bool) {
+	l := piece{text: text, styled: styled, partial: partial}
+	s.total += l.size()
+	s.styled = s.styled || styled != ""
+	s.unstyled = s.unstyled || styled == "" && text != ""
+	if s.cutting {
+		s.tail = append(s.tail, l)
+		s.tailBytes += l.size()
+		s.trim()
+		return
+	}
+	s.head = append(s.head, l)
+	s.headBytes += l.size()
+	if s.limit >= 0 && s.headBytes > s.limit {
+		s.cut()
+	}
+}
+
+// Finish adds the rest of the output and returns what the policy keeps of
+// the whole, as Apply does, with how many bytes were left out and the path
+// of the file the whole output was spilled to, if any.
+func (s *Stream) Finish(exitCode *int, rest, restStyled string) (output, styled string, omitted int, path string, err error) {
+	if s == nil {
+		return rest, restStyled, 0, "", nil
+	}
+	if !s.cutting {
+		whole := strings.Trim(join(s.head, false)+rest, "\n")
+		styled = strings.Trim(join(s.head, true)+restStyled, "\n")
+		output, styled, omitted = s.policy.Apply(s.input, exitCode, whole, styled)
+		if omitted > 0 {
+			path, err = s.policy.Spill(s.pattern, whole)
+		}
+		return output, styled, omitted, path, err
+	}
+
+	texts := strings.Split(rest, "\n")
+	styles := strings.Split(restStyled, "\n")
+	if len(styles) != len(texts) {
+		styles = make([]string, len(texts))
+	}
+	for i := range texts {
+		s.Add(texts[i], styles[i], false)
+	}
+	if s.policy.FailedOnly && exitCode != nil && *exitCode == 0 {
+		s.omitted = s.total - 1 // the last line has no newline
+	} else {
+		output = s.kept(false)
+		if s.styled && !s.unstyled {
+			styled = s.kept(true)
+		}
+	}
+	s.write(s.tail...)
+	path, err = s.close()
+	return output, styled, s.omitted, path, err
+}
+
+// Discard drops the output, removing the spill file if one was begun.
+func (s *Stream) Discard() {
+	if s != nil && s.spill != nil {
+		_ = s.spill.Close()
+		_ = os.Remove(s.spill.Name())
+		s.spill = nil
+	}
+}
+
+// cut starts leaving lines out: as many lines as fit in half the limit
+// are kept from the start, and the rest go on to the tail.
+func (s *Stream) cut() {
+	n, size := 0, 0
+	for n < len(s.head) && size+s.head[n].size() <= s.limit/2 {
+		size += s.head[n].size()
+		n++
+	}
+	s.tail = append([]piece(nil), s.head[n:]...)
+	s.tailBytes = s.headBytes - size
+	s.head, s.headBytes = s.head[:n:n], size
+	s.cutting = true
+	s.trim()
+}
+
+// trim drops lines from the tail until it fits in half the limit.
+func (s *Stream) trim() {
+	for len(s.tail) > 0 && s.tailBytes > s.limit/2 {
+		l := s.tail[0]
+		s.tail = s.tail[1:]
+		s.tailBytes -= l.size()
+		s.omitted += l.size()
+		s.write(l)
+	}
+}
+
+// kept renders the head and the tail with the marker between them.
+func (s *Stream) kept(styled bool) string {
+	var kept []string
+	if head := strings.Trim(join(s.head, styled), "\n"); head != "" {
+		kept = append(kept, head)
+	}
+	kept = append(kept, marker(s.omitted))
+	if tail := strings.Trim(join(s.tail, styled), "\n"); tail != "" {
+		kept = append(kept, tail)
+	}
+	return strings.Join(kept, "\n")
+}
+
+// write writes lines to the spill file, creating it, and writing the head
+// first, the first time lines are left out.
+func (s *Stream) write(lines ...piece) {
+	if s.err != nil || s.policy.SpillDir == "" {
+		return
+	}
+	if s.spill == nil {
+		if s.spill, s.err = s.policy.create(s.pattern); s.err != nil {
+			return
+		}
+		lines = append(s.head[:len(s.head):len(s.head)], lines...)
+	}
+	var sb strings.Builder
+	for _, l := range lines {
+		if s.newline {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(l.text)
+		s.newline = !l.partial
+	}
+	if _, err := s.spill.WriteString(sb.String()); err != nil {
+		s.err = fmt.Errorf("failed to spill output: %w", err)
+	}
+}
+
+// close closes the spill file and returns its path, or removes it if it
+// could not be written whole.
+func (s *Stream) close() (string, error) {
+	if s.spill == nil {
+		return "", s.err
+	}
+	f := s.spill
+	s.spill = nil
+	if err := f.Close(); err != nil && s.err == nil {
+		s.err = fmt.Errorf("failed to spill output: %w", err)
+	}
+	if s.err != nil {
+		_ = os.Remove(f.Name())
+		return "", s.err
+	}
+	return f.Name(), nil
+}
+
+// join renders lines, ending each but the partial ones with a newline.
+func join(lines []piece, styled bool) string {
+	var sb strings.Builder
+	for _, l := range lines {
+		if styled {
+			sb.WriteString(l.styled)
+		} else {
+			sb.WriteString(l.text)
+		}
+		if !l.partial {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
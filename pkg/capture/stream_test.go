@@ -0,0 +1,99 @@
+package capture
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream_HeadAndTail(t *testing.T) {
+	var lines, styled []string
+	for i := 1; i <= 100; i++ {
+		lines = append(lines, fmt.Sprintf("line %03d", i))
+		styled = append(styled, fmt.Sprintf("\x1b[32mline %03d\x1b[0m", i))
+	}
+	output := strings.Join(lines, "\n")
+	p := &Policy{MaxBytes: 90, SpillDir: t.TempDir()}
+	wantOutput, wantStyled, wantOmitted := p.Apply("seq 100", exit(1), output, strings.Join(styled, "\n"))
+
+	s := p.Stream("seq 100", "command-1-*.txt")
+	require.True(t, s.Cuts())
+	for i := range 97 {
+		s.Add(lines[i], styled[i], false)
+		assert.LessOrEqual(t, s.headBytes+s.tailBytes, p.MaxBytes, "no more is held than is kept")
+	}
+	got, gotStyled, omitted, path, err := s.Finish(exit(1), strings.Join(lines[97:], "\n"), strings.Join(styled[97:], "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, wantOutput, got, "cut as Apply cuts the whole output")
+	assert.Equal(t, wantStyled, gotStyled)
+	assert.Equal(t, wantOmitted, omitted)
+	spilled, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, output, string(spilled), "spilled whole")
+
+	s = p.Stream("seq 100", "command-2-*.txt")
+	s.Add("line 001", "", false)
+	got, _, omitted, path, err = s.Finish(exit(0), "line 002", "")
+	require.NoError(t, err)
+	assert.Equal(t, "line 001\nline 002", got, "output within the limit is kept")
+	assert.Zero(t, omitted)
+	assert.Empty(t, path)
+}
+
+func TestStream_FailedOnly(t *testing.T) {
+	p := &Policy{MaxBytes: 8, FailedOnly: true, SpillDir: t.TempDir()}
+	s := p.Stream("seq 5", "command-1-*.txt")
+	for _, line := range []string{"1", "2", "3", "4"} {
+		s.Add(line, "", false)
+	}
+	got, styled, omitted, path, err := s.Finish(exit(0), "5", "")
+	require.NoError(t, err)
+	assert.Empty(t, got)
+	assert.Empty(t, styled)
+	assert.Equal(t, 9, omitted)
+	spilled, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "1\n2\n3\n4\n5", string(spilled))
+}
+
+func TestStream_PartialLines(t *testing.T) {
+	p := &Policy{MaxBytes: 10, SpillDir: t.TempDir()}
+	s := p.Stream("cat min.json", "command-1-*.txt")
+	for range 5 {
+		s.Add("abcdefgh", "", true)
+	}
+	got, _, omitted, path, err := s.Finish(nil, "ijkl", "")
+	require.NoError(t, err)
+	assert.Equal(t, "[… 40 bytes of output omitted …]\nijkl", got)
+	assert.Equal(t, 40, omitted)
+	spilled, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("abcdefgh", 5)+"ijkl", string(spilled), "partial lines are joined")
+}
+
+func TestStream_Discard(t *testing.T) {
+	dir := t.TempDir()
+	s := (&Policy{MaxBytes: 2, SpillDir: dir}).Stream("seq 3", "command-1-*.txt")
+	for _, line := range []string{"1", "2", "3"} {
+		s.Add(line, "", false)
+	}
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "spilled as the output arrives")
+	s.Discard()
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	var nilPolicy *Policy
+	s = nilPolicy.Stream("seq 3", "command-1-*.txt")
+	assert.False(t, s.Cuts())
+	got, _, omitted, _, err := s.Finish(nil, "1\n2\n3", "")
+	require.NoError(t, err)
+	assert.Equal(t, "1\n2\n3", got)
+	assert.Zero(t, omitted)
+}
@@ -0,0 +1,252 @@
+// Package cast writes terminal recordings in asciinema's asciicast v2
+// format: a JSON header line followed by one JSON array per event.
+//
+// See https://docs.asciinema.org/manual/asciicast/v2/
+package cast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Event types.
+const (
+	EventOutput = "o"
+	EventInput  = "i"
+	EventMarker = "m"
+	EventResize = "r"
+)
+
+// coalesceWindow is how close together output chunks must be to be merged
+// into one event. Terminal output arrives in many small reads; merging them
+// keeps files small without visibly changing playback.
+const coalesceWindow = 5 * time.Millisecond
+
+// Header is the first line of an asciicast file.
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Duration  float64           `json:"duration,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is a single entry of the recording. Time is relative to the start.
+type Event struct {
+	Time time.Duration
+	Type string
+	Data string
+}
+
+// MarshalJSON encodes e as [time, type, data].
+func (e Event) MarshalJSON() ([]byte, error) {
+	data, err := marshal(e.Data)
+	if err != nil {
+		return nil, err
+	}
+	t := strconv.FormatFloat(e.Time.Seconds(), 'f', 6, 64)
+	return []byte("[" + t + "," + strconv.Quote(e.Type) + "," + string(data) + "]"), nil
+}
+
+// UnmarshalJSON decodes an event from [time, type, data].
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	if len(raw) != 3 {
+		return fmt.Errorf("invalid asciicast event: %s", b)
+	}
+	var seconds float64
+	if err := json.Unmarshal(raw[0], &seconds); err != nil {
+		return fmt.Errorf("invalid asciicast event time: %w", err)
+	}
+	if err := json.Unmarshal(raw[1], &e.Type); err != nil {
+		return fmt.Errorf("invalid asciicast event type: %w", err)
+	}
+	if err := json.Unmarshal(raw[2], &e.Data); err != nil {
+		return fmt.Errorf("invalid asciicast event data: %w", err)
+	}
+	e.Time = time.Duration(seconds * float64(time.Second))
+	return nil
+}
+
+// Writer records a live terminal stream. It is safe for concurrent use.
+type Writer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	start  time.Time
+	now    func() time.Time
+	filter func(string) string
+	err    error
+
+	pending     []byte
+	pendingTime time.Duration
+}
+
+// NewWriter writes the header h to w and returns a Writer whose event times
+// are relative to now. Version and Timestamp are filled in if unset.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	cw := &Writer{w: w, start: time.Now(), now: time.Now}
+	if h.Version == 0 {
+		h.Version = 2
+	}
+	if h.Timestamp == 0 {
+		h.Timestamp = cw.start.Unix()
+	}
+	if err := cw.writeJSON(h); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// SetFilter sets a function applied to the data of every output event
+// before it is written, such as a secret redactor.
+func (cw *Writer) SetFilter(filter func(string) string) {
+	cw.mu.Lock()
+	cw.filter = filter
+	cw.mu.Unlock()
+}
+
+// Output records terminal output.
+func (cw *Writer) Output(p []byte) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	t := cw.now().Sub(cw.start)
+	if len(cw.pending) > 0 && t-cw.pendingTime > coalesceWindow {
+		cw.flushOutput(false)
+	}
+	if len(cw.pending) == 0 {
+		cw.pendingTime = t
+	}
+	cw.pending = append(cw.pending, p...)
+}
+
+// Marker records a marker, such as the start of a command.
+func (cw *Writer) Marker(label string) {
+	cw.event(EventMarker, label)
+}
+
+// Resize records a change of the terminal size.
+func (cw *Writer) Resize(cols, rows int) {
+	cw.event(EventResize, fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// WriteEvent writes an event with an explicit time, for recordings that
+// are not captured live.
+func (cw *Writer) WriteEvent(e Event) error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.flushOutput(true)
+	if e.Type == EventOutput && cw.filter != nil {
+		e.Data = cw.filter(e.Data)
+	}
+	cw.writeJSON(e)
+	return cw.err
+}
+
+// Close writes any buffered output. It does not close the underlying
+// writer. It returns the first error encountered while writing.
+func (cw *Writer) Close() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.flushOutput(true)
+	return cw.err
+}
+
+func (cw *Writer) event(typ, data string) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.flushOutput(true)
+	cw.writeJSON(Event{Time: cw.now().Sub(cw.start), Type: typ, Data: data})
+}
+
+// flushOutput writes the pending output as one event. Unless all is set, an
+// incomplete UTF-8 sequence at the end is kept for the next event.
+func (cw *Writer) flushOutput(all bool) {
+	data := cw.pending
+	if !all {
+		data = data[:completeUTF8(data)]
+	}
+	if len(data) == 0 {
+		return
+	}
+	s := string(data)
+	if cw.filter != nil {
+		s = cw.filter(s)
+	}
+	cw.writeJSON(Event{Time: cw.pendingTime, Type: EventOutput, Data: s})
+	cw.pending = append(cw.pending[:0], cw.pending[len(data):]...)
+}
+
+func (cw *Writer) writeJSON(v any) error {
+	if cw.err != nil {
+		return cw.err
+	}
+	b, err := marshal(v)
+	if err == nil {
+		b = append(b, '\n')
+		_, err = cw.w.Write(b)
+	}
+	cw.err = err
+	return err
+}
+
+// marshal encodes v as JSON without escaping <, > and &, which are common
+// in terminal output.
+func marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// completeUTF8 returns the length of the longest prefix of p that does not
+// end in the middle of a UTF-8 sequence.
+func completeUTF8(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if !utf8.FullRune(p[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(p)
+}
+
+// Read parses an asciicast v2 recording.
+func Read(r io.Reader) (Header, []Event, error) {
+	dec := json.NewDecoder(r)
+	var h Header
+	if err := dec.Decode(&h); err != nil {
+		return h, nil, fmt.Errorf("invalid asciicast header: %w", err)
+	}
+	if h.Version != 2 {
+		return h, nil, fmt.Errorf("unsupported asciicast version %d", h.Version)
+	}
+	var events []Event
+	for {
+		var e Event
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return h, events, nil
+		}
+		if err != nil {
+			return h, events, err
+		}
+		events = append(events, e)
+	}
+}
@@ -0,0 +1,91 @@
+package cast
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock returns a Writer clock that advances by the durations it is
+// given, one per call.
+func fakeClock(start time.Time, steps ...time.Duration) func() time.Time {
+	now := start
+	return func() time.Time {
+		if len(steps) > 0 {
+			now = now.Add(steps[0])
+			steps = steps[1:]
+		}
+		return now
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{Width: 80, Height: 24, Timestamp: 1700000000})
+	require.NoError(t, err)
+	w.now = fakeClock(w.start, time.Second, time.Millisecond, time.Second, 0, time.Second)
+
+	w.Output([]byte("$ l"))      // 1s
+	w.Output([]byte("s\r\n"))    // 1.001s, merged
+	w.Marker("ls")               // 2.001s
+	w.Output([]byte("file\r\n")) // 2.001s
+	w.Resize(100, 30)            // 3.001s
+	require.NoError(t, w.Close())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{
+		`{"version":2,"width":80,"height":24,"timestamp":1700000000}`,
+		`[1.000000,"o","$ ls\r\n"]`,
+		`[2.001000,"m","ls"]`,
+		`[2.001000,"o","file\r\n"]`,
+		`[3.001000,"r","100x30"]`,
+	}, lines)
+}
+
+func TestWriter_KeepsUTF8Together(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{Width: 80, Height: 24})
+	require.NoError(t, err)
+	w.now = fakeClock(w.start, 0, time.Second)
+	b := []byte("é")
+	w.Output(b[:1])
+	w.Output(b[1:])
+	require.NoError(t, w.Close())
+
+	_, events, err := Read(&buf)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "é", events[0].Data)
+}
+
+func TestWriter_Filter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{Width: 80, Height: 24})
+	require.NoError(t, err)
+	w.SetFilter(func(s string) string { return strings.ReplaceAll(s, "hunter2", "<redacted>") })
+	w.Output([]byte("password: hunter2\r\n"))
+	require.NoError(t, w.Close())
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.Contains(t, buf.String(), "<redacted>")
+}
+
+func TestRead(t *testing.T) {
+	input := `{"version": 2, "width": 100, "height": 30, "title": "demo"}
+[0.5, "o", "hello"]
+[1.25, "m", "step"]
+`
+	h, events, err := Read(strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, Header{Version: 2, Width: 100, Height: 30, Title: "demo"}, h)
+	assert.Equal(t, []Event{
+		{Time: 500 * time.Millisecond, Type: EventOutput, Data: "hello"},
+		{Time: 1250 * time.Millisecond, Type: EventMarker, Data: "step"},
+	}, events)
+
+	_, _, err = Read(strings.NewReader(`{"version": 1}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,180 @@
+// Package delivery sends messages, such as the audit records of a session,
+// one at a time in the order they were queued, retrying those that fail,
+// so that a slow or flaky destination neither reorders nor loses them
+// silently.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Options tunes a queue.
+type Options struct {
+	Buffer     int           // messages that can wait to be sent; more are dropped
+	Attempts   int           // times a message is tried before it is given up on
+	Backoff    time.Duration // wait before the first retry, doubled for each one after
+	MaxBackoff time.Duration // longest wait between retries
+}
+
+// DefaultOptions retries a message for about a quarter of a minute.
+var DefaultOptions = Options{Buffer: 1000, Attempts: 5, Backoff: time.Second, MaxBackoff: 8 * time.Second}
+
+// DefaultFlushTimeout is how long messages still queued when a session
+// ends are given to be sent.
+const DefaultFlushTimeout = 10 * time.Second
+
+// permanentError is an error that retrying will not fix.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying will not fix, such as a request
+// the destination rejected, so the message is given up on at once.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Retryable reports whether a request answered with an HTTP status code
+// may succeed if sent again.
+func Retryable(status int) bool {
+	return status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// Queue sends messages of type T in the background, in order.
+type Queue[T any] struct {
+	name   string
+	send   func(context.Context, T) error
+	opts   Options
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // closed once the queue has stopped sending
+
+	mu          sync.Mutex
+	pending     chan queued[T]
+	closed      bool
+	seq         int
+	undelivered []queued[T]
+}
+
+// queued is a message with its place in the queue.
+type queued[T any] struct {
+	seq int
+	msg T
+}
+
+// New returns a queue that sends each message pushed to it with send,
+// which should give up when its context is cancelled. name describes the
+// destination in logs.
+func New[T any](name string, send func(ctx context.Context, msg T) error, opts Options) *Queue[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue[T]{
+		name:    name,
+		send:    send,
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		pending: make(chan queued[T], max(opts.Buffer, 1)),
+	}
+	go q.run()
+	return q
+}
+
+// Push queues msg to be sent. It never blocks: if the buffer is full, msg
+// is dropped, to be reported by Close, and Push returns false. Once the
+// queue is closed, msg is dropped and Push returns false.
+func (q *Queue[T]) Push(msg T) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		logrus.Debugf("Delivery queue for %s is closed, dropping a message", q.name)
+		return false
+	}
+	q.seq++
+	m := queued[T]{q.seq, msg}
+	select {
+	case q.pending <- m:
+		return true
+	default:
+	}
+	logrus.Debugf("Delivery queue for %s is full, dropping a message", q.name)
+	q.undelivered = append(q.undelivered, m)
+	return false
+}
+
+// Close stops taking messages and waits up to timeout for those queued to
+// be sent, then gives up on the rest. It returns the messages that were
+// not delivered, in the order they were pushed.
+func (q *Queue[T]) Close(timeout time.Duration) []T {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.pending)
+	}
+	q.mu.Unlock()
+	select {
+	case <-q.done:
+	case <-time.After(timeout):
+		logrus.Debugf("Delivery to %s timed out after %s", q.name, timeout)
+		q.cancel()
+		<-q.done
+	}
+	q.cancel()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	slices.SortFunc(q.undelivered, func(a, b queued[T]) int { return a.seq - b.seq })
+	msgs := make([]T, len(q.undelivered))
+	for i, m := range q.undelivered {
+		msgs[i] = m.msg
+	}
+	return msgs
+}
+
+func (q *Queue[T]) run() {
+	defer close(q.done)
+	for m := range q.pending {
+		err := q.ctx.Err()
+		if err == nil {
+			err = q.deliver(m.msg)
+		}
+		if err != nil {
+			logrus.WithError(err).Debugf("Failed to deliver a message to %s", q.name)
+			q.mu.Lock()
+			q.undelivered = append(q.undelivered, m)
+			q.mu.Unlock()
+		}
+	}
+}
+
+// deliver sends msg, retrying with backoff until it is sent, the attempts
+// run out or the queue gives up.
+func (q *Queue[T]) deliver(msg T) error {
+	wait := q.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		err := q.send(q.ctx, msg)
+		if err == nil || attempt >= q.opts.Attempts || errors.As(err, new(permanentError)) || q.ctx.Err() != nil {
+			return err
+		}
+		logrus.WithError(err).Debugf("Delivery to %s failed, retrying in %s", q.name, wait)
+		select {
+		case <-time.After(wait):
+		case <-q.ctx.Done():
+			return err
+		}
+		wait = min(wait*2, q.opts.MaxBackoff)
+	}
+}
@@ -0,0 +1,131 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+var fast = Options{Buffer: 10, Attempts: 3, Backoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+// destination records the messages sent to it, failing as told.
+type destination struct {
+	mu    sync.Mutex
+	got   []string
+	tries map[string]int
+	fail  func(msg string, try int) error
+}
+
+func (d *destination) send(ctx context.Context, msg string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.tries == nil {
+		d.tries = map[string]int{}
+	}
+	d.tries[msg]++
+	if d.fail != nil {
+		if err := d.fail(msg, d.tries[msg]); err != nil {
+			return err
+		}
+	}
+	d.got = append(d.got, msg)
+	return nil
+}
+
+func TestQueue_RetriesInOrder(t *testing.T) {
+	d := &destination{fail: func(msg string, try int) error {
+		if msg == "b" && try < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	}}
+	q := New("test", d.send, fast)
+	for _, msg := range []string{"a", "b", "c"} {
+		assert.True(t, q.Push(msg))
+	}
+
+	assert.Empty(t, q.Close(time.Second))
+	assert.Equal(t, []string{"a", "b", "c"}, d.got, "c waits for b to be retried")
+	assert.Equal(t, 3, d.tries["b"])
+}
+
+func TestQueue_ReportsUndelivered(t *testing.T) {
+	d := &destination{fail: func(msg string, try int) error {
+		switch msg {
+		case "rejected":
+			return Permanent(errors.New("403 Forbidden"))
+		case "flaky":
+			return errors.New("503 Service Unavailable")
+		}
+		return nil
+	}}
+	q := New("test", d.send, fast)
+	q.Push("rejected")
+	q.Push("flaky")
+	q.Push("ok")
+
+	assert.Equal(t, []string{"rejected", "flaky"}, q.Close(time.Second))
+	assert.Equal(t, []string{"ok"}, d.got)
+	assert.Equal(t, 1, d.tries["rejected"], "permanent errors are not retried")
+	assert.Equal(t, fast.Attempts, d.tries["flaky"])
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	defer logrus.SetLevel(logrus.GetLevel())
+	logrus.SetLevel(logrus.DebugLevel)
+	assert.False(t, q.Push("late"), "closed")
+	assert.Equal(t, "Delivery queue for test is closed, dropping a message", hook.LastEntry().Message)
+}
+
+func TestQueue_DropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	var sent []string
+	q := New("test", func(ctx context.Context, msg string) error {
+		started <- struct{}{}
+		<-release
+		sent = append(sent, msg)
+		return nil
+	}, Options{Buffer: 2, Attempts: 1})
+	q.Push("1")
+	<-started // 1 is being sent, so 2 and 3 fill the buffer
+	for i := 2; i <= 5; i++ {
+		assert.Equal(t, i <= 3, q.Push(fmt.Sprint(i)), i)
+	}
+	go func() {
+		for range started {
+		}
+	}()
+	close(release)
+
+	assert.Equal(t, []string{"4", "5"}, q.Close(time.Second))
+	assert.Equal(t, []string{"1", "2", "3"}, sent)
+}
+
+func TestQueue_FlushTimesOut(t *testing.T) {
+	q := New("test", func(ctx context.Context, msg string) error {
+		if msg == "slow" {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}, fast)
+	q.Push("slow")
+	q.Push("queued")
+
+	start := time.Now()
+	assert.Equal(t, []string{"slow", "queued"}, q.Close(50*time.Millisecond))
+	assert.Less(t, time.Since(start), time.Second, "the message being sent is cancelled")
+}
+
+func TestRetryable(t *testing.T) {
+	for status, want := range map[int]bool{200: false, 400: false, 403: false, 408: true, 429: true, 500: true, 503: true} {
+		assert.Equal(t, want, Retryable(status), status)
+	}
+}
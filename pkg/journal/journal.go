@@ -0,0 +1,274 @@
+// Package journal writes a session to disk while it is recorded, one JSON
+// line per change, so that it survives ohsh being killed, the machine
+// sleeping or the connection dropping, and can be recovered afterwards.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ohshell/cli/pkg/output"
+	"github.com/ohshell/cli/pkg/record"
+)
+
+// Ext is the file extension of journals.
+const Ext = ".jsonl"
+
+// Entry types.
+const (
+	entryStart   = "start"
+	entryCommand = "command"
+	entryRemove  = "remove"
+	entryEnd     = "end"
+)
+
+// entry is one line of a journal. A command entry holds the whole command
+// and replaces any earlier entry with the same ID.
+type entry struct {
+	Type    string              `json:"type"`
+	Time    time.Time           `json:"time"`
+	ID      int                 `json:"id,omitempty"`
+	Command *output.CommandJSON `json:"command,omitempty"`
+
+	PID  int    `json:"pid,omitempty"`  // start: the ohsh process writing the journal
+	Host string `json:"host,omitempty"` // start: the machine it runs on
+
+	ExitCode      *int   `json:"exit_code,omitempty"` // end: the shell's exit status
+	ClosingNote   string `json:"closing_note,omitempty"`
+	SlackThreadTS string `json:"slack_thread_ts,omitempty"`
+}
+
+// Dir returns the directory journals are kept in,
+// $XDG_STATE_HOME/ohsh/sessions or ~/.local/state/ohsh/sessions.
+func Dir() (string, error) {
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		state = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(state, "ohsh", "sessions"), nil
+}
+
+// Journal is a session being written to disk. It implements
+// record.Journal. Every entry is synced before the call returns, so a
+// command is on disk once it has started and again once it has finished.
+type Journal struct {
+	mu   sync.Mutex
+	f    *os.File
+	path string
+}
+
+// Create starts a new journal in dir, creating dir if needed. Journals
+// hold command output, so they are only readable by the user.
+func Create(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create session journal dir: %w", err)
+	}
+	now := time.Now()
+	path := filepath.Join(dir, fmt.Sprintf("%s-%d%s", now.Format("20060102-150405"), os.Getpid(), Ext))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session journal: %w", err)
+	}
+	j := &Journal{f: f, path: path}
+	host, _ := os.Hostname()
+	if err := j.write(entry{Type: entryStart, Time: now, PID: os.Getpid(), Host: host}); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return j, nil
+}
+
+// ID returns the name the session is known by: the journal's file name
+// without the extension.
+func (j *Journal) ID() string {
+	return strings.TrimSuffix(filepath.Base(j.path), Ext)
+}
+
+// Path returns the journal's file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Update records the current state of a command.
+func (j *Journal) Update(id int, cmd record.Command) error {
+	c := output.NewCommandJSON(cmd)
+	return j.write(entry{Type: entryCommand, Time: time.Now(), ID: id, Command: &c})
+}
+
+// Remove records that a command was dropped from the session.
+func (j *Journal) Remove(id int) error {
+	return j.write(entry{Type: entryRemove, Time: time.Now(), ID: id})
+}
+
+// Close records the end of the session and closes the file.
+func (j *Journal) Close(session *record.Session) error {
+	exitCode := session.ExitCode
+	err := j.write(entry{
+		Type:          entryEnd,
+		Time:          session.EndTime,
+		ExitCode:      &exitCode,
+		ClosingNote:   session.ClosingNote,
+		SlackThreadTS: session.SlackThreadTS,
+	})
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return err
+	}
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	j.f = nil
+	return err
+}
+
+func (j *Journal) write(e entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.f == nil {
+		return errors.New("session journal is closed")
+	}
+	if _, err := j.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write session journal: %w", err)
+	}
+	if err := j.f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync session journal: %w", err)
+	}
+	return nil
+}
+
+// Info describes a journal on disk.
+type Info struct {
+	ID        string // file name without the extension
+	Path      string
+	StartTime time.Time
+	EndTime   time.Time // when the session ended, or of the last entry if it did not
+	Commands  int
+	Finished  bool // the session ended normally
+	PID       int
+	Host      string
+}
+
+// Running reports whether the ohsh writing the journal is still recording,
+// as far as can be told from this machine.
+func (i Info) Running() bool {
+	if i.Finished || i.PID <= 0 {
+		return false
+	}
+	if host, _ := os.Hostname(); host != i.Host {
+		return false
+	}
+	err := syscall.Kill(i.PID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Load rebuilds the session in a journal. A last line cut short by a
+// crash is ignored.
+func Load(path string) (*record.Session, Info, error) {
+	info := Info{ID: strings.TrimSuffix(filepath.Base(path), Ext), Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, info, err
+	}
+	defer f.Close()
+
+	session := &record.Session{}
+	var ids []int
+	commands := map[int]record.Command{}
+	r := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		b, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, info, err
+		}
+		if len(bytes.TrimSpace(b)) > 0 {
+			var e entry
+			if jerr := json.Unmarshal(b, &e); jerr != nil {
+				if err == io.EOF {
+					break // the write was interrupted
+				}
+				return nil, info, fmt.Errorf("%s:%d: invalid journal entry: %w", path, line, jerr)
+			}
+			info.EndTime = e.Time
+			switch e.Type {
+			case entryStart:
+				session.StartTime = e.Time
+				info.StartTime, info.PID, info.Host = e.Time, e.PID, e.Host
+			case entryCommand:
+				if e.Command == nil {
+					continue
+				}
+				if _, ok := commands[e.ID]; !ok {
+					ids = append(ids, e.ID)
+				}
+				commands[e.ID] = e.Command.Command()
+			case entryRemove:
+				delete(commands, e.ID)
+			case entryEnd:
+				info.Finished = true
+				if e.ExitCode != nil {
+					session.ExitCode = *e.ExitCode
+				}
+				session.ClosingNote = e.ClosingNote
+				session.SlackThreadTS = e.SlackThreadTS
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if cmd, ok := commands[id]; ok {
+			session.Commands = append(session.Commands, cmd)
+		}
+	}
+	session.EndTime = info.EndTime
+	info.Commands = len(session.Commands)
+	return session, info, nil
+}
+
+// List describes the journals in dir, newest first. Journals that cannot
+// be read are skipped.
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var infos []Info
+	for _, de := range entries {
+		if de.IsDir() || filepath.Ext(de.Name()) != Ext {
+			continue
+		}
+		_, info, err := Load(filepath.Join(dir, de.Name()))
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(a, b int) bool { return infos[a].StartTime.After(infos[b].StartTime) })
+	return infos, nil
+}
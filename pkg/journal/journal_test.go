@@ -0,0 +1,98 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Create(dir)
+	require.NoError(t, err)
+
+	started := time.Now().Truncate(time.Millisecond)
+	code := 0
+	require.NoError(t, j.Update(1, record.Command{Timestamp: started, Input: "ls"}))
+	require.NoError(t, j.Update(1, record.Command{Timestamp: started, Input: "ls", Output: "file", ExitCode: &code}))
+	require.NoError(t, j.Update(2, record.Command{Input: "cat secret"}))
+	require.NoError(t, j.Remove(2))
+	require.NoError(t, j.Update(3, record.Command{Input: "kubectl drain node-1", Comment: "safe"}))
+
+	// Killed here: nothing is lost but the session is not finished.
+	session, info, err := Load(j.Path())
+	require.NoError(t, err)
+	assert.False(t, info.Finished)
+	assert.True(t, info.Running(), "this process is still alive")
+	require.Len(t, session.Commands, 2)
+	assert.Equal(t, "file", session.Commands[0].Output)
+	assert.Equal(t, &code, session.Commands[0].ExitCode)
+	assert.True(t, session.Commands[0].Timestamp.Equal(started))
+	assert.Equal(t, "safe", session.Commands[1].Comment)
+	assert.False(t, session.StartTime.IsZero())
+
+	require.NoError(t, j.Close(&record.Session{EndTime: time.Now(), ExitCode: 3, ClosingNote: "done"}))
+	session, info, err = Load(j.Path())
+	require.NoError(t, err)
+	assert.True(t, info.Finished)
+	assert.False(t, info.Running())
+	assert.Equal(t, 2, info.Commands)
+	assert.Equal(t, 3, session.ExitCode)
+	assert.Equal(t, "done", session.ClosingNote)
+
+	fi, err := os.Stat(j.Path())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+}
+
+func TestLoad_IgnoresTruncatedLastLine(t *testing.T) {
+	dir := t.TempDir()
+	j, err := Create(dir)
+	require.NoError(t, err)
+	require.NoError(t, j.Update(1, record.Command{Input: "ls"}))
+	f, err := os.OpenFile(j.Path(), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"type":"command","id":2,"command":{"inp`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	session, _, err := Load(j.Path())
+	require.NoError(t, err)
+	require.Len(t, session.Commands, 1)
+	assert.Equal(t, "ls", session.Commands[0].Input)
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	old := `{"type":"start","time":"2024-01-01T10:00:00Z","pid":1,"host":"elsewhere"}` + "\n" +
+		`{"type":"command","time":"2024-01-01T10:01:00Z","id":1,"command":{"timestamp":"2024-01-01T10:01:00Z","input":"ls","output":"","redacted":false}}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20240101-100000-1.jsonl"), []byte(old), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0o600))
+	j, err := Create(dir)
+	require.NoError(t, err)
+
+	infos, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, j.Path(), infos[0].Path)
+	assert.Equal(t, "20240101-100000-1", infos[1].ID)
+	assert.Equal(t, 1, infos[1].Commands)
+	assert.False(t, infos[1].Running(), "written on another host")
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 1, 0, 0, time.UTC), infos[1].EndTime)
+
+	infos, err = List(filepath.Join(dir, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, infos)
+}
+
+func TestDir(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+	dir, err := Dir()
+	require.NoError(t, err)
+	assert.Equal(t, "/state/ohsh/sessions", dir)
+}
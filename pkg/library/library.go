@@ -0,0 +1,167 @@
+// Package library keeps finished sessions on this machine as JSON files,
+// in the same directory as the journals of the sessions being recorded,
+// so they can be looked at, exported or uploaded later.
+package library
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohshell/cli/pkg/output"
+	"github.com/ohshell/cli/pkg/record"
+)
+
+// Ext is the file extension of saved sessions.
+const Ext = ".json"
+
+// titleLength is how much of a command line is shown as the title of a
+// session without one.
+const titleLength = 60
+
+// Entry describes a saved session.
+type Entry struct {
+	ID        string // file name without the extension
+	Path      string
+	StartTime time.Time
+	Duration  time.Duration
+	Commands  int
+	Title     string
+}
+
+// NewID returns an ID for a session started at start that has no journal
+// to take its ID from.
+func NewID(start time.Time) string {
+	return fmt.Sprintf("%s-%d", start.Format("20060102-150405"), os.Getpid())
+}
+
+// Save writes session to dir under id, replacing any session saved under
+// the same ID. Sessions hold command output, so they are only readable by
+// the user.
+func Save(dir, id string, session *record.Session) (string, error) {
+	data, err := output.ToJSON(session)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("failed to create session dir: %w", err)
+	}
+	path := filepath.Join(dir, id+Ext)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return "", fmt.Errorf("failed to save session: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("failed to save session: %w", err)
+	}
+	return path, nil
+}
+
+// OutputsDir is where the whole output of the commands of session id is
+// kept when the session itself keeps only part of it.
+func OutputsDir(dir, id string) string {
+	return filepath.Join(dir, id+".outputs")
+}
+
+// Remove deletes a saved session and the outputs kept beside it.
+func Remove(e Entry) error {
+	if err := os.Remove(e.Path); err != nil {
+		return err
+	}
+	return os.RemoveAll(OutputsDir(filepath.Dir(e.Path), e.ID))
+}
+
+// Load reads a saved session.
+func Load(path string) (*record.Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	session, err := output.FromJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a session file: %w", path, err)
+	}
+	return session, nil
+}
+
+// List describes the sessions saved in dir, newest first. Files that cannot
+// be read are skipped.
+func List(dir string) ([]Entry, error) {
+	des, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, de := range des {
+		if de.IsDir() || filepath.Ext(de.Name()) != Ext {
+			continue
+		}
+		path := filepath.Join(dir, de.Name())
+		session, err := Load(path)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, Entry{
+			ID:        strings.TrimSuffix(de.Name(), Ext),
+			Path:      path,
+			StartTime: session.StartTime,
+			Duration:  session.Duration(),
+			Commands:  len(session.Commands),
+			Title:     Title(session),
+		})
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].StartTime.After(entries[b].StartTime) })
+	return entries, nil
+}
+
+// Find returns the saved session whose ID is ref or, failing that, the
+// only one whose ID starts with ref.
+func Find(dir, ref string) (Entry, error) {
+	entries, err := List(dir)
+	if err != nil {
+		return Entry{}, err
+	}
+	ref = strings.TrimSuffix(filepath.Base(ref), Ext)
+	var matches []Entry
+	for _, e := range entries {
+		if e.ID == ref {
+			return e, nil
+		}
+		if strings.HasPrefix(e.ID, ref) {
+			matches = append(matches, e)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Entry{}, fmt.Errorf("no saved session %s", ref)
+	case 1:
+		return matches[0], nil
+	}
+	return Entry{}, fmt.Errorf("%s matches %d sessions, use more of the ID", ref, len(matches))
+}
+
+// Title names a session after its first step title or, if it has none,
+// its first command line.
+func Title(session *record.Session) string {
+	for _, cmd := range session.Commands {
+		if cmd.Title != "" {
+			return cmd.Title
+		}
+	}
+	if len(session.Commands) == 0 {
+		return ""
+	}
+	title := strings.Join(strings.Fields(session.Commands[0].Input), " ")
+	if len(title) > titleLength {
+		title = strings.ToValidUTF8(title[:titleLength], "") + "…"
+	}
+	return title
+}
@@ -0,0 +1,69 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func session(start time.Time, commands ...record.Command) *record.Session {
+	return &record.Session{StartTime: start, EndTime: start.Add(time.Minute), Commands: commands}
+}
+
+func TestSaveListFind(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	_, err := Save(dir, "20240102-150405-1", session(day, record.Command{Input: "ls"}, record.Command{Input: "kubectl drain node-1", Title: "Drain"}))
+	require.NoError(t, err)
+	path, err := Save(dir, "20240103-090000-2", session(day.Add(18*time.Hour), record.Command{Input: "uptime"}))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "20240104-000000-3.jsonl"), []byte("{}\n"), 0o600))
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), fi.Mode().Perm())
+
+	entries, err := List(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "20240103-090000-2", entries[0].ID)
+	assert.Equal(t, "uptime", entries[0].Title)
+	assert.Equal(t, "Drain", entries[1].Title)
+	assert.Equal(t, 2, entries[1].Commands)
+	assert.Equal(t, time.Minute, entries[1].Duration)
+
+	e, err := Find(dir, "20240102")
+	require.NoError(t, err)
+	assert.Equal(t, "20240102-150405-1", e.ID)
+	loaded, err := Load(e.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "kubectl drain node-1", loaded.Commands[1].Input)
+
+	_, err = Find(dir, "2024")
+	assert.EqualError(t, err, "2024 matches 2 sessions, use more of the ID")
+	_, err = Find(dir, "1999")
+	assert.EqualError(t, err, "no saved session 1999")
+
+	outputs := OutputsDir(dir, e.ID)
+	require.NoError(t, os.MkdirAll(outputs, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(outputs, "command-1.txt"), []byte("file\n"), 0o600))
+	entries, err = List(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2, "outputs dirs are not sessions")
+	require.NoError(t, Remove(e))
+	assert.NoFileExists(t, e.Path)
+	assert.NoDirExists(t, outputs)
+}
+
+func TestTitle(t *testing.T) {
+	assert.Empty(t, Title(&record.Session{}))
+	long := "echo " + strings.Repeat("x", 100)
+	title := Title(session(time.Now(), record.Command{Input: long}))
+	assert.Equal(t, long[:titleLength]+"…", title)
+}
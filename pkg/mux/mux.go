@@ -0,0 +1,63 @@
+// Package mux drives the terminal multiplexers ohsh can record a pane of
+// in place, tmux and GNU screen, so that the shell running in the pane is
+// recorded without being started by ohsh.
+package mux
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrUnknown is returned for what a multiplexer cannot tell about a pane.
+var ErrUnknown = errors.New("not known")
+
+// Multiplexer is a terminal multiplexer holding the pane to record. Panes
+// are named as the multiplexer names them: a tmux target such as %3 or
+// work:1.0, or a screen window number.
+type Multiplexer interface {
+	// Name returns the name of the multiplexer, e.g. "tmux".
+	Name() string
+	// Pane resolves target to the name the pane keeps for its lifetime.
+	Pane(target string) (string, error)
+	// Pipe copies everything the pane's programs write from now on to
+	// the file at path, which may be a FIFO.
+	Pipe(pane, path string) error
+	// Unpipe stops Pipe, closing the file.
+	Unpipe(pane string) error
+	// Type types line into the pane, followed by Enter.
+	Type(pane, line string) error
+	// Command names the program in the pane's foreground.
+	Command(pane string) (string, error)
+	// Size returns the size of the pane.
+	Size(pane string) (cols, rows int, err error)
+}
+
+// Detect returns the multiplexer ohsh is running inside of and the pane it
+// is running in.
+func Detect() (Multiplexer, string, bool) {
+	if os.Getenv("TMUX") != "" && os.Getenv("TMUX_PANE") != "" {
+		return &Tmux{}, os.Getenv("TMUX_PANE"), true
+	}
+	if sty := os.Getenv("STY"); sty != "" && os.Getenv("WINDOW") != "" {
+		return &Screen{Session: sty}, os.Getenv("WINDOW"), true
+	}
+	return nil, "", false
+}
+
+// ByName returns the multiplexer named name, for the session ohsh is
+// running inside of.
+func ByName(name string) (Multiplexer, error) {
+	switch name {
+	case "tmux":
+		return &Tmux{}, nil
+	case "screen":
+		return &Screen{Session: os.Getenv("STY")}, nil
+	}
+	return nil, errors.New("unknown multiplexer " + name)
+}
+
+// shellQuote quotes s as a single word for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,63 @@
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Screen records windows of a GNU screen session through its window log.
+// Screen cannot tell what a window is running or how big it is.
+type Screen struct {
+	Session string // the session's name, as in $STY
+}
+
+func (s *Screen) Name() string { return "screen" }
+
+func (s *Screen) Pane(target string) (string, error) {
+	return target, nil
+}
+
+func (s *Screen) Pipe(pane, path string) error {
+	if err := s.run(pane, "logfile", path); err != nil {
+		return err
+	}
+	// The log is flushed every 10 seconds by default.
+	if err := s.run(pane, "logfile", "flush", "1"); err != nil {
+		return err
+	}
+	return s.run(pane, "log", "on")
+}
+
+func (s *Screen) Unpipe(pane string) error {
+	return s.run(pane, "log", "off")
+}
+
+func (s *Screen) Type(pane, line string) error {
+	// stuff reads ^X as a control character and \ as an escape.
+	line = strings.NewReplacer(`\`, `\\`, "^", `\^`).Replace(line)
+	return s.run(pane, "stuff", line+"\r")
+}
+
+func (s *Screen) Command(pane string) (string, error) {
+	return "", ErrUnknown
+}
+
+func (s *Screen) Size(pane string) (int, int, error) {
+	return 0, 0, ErrUnknown
+}
+
+// run runs a screen command in window pane of the session.
+func (s *Screen) run(pane string, args ...string) error {
+	cmd := exec.Command("screen", append([]string{"-S", s.Session, "-p", pane, "-X"}, args...)...)
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(out.String()); msg != "" {
+			return fmt.Errorf("screen %s: %s", args[0], msg)
+		}
+		return fmt.Errorf("screen %s: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package mux
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Tmux records panes through pipe-pane.
+type Tmux struct {
+	Socket string // path of the server's socket; the server of $TMUX if empty
+}
+
+func (t *Tmux) Name() string { return "tmux" }
+
+func (t *Tmux) Pane(target string) (string, error) {
+	pane, err := t.display(target, "#{pane_id}")
+	if err == nil && pane == "" {
+		// display-message quietly prints nothing for a missing pane.
+		err = fmt.Errorf("can't find pane: %s", target)
+	}
+	return pane, err
+}
+
+func (t *Tmux) Pipe(pane, path string) error {
+	piped, err := t.display(pane, "#{pane_pipe}")
+	if err != nil {
+		return err
+	}
+	if piped == "1" {
+		return fmt.Errorf("pane %s is already piped to a program, see tmux pipe-pane", pane)
+	}
+	_, err = t.run("pipe-pane", "-t", pane, "exec cat > "+shellQuote(path))
+	return err
+}
+
+func (t *Tmux) Unpipe(pane string) error {
+	_, err := t.run("pipe-pane", "-t", pane)
+	return err
+}
+
+func (t *Tmux) Type(pane, line string) error {
+	if _, err := t.run("send-keys", "-t", pane, "-l", line); err != nil {
+		return err
+	}
+	_, err := t.run("send-keys", "-t", pane, "Enter")
+	return err
+}
+
+func (t *Tmux) Command(pane string) (string, error) {
+	return t.display(pane, "#{pane_current_command}")
+}
+
+func (t *Tmux) Size(pane string) (int, int, error) {
+	size, err := t.display(pane, "#{pane_width} #{pane_height}")
+	if err != nil {
+		return 0, 0, err
+	}
+	var cols, rows int
+	if _, err := fmt.Sscan(size, &cols, &rows); err != nil {
+		return 0, 0, fmt.Errorf("unexpected pane size %q", size)
+	}
+	return cols, rows, nil
+}
+
+func (t *Tmux) display(pane, format string) (string, error) {
+	return t.run("display-message", "-p", "-t", pane, format)
+}
+
+// run runs a tmux command and returns its output, without the final
+// newline.
+func (t *Tmux) run(args ...string) (string, error) {
+	if t.Socket != "" {
+		args = append([]string{"-S", t.Socket}, args...)
+	}
+	cmd := exec.Command("tmux", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("tmux %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("tmux %s: %w", args[0], err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
@@ -0,0 +1,55 @@
+package mux
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTmux starts a tmux server of its own running sh in an 80x24 pane.
+func startTmux(t *testing.T) *Tmux {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	tm := &Tmux{Socket: filepath.Join(t.TempDir(), "tmux")}
+	_, err := tm.run("-f", "/dev/null", "new-session", "-d", "-x", "80", "-y", "24", "sh")
+	require.NoError(t, err)
+	t.Cleanup(func() { _, _ = tm.run("kill-server") })
+	return tm
+}
+
+func TestTmux(t *testing.T) {
+	tm := startTmux(t)
+
+	pane, err := tm.Pane(":0.0")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(pane, "%"), pane)
+	_, err = tm.Pane("%99")
+	assert.Error(t, err)
+
+	cols, rows, err := tm.Size(pane)
+	require.NoError(t, err)
+	assert.Equal(t, 80, cols)
+	assert.Equal(t, 24, rows)
+
+	command, err := tm.Command(pane)
+	require.NoError(t, err)
+	assert.Equal(t, "sh", command)
+
+	out := filepath.Join(t.TempDir(), "out")
+	require.NoError(t, tm.Pipe(pane, out))
+	assert.Error(t, tm.Pipe(pane, out), "a pane is piped to one program at a time")
+	require.NoError(t, tm.Type(pane, "echo 'it''s piped'"))
+	assert.Eventually(t, func() bool {
+		data, _ := os.ReadFile(out)
+		return strings.Contains(string(data), "its piped\r\n")
+	}, 5*time.Second, 50*time.Millisecond)
+	require.NoError(t, tm.Unpipe(pane))
+	require.NoError(t, tm.Pipe(pane, out), "the pane can be piped again once unpiped")
+}
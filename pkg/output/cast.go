@@ -0,0 +1,73 @@
+package output
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/ohshell/cli/pkg/cast"
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/ohshell/cli/pkg/vt"
+)
+
+// castPause is the time given to a command whose timing was not recorded.
+const castPause = time.Second
+
+// ToCast writes the session as an asciicast v2 recording. Sessions keep
+// only the rendered output of each command, so the recording replays each
+// command line at the time it was run and its output when it finished,
+// rather than the original stream of bytes. Use record.WithCast to capture
+// the stream itself.
+func ToCast(w io.Writer, session *record.Session) error {
+	width := vt.DefaultCols
+	for _, cmd := range session.Commands {
+		for _, line := range strings.Split(cmd.Output, "\n") {
+			width = max(width, runewidth.StringWidth(line))
+		}
+	}
+	header := cast.Header{Width: width, Height: vt.DefaultRows}
+	if !session.StartTime.IsZero() {
+		header.Timestamp = session.StartTime.Unix()
+	}
+	cw, err := cast.NewWriter(w, header)
+	if err != nil {
+		return err
+	}
+
+	start := session.StartTime
+	var at time.Duration
+	for _, cmd := range session.Commands {
+		if strings.TrimSpace(strings.ToLower(cmd.Input)) == "exit" {
+			continue
+		}
+		// Keep events in order even if timestamps are missing or skewed.
+		if start.IsZero() && !cmd.Timestamp.IsZero() {
+			start = cmd.Timestamp.Add(-at)
+		}
+		if !cmd.Timestamp.IsZero() {
+			at = max(at, cmd.Timestamp.Sub(start))
+		}
+		_ = cw.WriteEvent(cast.Event{Time: at, Type: cast.EventMarker, Data: cmd.Input})
+		_ = cw.WriteEvent(cast.Event{Time: at, Type: cast.EventOutput, Data: "$ " + crlf(cmd.Input) + "\r\n"})
+
+		if cmd.Duration > 0 {
+			at += cmd.Duration
+		} else {
+			at += castPause
+		}
+		output := cmd.Output
+		if cmd.StyledOutput != "" {
+			output = cmd.StyledOutput
+		}
+		if output != "" {
+			_ = cw.WriteEvent(cast.Event{Time: at, Type: cast.EventOutput, Data: crlf(output) + "\r\n"})
+		}
+	}
+	return cw.Close()
+}
+
+// crlf converts line feeds to the CR LF a terminal expects.
+func crlf(s string) string {
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
@@ -0,0 +1,65 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ohshell/cli/pkg/cast"
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToCast(t *testing.T) {
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := &record.Session{
+		StartTime: start,
+		Commands: []record.Command{
+			{Timestamp: start.Add(2 * time.Second), Duration: 500 * time.Millisecond, Input: "ls", Output: "a\nb"},
+			{Timestamp: start.Add(5 * time.Second), Input: "true"},
+			{Input: "exit"},
+		},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, ToCast(&buf, session))
+
+	header, events, err := cast.Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, start.Unix(), header.Timestamp)
+	assert.Equal(t, 80, header.Width)
+	assert.Equal(t, []cast.Event{
+		{Time: 2 * time.Second, Type: cast.EventMarker, Data: "ls"},
+		{Time: 2 * time.Second, Type: cast.EventOutput, Data: "$ ls\r\n"},
+		{Time: 2500 * time.Millisecond, Type: cast.EventOutput, Data: "a\r\nb\r\n"},
+		{Time: 5 * time.Second, Type: cast.EventMarker, Data: "true"},
+		{Time: 5 * time.Second, Type: cast.EventOutput, Data: "$ true\r\n"},
+	}, events)
+}
+
+func TestFromJSON_RoundTrip(t *testing.T) {
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	code := 1
+	session := &record.Session{
+		StartTime: start,
+		EndTime:   start.Add(time.Minute),
+		Commands: []record.Command{
+			{
+				Timestamp: start, EndTime: start.Add(time.Second), Duration: time.Second,
+				Input: "vim x", Output: "out", ExitCode: &code, Cwd: "/srv",
+				Programs: []record.InteractiveProgram{{Name: "vim", StartTime: start, Duration: time.Second}},
+			},
+		},
+	}
+	data, err := ToJSON(session)
+	require.NoError(t, err)
+
+	parsed, err := FromJSON(data)
+	require.NoError(t, err)
+	assert.Equal(t, session.StartTime, parsed.StartTime)
+	assert.Equal(t, session.EndTime, parsed.EndTime)
+	assert.Equal(t, session.Commands, parsed.Commands)
+
+	_, err = FromJSON([]byte("not json"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,247 @@
+package output
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/ohshell/cli/pkg/record"
+)
+
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ohsh session</title>
+<style>
+body { font-family: sans-serif; max-width: 960px; margin: 2em auto; }
+pre { background: #1e1e1e; color: #d4d4d4; padding: 1em; overflow-x: auto; }
+</style>
+</head>
+<body>
+`
+
+// ToHTML generates a standalone HTML page for the session. Command output
+// keeps its colours when the session was recorded with record.WithColors.
+func ToHTML(session *record.Session) string {
+	var sb strings.Builder
+	sb.WriteString(htmlHead)
+	step := 1
+	for _, cmd := range session.Commands {
+		if strings.TrimSpace(strings.ToLower(cmd.Input)) == "exit" {
+			continue
+		}
+		heading := fmt.Sprintf("Step %d", step)
+		if cmd.Title != "" {
+			heading += ": " + cmd.Title
+		}
+		if cmd.Failed() {
+			heading += " ❌"
+		}
+		sb.WriteString("<h3>" + html.EscapeString(heading) + "</h3>\n")
+		if cmd.Note != "" {
+			sb.WriteString("<p>" + html.EscapeString(cmd.Note) + "</p>\n")
+		}
+		sb.WriteString("<pre><code>" + html.EscapeString(cmd.Input) + "</code></pre>\n")
+		if cmd.Comment != "" {
+			sb.WriteString("<p><strong>Description:</strong> " + html.EscapeString(cmd.Comment) + "</p>\n")
+		}
+		if cmd.Failed() {
+			sb.WriteString(fmt.Sprintf("<p><strong>Exit code:</strong> %d</p>\n", *cmd.ExitCode))
+		}
+		for _, p := range cmd.Programs {
+			sb.WriteString(fmt.Sprintf("<p><em>🖥️ Interactive program: %s (%s)</em></p>\n", html.EscapeString(p.Name), FormatDuration(p.Duration)))
+			if strings.TrimSpace(p.Snapshot) != "" {
+				sb.WriteString("<pre>" + html.EscapeString(p.Snapshot) + "</pre>\n")
+			}
+		}
+		output := html.EscapeString(cmd.Output)
+		if cmd.StyledOutput != "" {
+			output = ansiToHTML(cmd.StyledOutput)
+		}
+		if strings.TrimSpace(cmd.Output) != "" {
+			sb.WriteString("<pre>" + output + "</pre>\n")
+		}
+		step++
+	}
+	if session.ClosingNote != "" {
+		sb.WriteString("<p>" + html.EscapeString(session.ClosingNote) + "</p>\n")
+	}
+	sb.WriteString("</body>\n</html>\n")
+	return sb.String()
+}
+
+// ansiToHTML converts text with SGR escape sequences to HTML, wrapping
+// styled runs in spans with inline styles. Other escape sequences are
+// dropped.
+func ansiToHTML(s string) string {
+	var sb strings.Builder
+	var st sgrState
+	open := false
+	for len(s) > 0 {
+		i := strings.Index(s, "\x1b[")
+		if i < 0 {
+			sb.WriteString(html.EscapeString(s))
+			break
+		}
+		sb.WriteString(html.EscapeString(s[:i]))
+		s = s[i+2:]
+		end := strings.IndexFunc(s, func(r rune) bool { return r >= 0x40 && r <= 0x7e })
+		if end < 0 {
+			break
+		}
+		params, final := s[:end], s[end]
+		s = s[end+1:]
+		if final != 'm' {
+			continue
+		}
+		st.apply(params)
+		if open {
+			sb.WriteString("</span>")
+			open = false
+		}
+		if css := st.css(); css != "" {
+			sb.WriteString(`<span style="` + css + `">`)
+			open = true
+		}
+	}
+	if open {
+		sb.WriteString("</span>")
+	}
+	return sb.String()
+}
+
+// sgrState is the rendition set by SGR sequences. Colours are CSS values,
+// empty for the default.
+type sgrState struct {
+	fg, bg                               string
+	bold, dim, italic, underline, strike bool
+	reverse, hidden                      bool
+}
+
+func (st *sgrState) apply(params string) {
+	var args []int
+	for _, f := range strings.Split(params, ";") {
+		n, _ := strconv.Atoi(f)
+		args = append(args, n)
+	}
+	for i := 0; i < len(args); i++ {
+		switch n := args[i]; {
+		case n == 0:
+			*st = sgrState{}
+		case n == 1:
+			st.bold = true
+		case n == 2:
+			st.dim = true
+		case n == 3:
+			st.italic = true
+		case n == 4:
+			st.underline = true
+		case n == 7:
+			st.reverse = true
+		case n == 8:
+			st.hidden = true
+		case n == 9:
+			st.strike = true
+		case n >= 30 && n <= 37:
+			st.fg = paletteColor(n - 30)
+		case n >= 90 && n <= 97:
+			st.fg = paletteColor(n - 90 + 8)
+		case n >= 40 && n <= 47:
+			st.bg = paletteColor(n - 40)
+		case n >= 100 && n <= 107:
+			st.bg = paletteColor(n - 100 + 8)
+		case n == 38 || n == 48:
+			var c string
+			switch {
+			case i+2 < len(args) && args[i+1] == 5:
+				c = paletteColor(args[i+2])
+				i += 2
+			case i+4 < len(args) && args[i+1] == 2:
+				c = fmt.Sprintf("#%02x%02x%02x", args[i+2]&0xff, args[i+3]&0xff, args[i+4]&0xff)
+				i += 4
+			}
+			if n == 38 {
+				st.fg = c
+			} else {
+				st.bg = c
+			}
+		case n == 39:
+			st.fg = ""
+		case n == 49:
+			st.bg = ""
+		}
+	}
+}
+
+func (st sgrState) css() string {
+	var css []string
+	fg, bg := st.fg, st.bg
+	if st.reverse {
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = "#1e1e1e"
+		}
+		if bg == "" {
+			bg = "#d4d4d4"
+		}
+	}
+	if fg != "" {
+		css = append(css, "color:"+fg)
+	}
+	if bg != "" {
+		css = append(css, "background-color:"+bg)
+	}
+	if st.bold {
+		css = append(css, "font-weight:bold")
+	}
+	if st.dim {
+		css = append(css, "opacity:0.7")
+	}
+	if st.italic {
+		css = append(css, "font-style:italic")
+	}
+	if st.underline || st.strike {
+		var lines []string
+		if st.underline {
+			lines = append(lines, "underline")
+		}
+		if st.strike {
+			lines = append(lines, "line-through")
+		}
+		css = append(css, "text-decoration:"+strings.Join(lines, " "))
+	}
+	if st.hidden {
+		css = append(css, "visibility:hidden")
+	}
+	return strings.Join(css, ";")
+}
+
+// basicColors are the 16 ANSI colours as rendered by xterm.
+var basicColors = [16]string{
+	"#000000", "#cd0000", "#00cd00", "#cdcd00", "#0000ee", "#cd00cd", "#00cdcd", "#e5e5e5",
+	"#7f7f7f", "#ff0000", "#00ff00", "#ffff00", "#5c5cff", "#ff00ff", "#00ffff", "#ffffff",
+}
+
+// paletteColor returns the CSS colour for an xterm 256-colour index.
+func paletteColor(n int) string {
+	switch {
+	case n < 0 || n > 255:
+		return ""
+	case n < 16:
+		return basicColors[n]
+	case n < 232:
+		n -= 16
+		level := func(v int) int {
+			if v == 0 {
+				return 0
+			}
+			return 55 + v*40
+		}
+		return fmt.Sprintf("#%02x%02x%02x", level(n/36), level(n/6%6), level(n%6))
+	default:
+		v := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
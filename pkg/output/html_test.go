@@ -0,0 +1,35 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/ohshell/cli/pkg/record"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToHTML(t *testing.T) {
+	failed := 2
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "echo '<b>'", Output: "<b>"},
+			{Input: "make", Output: "ok", StyledOutput: "\x1b[0;1;32mok\x1b[0m", ExitCode: &failed},
+			{Input: "exit"},
+		},
+	}
+	html := ToHTML(session)
+	assert.Contains(t, html, "<h3>Step 1</h3>")
+	assert.Contains(t, html, "<pre><code>echo &#39;&lt;b&gt;&#39;</code></pre>")
+	assert.Contains(t, html, "<pre>&lt;b&gt;</pre>")
+	assert.Contains(t, html, "<h3>Step 2 ❌</h3>")
+	assert.Contains(t, html, "<p><strong>Exit code:</strong> 2</p>")
+	assert.Contains(t, html, `<pre><span style="color:#00cd00;font-weight:bold">ok</span></pre>`)
+	assert.NotContains(t, html, "Step 3")
+}
+
+func TestANSIToHTML(t *testing.T) {
+	assert.Equal(t, "plain", ansiToHTML("plain"))
+	assert.Equal(t, `<span style="color:#87ff00;background-color:#010203">x</span> y`,
+		ansiToHTML("\x1b[0;38;5;118;48;2;1;2;3mx\x1b[0m y"))
+	assert.Equal(t, `<span style="color:#1e1e1e;background-color:#d4d4d4">rev</span>`,
+		ansiToHTML("\x1b[0;7mrev\x1b[0m"))
+}
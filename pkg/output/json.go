@@ -11,15 +11,40 @@ import (
 type SessionJSON struct {
 	Commands      []CommandJSON `json:"commands"`
 	SlackThreadTS string        `json:"slack_thread_ts,omitempty"`
+	StartTime     time.Time     `json:"start_time,omitzero"`
+	EndTime       time.Time     `json:"end_time,omitzero"`
+	DurationMS    int64         `json:"duration_ms,omitempty"`
+	ClosingNote   string        `json:"closing_note,omitempty"`
 }
 
 // CommandJSON represents a command in JSON format
 type CommandJSON struct {
-	Timestamp time.Time `json:"timestamp"`
-	Input     string    `json:"input"`
-	Output    string    `json:"output"`
-	Comment   string    `json:"comment,omitempty"`
-	Redacted  bool      `json:"redacted"`
+	Timestamp     time.Time         `json:"timestamp"`
+	EndTime       time.Time         `json:"end_time,omitzero"`
+	DurationMS    int64             `json:"duration_ms,omitempty"`
+	Input         string            `json:"input"`
+	Output        string            `json:"output"`
+	StyledOutput  string            `json:"styled_output,omitempty"`
+	Comment       string            `json:"comment,omitempty"`
+	Title         string            `json:"title,omitempty"`
+	Note          string            `json:"note,omitempty"`
+	Redacted      bool              `json:"redacted"`
+	OutputOmitted int               `json:"output_omitted_bytes,omitempty"`
+	OutputFile    string            `json:"output_file,omitempty"`
+	ExitCode      *int              `json:"exit_code,omitempty"`
+	Cwd           string            `json:"cwd,omitempty"`
+	Host          string            `json:"host,omitempty"`
+	User          string            `json:"user,omitempty"`
+	Context       map[string]string `json:"context,omitempty"`
+	Programs      []ProgramJSON     `json:"interactive_programs,omitempty"`
+}
+
+// ProgramJSON represents a full-screen program run by a command
+type ProgramJSON struct {
+	Name       string    `json:"name"`
+	StartTime  time.Time `json:"start_time"`
+	DurationMS int64     `json:"duration_ms"`
+	Snapshot   string    `json:"snapshot,omitempty"`
 }
 
 // ToJSON generates a JSON representation of the session.
@@ -27,6 +52,10 @@ func ToJSON(session *record.Session) ([]byte, error) {
 	sessionJSON := SessionJSON{
 		Commands:      make([]CommandJSON, 0, len(session.Commands)),
 		SlackThreadTS: session.SlackThreadTS,
+		StartTime:     session.StartTime,
+		EndTime:       session.EndTime,
+		DurationMS:    session.Duration().Milliseconds(),
+		ClosingNote:   session.ClosingNote,
 	}
 
 	for _, cmd := range session.Commands {
@@ -34,14 +63,7 @@ func ToJSON(session *record.Session) ([]byte, error) {
 		if cmd.Input == "exit" {
 			continue
 		}
-
-		sessionJSON.Commands = append(sessionJSON.Commands, CommandJSON{
-			Timestamp: cmd.Timestamp,
-			Input:     cmd.Input,
-			Output:    cmd.Output,
-			Comment:   cmd.Comment,
-			Redacted:  cmd.Redacted,
-		})
+		sessionJSON.Commands = append(sessionJSON.Commands, NewCommandJSON(cmd))
 	}
 
 	return json.MarshalIndent(sessionJSON, "", "  ")
@@ -55,3 +77,88 @@ func ToJSONString(session *record.Session) (string, error) {
 	}
 	return string(jsonBytes), nil
 }
+
+// FromJSON parses a session written by ToJSON.
+func FromJSON(data []byte) (*record.Session, error) {
+	var sessionJSON SessionJSON
+	if err := json.Unmarshal(data, &sessionJSON); err != nil {
+		return nil, err
+	}
+	session := &record.Session{
+		Commands:      make([]record.Command, 0, len(sessionJSON.Commands)),
+		SlackThreadTS: sessionJSON.SlackThreadTS,
+		StartTime:     sessionJSON.StartTime,
+		EndTime:       sessionJSON.EndTime,
+		ClosingNote:   sessionJSON.ClosingNote,
+	}
+	for _, cmd := range sessionJSON.Commands {
+		session.Commands = append(session.Commands, cmd.Command())
+	}
+	return session, nil
+}
+
+// NewCommandJSON converts a recorded command to its JSON form.
+func NewCommandJSON(cmd record.Command) CommandJSON {
+	var programs []ProgramJSON
+	for _, p := range cmd.Programs {
+		programs = append(programs, ProgramJSON{
+			Name:       p.Name,
+			StartTime:  p.StartTime,
+			DurationMS: p.Duration.Milliseconds(),
+			Snapshot:   p.Snapshot,
+		})
+	}
+	return CommandJSON{
+		Timestamp:     cmd.Timestamp,
+		EndTime:       cmd.EndTime,
+		DurationMS:    cmd.Duration.Milliseconds(),
+		Input:         cmd.Input,
+		Output:        cmd.Output,
+		StyledOutput:  cmd.StyledOutput,
+		Comment:       cmd.Comment,
+		Title:         cmd.Title,
+		Note:          cmd.Note,
+		Redacted:      cmd.Redacted,
+		OutputOmitted: cmd.OutputOmitted,
+		OutputFile:    cmd.OutputFile,
+		ExitCode:      cmd.ExitCode,
+		Cwd:           cmd.Cwd,
+		Host:          cmd.Host,
+		User:          cmd.User,
+		Context:       cmd.Context,
+		Programs:      programs,
+	}
+}
+
+// Command converts the JSON form back to a command.
+func (cmd CommandJSON) Command() record.Command {
+	var programs []record.InteractiveProgram
+	for _, p := range cmd.Programs {
+		programs = append(programs, record.InteractiveProgram{
+			Name:      p.Name,
+			StartTime: p.StartTime,
+			Duration:  time.Duration(p.DurationMS) * time.Millisecond,
+			Snapshot:  p.Snapshot,
+		})
+	}
+	return record.Command{
+		Timestamp:     cmd.Timestamp,
+		EndTime:       cmd.EndTime,
+		Duration:      time.Duration(cmd.DurationMS) * time.Millisecond,
+		Input:         cmd.Input,
+		Output:        cmd.Output,
+		StyledOutput:  cmd.StyledOutput,
+		Comment:       cmd.Comment,
+		Title:         cmd.Title,
+		Note:          cmd.Note,
+		Redacted:      cmd.Redacted,
+		OutputOmitted: cmd.OutputOmitted,
+		OutputFile:    cmd.OutputFile,
+		ExitCode:      cmd.ExitCode,
+		Cwd:           cmd.Cwd,
+		Host:          cmd.Host,
+		User:          cmd.User,
+		Context:       cmd.Context,
+		Programs:      programs,
+	}
+}
@@ -183,3 +183,126 @@ func TestToJSON_FilterExitCommands(t *testing.T) {
 	assert.Equal(t, "ls", sessionJSON.Commands[0].Input)
 	assert.Equal(t, "pwd", sessionJSON.Commands[1].Input)
 }
+
+func TestToJSON_ExitCode(t *testing.T) {
+	failed := 2
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "grep foo missing.txt", ExitCode: &failed},
+			{Input: "echo typed"},
+		},
+	}
+
+	jsonBytes, err := ToJSON(session)
+	require.NoError(t, err)
+
+	var sessionJSON SessionJSON
+	require.NoError(t, json.Unmarshal(jsonBytes, &sessionJSON))
+	require.Len(t, sessionJSON.Commands, 2)
+	require.NotNil(t, sessionJSON.Commands[0].ExitCode)
+	assert.Equal(t, 2, *sessionJSON.Commands[0].ExitCode)
+	assert.Nil(t, sessionJSON.Commands[1].ExitCode)
+	assert.NotContains(t, string(jsonBytes), `"exit_code": null`, "unknown exit codes should be omitted")
+}
+
+func TestToJSON_Timing(t *testing.T) {
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := &record.Session{
+		StartTime: start,
+		EndTime:   start.Add(time.Minute),
+		Commands: []record.Command{
+			{Timestamp: start, EndTime: start.Add(1500 * time.Millisecond), Duration: 1500 * time.Millisecond, Input: "make"},
+			{Timestamp: start, Input: "echo typed"},
+		},
+	}
+
+	jsonBytes, err := ToJSON(session)
+	require.NoError(t, err)
+
+	var sessionJSON SessionJSON
+	require.NoError(t, json.Unmarshal(jsonBytes, &sessionJSON))
+	assert.Equal(t, start, sessionJSON.StartTime)
+	assert.Equal(t, int64(60000), sessionJSON.DurationMS)
+	assert.Equal(t, start.Add(1500*time.Millisecond), sessionJSON.Commands[0].EndTime)
+	assert.Equal(t, int64(1500), sessionJSON.Commands[0].DurationMS)
+	assert.True(t, sessionJSON.Commands[1].EndTime.IsZero())
+}
+
+func TestToJSON_CwdAndContext(t *testing.T) {
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "kubectl get pods", Cwd: "/srv/app", Context: map[string]string{"kube-context": "prod"}, Host: "bastion", User: "admin"},
+			{Input: "echo typed"},
+		},
+	}
+
+	jsonBytes, err := ToJSON(session)
+	require.NoError(t, err)
+
+	var sessionJSON SessionJSON
+	require.NoError(t, json.Unmarshal(jsonBytes, &sessionJSON))
+	assert.Equal(t, "/srv/app", sessionJSON.Commands[0].Cwd)
+	assert.Equal(t, map[string]string{"kube-context": "prod"}, sessionJSON.Commands[0].Context)
+	assert.Equal(t, "bastion", sessionJSON.Commands[0].Host)
+	assert.Equal(t, "admin", sessionJSON.Commands[0].User)
+	assert.Empty(t, sessionJSON.Commands[1].Cwd)
+	assert.Nil(t, sessionJSON.Commands[1].Context)
+}
+
+func TestToJSON_InteractivePrograms(t *testing.T) {
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "vim notes.txt", Programs: []record.InteractiveProgram{
+				{Name: "vim", StartTime: start, Duration: 192 * time.Second, Snapshot: "~"},
+			}},
+			{Input: "ls"},
+		},
+	}
+
+	jsonBytes, err := ToJSON(session)
+	require.NoError(t, err)
+
+	var sessionJSON SessionJSON
+	require.NoError(t, json.Unmarshal(jsonBytes, &sessionJSON))
+	assert.Equal(t, []ProgramJSON{{Name: "vim", StartTime: start, DurationMS: 192000, Snapshot: "~"}}, sessionJSON.Commands[0].Programs)
+	assert.Nil(t, sessionJSON.Commands[1].Programs)
+}
+
+func TestToJSON_Narrative(t *testing.T) {
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "kubectl drain node-1", Comment: "safe, PDBs checked", Title: "Drain the node", Note: "Traffic has moved."},
+		},
+		ClosingNote: "All done.",
+	}
+
+	jsonBytes, err := ToJSON(session)
+	require.NoError(t, err)
+
+	var sessionJSON SessionJSON
+	require.NoError(t, json.Unmarshal(jsonBytes, &sessionJSON))
+	assert.Equal(t, "safe, PDBs checked", sessionJSON.Commands[0].Comment)
+	assert.Equal(t, "Drain the node", sessionJSON.Commands[0].Title)
+	assert.Equal(t, "Traffic has moved.", sessionJSON.Commands[0].Note)
+	assert.Equal(t, "All done.", sessionJSON.ClosingNote)
+}
+
+func TestToJSON_OmittedOutput(t *testing.T) {
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "cat app.log", OutputOmitted: 4096, OutputFile: "/tmp/s.outputs/command-1.txt"},
+			{Input: "ls", Output: "file"},
+		},
+	}
+
+	jsonBytes, err := ToJSON(session)
+	require.NoError(t, err)
+
+	var sessionJSON SessionJSON
+	require.NoError(t, json.Unmarshal(jsonBytes, &sessionJSON))
+	assert.Equal(t, 4096, sessionJSON.Commands[0].OutputOmitted)
+	assert.Equal(t, "/tmp/s.outputs/command-1.txt", sessionJSON.Commands[0].OutputFile)
+	assert.Zero(t, sessionJSON.Commands[1].OutputOmitted)
+	assert.Equal(t, session.Commands[0], sessionJSON.Commands[0].Command())
+}
@@ -2,8 +2,11 @@ package output
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/ohshell/cli/pkg/capture"
 	"github.com/ohshell/cli/pkg/record"
 )
 
@@ -11,24 +14,136 @@ import (
 func ToMarkdown(session *record.Session) string {
 	var sb strings.Builder
 	step := 1
-	for _, cmd := range session.Commands {
+	var prev *record.Command
+	for i, cmd := range session.Commands {
 		trimmed := strings.TrimSpace(strings.ToLower(cmd.Input))
 		if trimmed == "exit" {
 			continue
 		}
-		sb.WriteString(fmt.Sprintf("### Step %d\n", step))
+		heading := fmt.Sprintf("### Step %d", step)
+		if cmd.Title != "" {
+			heading += ": " + cmd.Title
+		}
+		if cmd.Failed() {
+			heading += " ❌"
+		}
+		sb.WriteString(heading + "\n")
+		if cmd.Note != "" {
+			sb.WriteString(cmd.Note + "\n\n")
+		}
+		for _, note := range contextNotes(prev, cmd) {
+			sb.WriteString("*" + note + "*\n\n")
+		}
+		prev = &session.Commands[i]
 		sb.WriteString("**Command:**\n")
 		sb.WriteString("```sh\n")
 		sb.WriteString(cmd.Input)
 		sb.WriteString("\n```")
+		if cmd.Comment != "" {
+			sb.WriteString("\n**Description:** " + cmd.Comment)
+		}
+		if cmd.Failed() {
+			sb.WriteString(fmt.Sprintf("\n**Exit code:** %d", *cmd.ExitCode))
+		}
+		if !cmd.Timestamp.IsZero() && !cmd.EndTime.IsZero() {
+			sb.WriteString(fmt.Sprintf("\n**Time:** %s – %s (%s)",
+				cmd.Timestamp.Format("15:04:05"), cmd.EndTime.Format("15:04:05"), FormatDuration(cmd.Duration)))
+		}
+		for _, p := range cmd.Programs {
+			sb.WriteString(fmt.Sprintf("\n*🖥️ Interactive program: %s (%s)*", p.Name, FormatDuration(p.Duration)))
+			if strings.TrimSpace(p.Snapshot) != "" {
+				sb.WriteString("\n**Final screen:**\n```\n")
+				sb.WriteString(p.Snapshot)
+				sb.WriteString("\n```")
+			}
+		}
 		if strings.TrimSpace(cmd.Output) != "" {
 			sb.WriteString("\n**Output:**\n")
-			sb.WriteString("```")
-			sb.WriteString(cmd.Output)
+			sb.WriteString("```\n")
+			sb.WriteString(strings.TrimRight(cmd.Output, "\n"))
 			sb.WriteString("\n```")
+		} else if cmd.OutputOmitted > 0 {
+			sb.WriteString(fmt.Sprintf("\n*✂️ Output omitted (%s)*", capture.FormatSize(cmd.OutputOmitted)))
 		}
 		sb.WriteString("\n\n")
 		step++
 	}
+	if session.ClosingNote != "" {
+		sb.WriteString(session.ClosingNote + "\n")
+	}
 	return sb.String()
 }
+
+// contextNotes describes where cmd ran when that differs from the step
+// before it, so readers of the document don't lose track of ssh, cd and
+// context switches. The first step states its context in full.
+func contextNotes(prev *record.Command, cmd record.Command) []string {
+	var notes []string
+	switch machine := machineName(cmd); {
+	case machine == "":
+	case prev == nil:
+		notes = append(notes, fmt.Sprintf("🖥️ Machine: `%s`", machine))
+	case machineName(*prev) != machine:
+		notes = append(notes, fmt.Sprintf("🖥️ Machine changed to `%s`", machine))
+	}
+	switch {
+	case cmd.Cwd == "":
+	case prev == nil:
+		notes = append(notes, fmt.Sprintf("📂 Working directory: `%s`", cmd.Cwd))
+	case prev.Cwd != cmd.Cwd:
+		notes = append(notes, fmt.Sprintf("📂 Working directory changed to `%s`", cmd.Cwd))
+	}
+
+	var prevContext map[string]string
+	if prev != nil {
+		prevContext = prev.Context
+	}
+	keys := make([]string, 0, len(cmd.Context)+len(prevContext))
+	for k := range cmd.Context {
+		keys = append(keys, k)
+	}
+	for k := range prevContext {
+		if _, ok := cmd.Context[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		value, ok := cmd.Context[k]
+		switch {
+		case !ok:
+			notes = append(notes, fmt.Sprintf("🔀 `%s` unset", k))
+		case prev == nil:
+			notes = append(notes, fmt.Sprintf("🔀 `%s`: `%s`", k, value))
+		case prevContext[k] != value:
+			notes = append(notes, fmt.Sprintf("🔀 `%s` changed to `%s`", k, value))
+		}
+	}
+	return notes
+}
+
+// machineName names the machine and user cmd ran as, user@host, as far as
+// they are known.
+func machineName(cmd record.Command) string {
+	switch {
+	case cmd.Host == "":
+		return cmd.User
+	case cmd.User == "":
+		return cmd.Host
+	}
+	return cmd.User + "@" + cmd.Host
+}
+
+// FormatDuration renders a duration at a precision suited to its size:
+// milliseconds below a second, tenths of a second below a minute and whole
+// seconds above.
+func FormatDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return d.Round(time.Millisecond).String()
+	case d < time.Minute:
+		return d.Round(100 * time.Millisecond).String()
+	default:
+		return d.Round(time.Second).String()
+	}
+}
@@ -1,7 +1,9 @@
 package output
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/ohshell/cli/pkg/record"
 	"github.com/stretchr/testify/suite"
@@ -87,6 +89,132 @@ func (suite *MarkdownTestSuite) TestToMarkdown_EmptySession() {
 	suite.Equal("", md, "Empty session should return empty markdown")
 }
 
+// TestToMarkdown_FailedStep tests that failed steps are marked with their exit code
+func (suite *MarkdownTestSuite) TestToMarkdown_FailedStep() {
+	ok, failed := 0, 127
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "echo hi", Output: "hi\n", ExitCode: &ok},
+			{Input: "kubectl-typo get pods", ExitCode: &failed},
+		},
+	}
+	md := ToMarkdown(session)
+	suite.Contains(md, "### Step 1\n", "Successful step should not be marked")
+	suite.Contains(md, "### Step 2 ❌\n", "Failed step should be marked")
+	suite.Contains(md, "**Exit code:** 127")
+	suite.NotContains(md, "**Exit code:** 0")
+}
+
+// TestToMarkdown_Timing tests that start, end and duration are shown for finished steps
+func (suite *MarkdownTestSuite) TestToMarkdown_Timing() {
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "make build", Timestamp: start, EndTime: start.Add(83 * time.Second), Duration: 83 * time.Second},
+			{Input: "echo unfinished", Timestamp: start},
+		},
+	}
+	md := ToMarkdown(session)
+	suite.Contains(md, "**Time:** 12:00:00 – 12:01:23 (1m23s)")
+	suite.Equal(1, strings.Count(md, "**Time:**"), "Unfinished step should have no timing")
+}
+
+// TestFormatDuration tests duration rounding
+func (suite *MarkdownTestSuite) TestFormatDuration() {
+	suite.Equal("250ms", FormatDuration(250400*time.Microsecond))
+	suite.Equal("3.2s", FormatDuration(3240*time.Millisecond))
+	suite.Equal("3m12s", FormatDuration(192400*time.Millisecond))
+}
+
+// TestToMarkdown_ContextNotes tests that working directory and context changes are noted
+func (suite *MarkdownTestSuite) TestToMarkdown_ContextNotes() {
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "cd /srv/app", Cwd: "/home/me", Context: map[string]string{"kube-context": "staging"}},
+			{Input: "kubectl config use-context prod", Cwd: "/srv/app", Context: map[string]string{"kube-context": "staging"}},
+			{Input: "unset AWS_PROFILE", Cwd: "/srv/app", Context: map[string]string{"kube-context": "prod", "AWS_PROFILE": "ops"}},
+			{Input: "kubectl get pods", Cwd: "/srv/app", Context: map[string]string{"kube-context": "prod"}},
+		},
+	}
+	md := ToMarkdown(session)
+	steps := strings.Split(md, "### Step ")[1:]
+	suite.Require().Len(steps, 4)
+	suite.Contains(steps[0], "*📂 Working directory: `/home/me`*")
+	suite.Contains(steps[0], "*🔀 `kube-context`: `staging`*")
+	suite.Contains(steps[1], "*📂 Working directory changed to `/srv/app`*")
+	suite.NotContains(steps[1], "🔀")
+	suite.Contains(steps[2], "*🔀 `AWS_PROFILE` changed to `ops`*")
+	suite.Contains(steps[2], "*🔀 `kube-context` changed to `prod`*")
+	suite.NotContains(steps[2], "📂")
+	suite.Contains(steps[3], "*🔀 `AWS_PROFILE` unset*")
+}
+
+// TestToMarkdown_MachineNotes tests that the machine and user each step ran as are noted when they change
+func (suite *MarkdownTestSuite) TestToMarkdown_MachineNotes() {
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "ssh bastion", Host: "laptop", User: "me"},
+			{Input: "uptime", Host: "bastion", User: "admin"},
+			{Input: "df -h", Host: "bastion", User: "admin"},
+			{Input: "sudo -i", Host: "bastion"},
+		},
+	}
+	md := ToMarkdown(session)
+	steps := strings.Split(md, "### Step ")[1:]
+	suite.Require().Len(steps, 4)
+	suite.Contains(steps[0], "*🖥️ Machine: `me@laptop`*")
+	suite.Contains(steps[1], "*🖥️ Machine changed to `admin@bastion`*")
+	suite.NotContains(steps[2], "🖥️")
+	suite.Contains(steps[3], "*🖥️ Machine changed to `bastion`*")
+}
+
+// TestToMarkdown_OmittedOutput tests that output the capture policy left out is noted
+func (suite *MarkdownTestSuite) TestToMarkdown_OmittedOutput() {
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "cat app.log", OutputOmitted: 1536, OutputFile: "/tmp/s.outputs/command-1.txt"},
+		},
+	}
+	md := ToMarkdown(session)
+	suite.Contains(md, "cat app.log\n```\n*✂️ Output omitted (1.5 KB)*")
+	suite.NotContains(md, "command-1.txt", "the spill file stays on this machine")
+	suite.NotContains(md, "**Output:**")
+}
+
+// TestToMarkdown_InteractivePrograms tests that full-screen programs are summarized
+func (suite *MarkdownTestSuite) TestToMarkdown_InteractivePrograms() {
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "vim notes.txt", Programs: []record.InteractiveProgram{
+				{Name: "vim", Duration: 3*time.Minute + 12*time.Second},
+			}},
+			{Input: "less log", Programs: []record.InteractiveProgram{
+				{Name: "less", Duration: 5 * time.Second, Snapshot: "line 1\n(END)"},
+			}},
+		},
+	}
+	md := ToMarkdown(session)
+	suite.Contains(md, "*🖥️ Interactive program: vim (3m12s)*")
+	suite.Contains(md, "*🖥️ Interactive program: less (5s)*\n**Final screen:**\n```\nline 1\n(END)\n```")
+	suite.NotContains(md, "**Output:**")
+}
+
+// TestToMarkdown_Narrative tests that comments typed during the session become prose
+func (suite *MarkdownTestSuite) TestToMarkdown_Narrative() {
+	session := &record.Session{
+		Commands: []record.Command{
+			{Input: "kubectl drain node-1", Comment: "safe, PDBs checked", Title: "Drain the node", Note: "Traffic has moved to node-2."},
+			{Input: "kubectl get pods"},
+		},
+		ClosingNote: "All done.",
+	}
+	md := ToMarkdown(session)
+	suite.Contains(md, "### Step 1: Drain the node\nTraffic has moved to node-2.\n\n**Command:**")
+	suite.Contains(md, "kubectl drain node-1\n```\n**Description:** safe, PDBs checked")
+	suite.Contains(md, "### Step 2\n**Command:**")
+	suite.True(strings.HasSuffix(md, "All done.\n"))
+}
+
 // Example of a simple unit test without the suite
 func TestMarkdownBasicFunctionality(t *testing.T) {
 	// TODO: Replace with actual test implementation
@@ -0,0 +1,115 @@
+package record
+
+import (
+	"strings"
+	"time"
+)
+
+// narrative holds the comment lines typed at the prompt until the command
+// they introduce is recorded.
+type narrative struct {
+	title string
+	lines []string
+}
+
+// text joins the narrative into a single block, title first.
+func (n narrative) text() string {
+	lines := n.lines
+	if n.title != "" {
+		lines = append([]string{n.title}, lines...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// noteLine reports whether line is a comment on its own, typed to explain
+// the next step rather than to run anything. It returns the comment's text
+// and whether it is a title, which is written with two or more #s:
+//
+//	## Drain the node
+//	# PDBs were checked beforehand
+func noteLine(line string) (text string, title, ok bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "#") {
+		return "", false, false
+	}
+	text = strings.TrimLeft(line, "#")
+	return strings.TrimSpace(text), len(line)-len(text) >= 2, true
+}
+
+// splitComment splits a command line into the command and the text of its
+// trailing comment, if any. As in the shell, # only starts a comment at the
+// beginning of a word and outside quotes, so `echo $#` and `echo 'a # b'`
+// have none.
+func splitComment(line string) (command, comment string) {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\\':
+			i++
+		case quote == '"':
+			if c == '"' {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '#' && (i == 0 || strings.IndexByte(" \t;&|()<>", line[i-1]) >= 0):
+			return strings.TrimRight(line[:i], " \t"), strings.TrimSpace(strings.TrimLeft(line[i:], "#"))
+		}
+	}
+	return line, ""
+}
+
+// addNote keeps line as narrative for the next command if it is a comment
+// on its own, and reports whether it was.
+func (s *Session) addNote(line string) bool {
+	text, title, ok := noteLine(line)
+	switch {
+	case !ok || text == "":
+	case title:
+		s.mu.Lock()
+		s.narrative.title = text
+		s.mu.Unlock()
+	default:
+		s.annotate(text)
+	}
+	return ok
+}
+
+// annotate adds text to the narrative for the next command.
+func (s *Session) annotate(text string) {
+	s.mu.Lock()
+	s.narrative.lines = append(s.narrative.lines, text)
+	s.mu.Unlock()
+}
+
+// newCommand returns a command for the line the shell ran, with its
+// trailing comment as the description and the narrative typed before it.
+// s.mu must be held.
+func (s *Session) newCommand(line string) Command {
+	input, comment := splitComment(line)
+	cmd := Command{
+		Timestamp: time.Now(),
+		Input:     input,
+		Comment:   comment,
+		Title:     s.narrative.title,
+		Note:      strings.Join(s.narrative.lines, "\n"),
+	}
+	s.narrative = narrative{}
+	s.lastID++
+	cmd.id = s.lastID
+	return cmd
+}
+
+// closeNarrative keeps the comments typed after the last command as the
+// session's closing note.
+func (s *Session) closeNarrative() {
+	s.mu.Lock()
+	s.ClosingNote = s.narrative.text()
+	s.narrative = narrative{}
+	s.mu.Unlock()
+}
@@ -0,0 +1,44 @@
+package record
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitComment(t *testing.T) {
+	tests := []struct {
+		line, command, comment string
+	}{
+		{"kubectl drain x  # safe, PDBs checked", "kubectl drain x", "safe, PDBs checked"},
+		{"ls #", "ls", ""},
+		{"ls;# done", "ls;", "done"},
+		{"echo $#", "echo $#", ""},
+		{"echo ${#PATH}", "echo ${#PATH}", ""},
+		{"echo a#b", "echo a#b", ""},
+		{"echo 'a # b'", "echo 'a # b'", ""},
+		{`echo "it's # here" # there`, `echo "it's # here"`, "there"},
+		{`echo \# not a comment`, `echo \# not a comment`, ""},
+		{`echo "\"" # quoted`, `echo "\""`, "quoted"},
+	}
+	for _, tt := range tests {
+		command, comment := splitComment(tt.line)
+		assert.Equal(t, tt.command, command, tt.line)
+		assert.Equal(t, tt.comment, comment, tt.line)
+	}
+}
+
+func TestNoteLine(t *testing.T) {
+	text, title, ok := noteLine("# now we drain the node")
+	assert.Equal(t, "now we drain the node", text)
+	assert.False(t, title)
+	assert.True(t, ok)
+
+	text, title, ok = noteLine("## Drain the node")
+	assert.Equal(t, "Drain the node", text)
+	assert.True(t, title)
+	assert.True(t, ok)
+
+	_, _, ok = noteLine("ls # not a note")
+	assert.False(t, ok)
+}
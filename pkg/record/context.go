@@ -0,0 +1,151 @@
+package record
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Built-in context names that are derived from tool configuration rather
+// than read from a single environment variable.
+const (
+	ContextKube   = "kube-context"
+	ContextGcloud = "gcloud-project"
+)
+
+// DefaultContextVars is the context recorded with each command unless
+// WithContextVars is used.
+var DefaultContextVars = []string{ContextKube, "AWS_PROFILE", ContextGcloud}
+
+// WithContextVars sets the context recorded with each command. Names are
+// either environment variable names or one of the built-in ContextKube and
+// ContextGcloud probes.
+func WithContextVars(names ...string) SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.contextVars = names
+	}
+}
+
+// contextEnvVars returns the environment variables the prompt hook has to
+// report so that the context named in names can be resolved.
+func contextEnvVars(names []string) []string {
+	seen := map[string]bool{}
+	var vars []string
+	add := func(v ...string) {
+		for _, name := range v {
+			if !seen[name] {
+				seen[name] = true
+				vars = append(vars, name)
+			}
+		}
+	}
+	for _, name := range names {
+		switch name {
+		case ContextKube:
+			add("KUBECONFIG", "HOME")
+		case ContextGcloud:
+			add("CLOUDSDK_CORE_PROJECT", "CLOUDSDK_CONFIG", "CLOUDSDK_ACTIVE_CONFIG_NAME", "HOME")
+		default:
+			add(name)
+		}
+	}
+	return vars
+}
+
+// resolveContext computes the context for names from the environment the
+// shell reported. Empty values are left out.
+func resolveContext(names []string, env map[string]string) map[string]string {
+	ctx := map[string]string{}
+	for _, name := range names {
+		var value string
+		switch name {
+		case ContextKube:
+			value = kubeContext(env)
+		case ContextGcloud:
+			value = gcloudProject(env)
+		default:
+			value = env[name]
+		}
+		if value != "" {
+			ctx[name] = value
+		}
+	}
+	if len(ctx) == 0 {
+		return nil
+	}
+	return ctx
+}
+
+// kubeContext reads current-context from the kubeconfig files kubectl
+// would use: the first file in KUBECONFIG that sets it, or ~/.kube/config.
+func kubeContext(env map[string]string) string {
+	paths := filepath.SplitList(env["KUBECONFIG"])
+	if len(paths) == 0 && env["HOME"] != "" {
+		paths = []string{filepath.Join(env["HOME"], ".kube", "config")}
+	}
+	for _, path := range paths {
+		if value := readConfigValue(path, "", "current-context", ":"); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// gcloudProject returns the project of the active gcloud configuration.
+func gcloudProject(env map[string]string) string {
+	if project := env["CLOUDSDK_CORE_PROJECT"]; project != "" {
+		return project
+	}
+	dir := env["CLOUDSDK_CONFIG"]
+	if dir == "" {
+		if env["HOME"] == "" {
+			return ""
+		}
+		dir = filepath.Join(env["HOME"], ".config", "gcloud")
+	}
+	name := env["CLOUDSDK_ACTIVE_CONFIG_NAME"]
+	if name == "" {
+		if b, err := os.ReadFile(filepath.Join(dir, "active_config")); err == nil {
+			name = strings.TrimSpace(string(b))
+		}
+	}
+	if name == "" {
+		name = "default"
+	}
+	return readConfigValue(filepath.Join(dir, "configurations", "config_"+name), "core", "project", "=")
+}
+
+// readConfigValue does just enough parsing of a YAML or INI file to find a
+// top-level key (or a key in an INI section) without pulling in a parser.
+func readConfigValue(path, section, key, sep string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	current := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			current = strings.Trim(trimmed, "[]")
+			continue
+		}
+		if current != section {
+			continue
+		}
+		// YAML keys must not be indented to be top-level.
+		if sep == ":" && line != trimmed {
+			continue
+		}
+		k, v, ok := strings.Cut(trimmed, sep)
+		if !ok || strings.TrimSpace(k) != key {
+			continue
+		}
+		return strings.Trim(strings.TrimSpace(v), `"'`)
+	}
+	return ""
+}
@@ -0,0 +1,53 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextEnvVars(t *testing.T) {
+	vars := contextEnvVars([]string{ContextKube, "AWS_PROFILE", ContextGcloud})
+	assert.Equal(t, []string{"KUBECONFIG", "HOME", "AWS_PROFILE", "CLOUDSDK_CORE_PROJECT", "CLOUDSDK_CONFIG", "CLOUDSDK_ACTIVE_CONFIG_NAME"}, vars)
+}
+
+func TestResolveContext_Kube(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.yaml")
+	config := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(empty, []byte("apiVersion: v1\nclusters: []\n"), 0o600))
+	require.NoError(t, os.WriteFile(config, []byte("apiVersion: v1\ncontexts:\n- context:\n    current-context: nested\n  name: staging\ncurrent-context: \"prod-eu\"\n"), 0o600))
+
+	ctx := resolveContext([]string{ContextKube}, map[string]string{
+		"KUBECONFIG": empty + string(os.PathListSeparator) + config,
+	})
+	assert.Equal(t, map[string]string{ContextKube: "prod-eu"}, ctx)
+
+	home := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(home, ".kube"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(home, ".kube", "config"), []byte("current-context: minikube\n"), 0o600))
+	ctx = resolveContext([]string{ContextKube}, map[string]string{"HOME": home})
+	assert.Equal(t, map[string]string{ContextKube: "minikube"}, ctx)
+}
+
+func TestResolveContext_Gcloud(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "configurations"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "active_config"), []byte("work\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "configurations", "config_work"), []byte("[compute]\nproject = wrong\n\n[core]\naccount = me@example.com\nproject = billing-prod\n"), 0o600))
+
+	ctx := resolveContext([]string{ContextGcloud}, map[string]string{"CLOUDSDK_CONFIG": dir})
+	assert.Equal(t, map[string]string{ContextGcloud: "billing-prod"}, ctx)
+
+	ctx = resolveContext([]string{ContextGcloud}, map[string]string{"CLOUDSDK_CONFIG": dir, "CLOUDSDK_CORE_PROJECT": "override"})
+	assert.Equal(t, map[string]string{ContextGcloud: "override"}, ctx)
+}
+
+func TestResolveContext_EnvAndEmpty(t *testing.T) {
+	ctx := resolveContext([]string{"AWS_PROFILE", "VAULT_ADDR"}, map[string]string{"AWS_PROFILE": "ops", "VAULT_ADDR": ""})
+	assert.Equal(t, map[string]string{"AWS_PROFILE": "ops"}, ctx)
+	assert.Nil(t, resolveContext([]string{"VAULT_ADDR"}, map[string]string{}))
+}
@@ -0,0 +1,162 @@
+package record
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultEscapeKey is the key that starts a recording control, Ctrl+].
+// Like telnet's, it is rarely bound by shells or editors.
+const DefaultEscapeKey byte = 0x1d
+
+// WithEscapeKey sets the key that, followed by an action key, controls the
+// recording from inside the session:
+//
+//	p  pause or resume recording
+//	d  drop the last step
+//	a  add a note to the next step
+//	s  show recording status
+//	?  list the actions
+//
+// Pressing the key twice sends it to the shell. Zero disables it.
+func WithEscapeKey(key byte) SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.escapeKey = key
+	}
+}
+
+// KeyName describes a key for display, such as "Ctrl+]".
+func KeyName(key byte) string {
+	switch {
+	case key < 0x20:
+		return "Ctrl+" + string(rune(key+'@'))
+	case key == 0x7f:
+		return "Ctrl+?"
+	}
+	return string(rune(key))
+}
+
+// ParseKey parses a key written as a single character or in caret
+// notation, such as "^]" for Ctrl+].
+func ParseKey(s string) (byte, error) {
+	switch {
+	case len(s) == 1 && s[0] < utf8.RuneSelf:
+		return s[0], nil
+	case len(s) == 2 && s[0] == '^' && s[1] == '?':
+		return 0x7f, nil
+	case len(s) == 2 && s[0] == '^' && s[1] >= '@' && s[1] <= '_':
+		return s[1] - '@', nil
+	case len(s) == 2 && s[0] == '^' && s[1] >= 'a' && s[1] <= 'z':
+		return s[1] - 'a' + 1, nil
+	}
+	return 0, fmt.Errorf("invalid key %q: use a single character or ^X for Ctrl+X", s)
+}
+
+// escapes handles the escape key, the action keys that follow it and the
+// text of notes being typed, removing them from p. It returns the length of
+// what is left for the shell.
+func (s *StdinInterceptor) escapes(p []byte) int {
+	out := p[:0]
+	for _, b := range p {
+		switch {
+		case s.note != nil:
+			s.noteKey(b)
+		case s.escaped:
+			s.escaped = false
+			if b == s.escapeKey {
+				out = append(out, b)
+			} else {
+				s.action(b)
+			}
+		case b == s.escapeKey:
+			s.escaped = true
+		default:
+			out = append(out, b)
+		}
+	}
+	return len(out)
+}
+
+func (s *StdinInterceptor) action(b byte) {
+	switch b {
+	case 'p', 'P':
+		s.paused = !s.paused
+		s.lineBuf = nil
+		s.tracker.setPaused(s.paused)
+		if s.paused {
+			s.message("⏸️  Recording paused. Nothing is captured until you resume with %s p", KeyName(s.escapeKey))
+		} else {
+			s.message("⏺️  Recording resumed")
+		}
+	case 'd', 'D':
+		if cmd, ok := s.tracker.dropLast(); ok {
+			s.message("🗑️  Dropped step %d: %s", s.tracker.steps()+1, cmd.Input)
+		} else {
+			s.message("No step to drop")
+		}
+	case 'a', 'A':
+		s.note = []byte{}
+		s.prompt("📝 Note for the next step (Enter to add, Esc to cancel): ")
+	case 's', 'S':
+		state := "recording"
+		if s.paused {
+			state = "paused"
+		}
+		elapsed := ""
+		if !s.session.StartTime.IsZero() {
+			elapsed = fmt.Sprintf(", %s elapsed", time.Since(s.session.StartTime).Round(time.Second))
+		}
+		s.message("%s: %d steps captured%s", state, s.tracker.steps(), elapsed)
+	default:
+		s.message("%s then: p pause/resume, d drop last step, a add a note, s status, %[1]s send %[1]s", KeyName(s.escapeKey))
+	}
+}
+
+// noteKey handles a key typed while writing a note, echoing it since the
+// shell never sees it.
+func (s *StdinInterceptor) noteKey(b byte) {
+	switch b {
+	case '\r', '\n':
+		text := strings.TrimSpace(string(s.note))
+		s.note = nil
+		if text == "" {
+			s.message("Note discarded")
+			return
+		}
+		text, _ = s.cfg.redact(text)
+		s.session.annotate(text)
+		s.message("Note added")
+	case 0x1b, 0x03: // Esc, Ctrl+C
+		s.note = nil
+		s.message("Note discarded")
+	case 0x7f, 0x08:
+		if len(s.note) > 0 {
+			_, size := utf8.DecodeLastRune(s.note)
+			s.note = s.note[:len(s.note)-size]
+			s.echo("\b \b")
+		}
+	default:
+		if b >= 0x20 {
+			s.note = append(s.note, b)
+			s.echo(string(b))
+		}
+	}
+}
+
+// message shows a line from ohsh on the user's terminal.
+func (s *StdinInterceptor) message(format string, args ...any) {
+	s.echo("\r\n[ohsh] " + fmt.Sprintf(format, args...) + "\r\n")
+}
+
+func (s *StdinInterceptor) prompt(text string) {
+	s.echo("\r\n[ohsh] " + text)
+}
+
+func (s *StdinInterceptor) echo(text string) {
+	if s.notify != nil {
+		_, _ = io.WriteString(s.notify, text)
+	}
+}
@@ -0,0 +1,134 @@
+package record
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// escapeInterceptor returns an interceptor for keystroke-detected commands
+// with the default escape key, and a function that types into it and
+// returns what reached the shell.
+func escapeInterceptor(t *testing.T) (*StdinInterceptor, *bytes.Buffer, func(string) string) {
+	session := &Session{}
+	reader := &bytes.Buffer{}
+	notify := &bytes.Buffer{}
+	interceptor := &StdinInterceptor{
+		reader:    reader,
+		session:   session,
+		cmdCh:     make(chan string, 10),
+		closed:    make(chan struct{}),
+		tracker:   newTracker(session, nil),
+		escapeKey: DefaultEscapeKey,
+		notify:    notify,
+	}
+	typ := func(input string) string {
+		reader.WriteString(input)
+		buf := make([]byte, len(input))
+		n, err := interceptor.Read(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+	return interceptor, notify, typ
+}
+
+func TestStdinInterceptor_PauseAndResume(t *testing.T) {
+	interceptor, notify, typ := escapeInterceptor(t)
+
+	assert.Equal(t, "ls\r", typ("ls\r"))
+	assert.Equal(t, "", typ("\x1dp"))
+	assert.Contains(t, notify.String(), "Recording paused")
+	assert.True(t, interceptor.tracker.paused.Load())
+
+	// Still reaches the shell, but is not recorded.
+	assert.Equal(t, "cat ~/.secret\r# private\r", typ("cat ~/.secret\r# private\r"))
+	assert.Equal(t, "", typ("\x1dp"))
+	assert.Contains(t, notify.String(), "Recording resumed")
+	typ("pwd\r")
+
+	require.Len(t, interceptor.session.Commands, 2)
+	assert.Equal(t, "ls", interceptor.session.Commands[0].Input)
+	assert.Equal(t, "pwd", interceptor.session.Commands[1].Input)
+	assert.Empty(t, interceptor.session.Commands[1].Note)
+}
+
+func TestStdinInterceptor_EscapeKeyTwiceReachesShell(t *testing.T) {
+	_, notify, typ := escapeInterceptor(t)
+	assert.Equal(t, "a\x1db", typ("a\x1d\x1db"))
+	assert.Empty(t, notify.String())
+
+	// The action key may arrive in a later read.
+	assert.Equal(t, "", typ("\x1d"))
+	assert.Equal(t, "", typ("?"))
+	assert.Contains(t, notify.String(), "Ctrl+] then: p pause/resume")
+}
+
+func TestStdinInterceptor_DropLastStep(t *testing.T) {
+	interceptor, notify, typ := escapeInterceptor(t)
+	tr := interceptor.tracker
+	typ("ls\r")
+	tr.beginTyped()
+	typ("cat secret.txt\r")
+	tr.beginTyped()
+	tr.write([]byte("cat secret.txt\r\nhunter2\r\n"))
+
+	typ("\x1dd")
+	assert.Contains(t, notify.String(), "Dropped step 2: cat secret.txt")
+	typ("\x1ds")
+	assert.Contains(t, notify.String(), "recording: 1 steps captured")
+
+	// Applied by the output side, which stops attributing to it.
+	tr.write([]byte("more\r\n"))
+	tr.finish()
+	require.Len(t, interceptor.session.Commands, 1)
+	assert.Equal(t, "ls", interceptor.session.Commands[0].Input)
+
+	typ("\x1dd\x1dd")
+	assert.Contains(t, notify.String(), "No step to drop")
+	tr.applyDrops()
+	assert.Empty(t, interceptor.session.Commands)
+}
+
+func TestStdinInterceptor_AddNote(t *testing.T) {
+	interceptor, notify, typ := escapeInterceptor(t)
+	assert.Equal(t, "", typ("\x1daroll back at 5pmx\x7f\r"))
+	assert.Contains(t, notify.String(), "Note for the next step")
+	assert.Contains(t, notify.String(), "roll back at 5pmx\b \b")
+	assert.Equal(t, "", typ("\x1daignored\x1b"))
+	assert.Contains(t, notify.String(), "Note discarded")
+	typ("kubectl rollout status deploy/web\r")
+
+	require.Len(t, interceptor.session.Commands, 1)
+	assert.Equal(t, "roll back at 5pm", interceptor.session.Commands[0].Note)
+}
+
+func TestTracker_IgnoresCommandsWhilePaused(t *testing.T) {
+	session := &Session{}
+	tr := newTracker(session, nil)
+	tr.write([]byte("\x1b]133;A\x07"))
+	tr.write([]byte("\x1b]633;E;tail -f log\x07\x1b]133;C\x07line 1\r\n"))
+	tr.setPaused(true)
+	tr.write([]byte("line 2\r\n\x1b]133;D;130\x07\x1b]133;A\x07"))
+	tr.write([]byte("\x1b]633;E;cat secret\x07\x1b]133;C\x07hunter2\r\n\x1b]133;D;0\x07\x1b]133;A\x07"))
+	tr.setPaused(false)
+	tr.write([]byte("\x1b]633;E;ls\x07\x1b]133;C\x07file\r\n\x1b]133;D;0\x07"))
+
+	require.Len(t, session.Commands, 2)
+	assert.Equal(t, "tail -f log", session.Commands[0].Input)
+	assert.Equal(t, "line 1", session.Commands[0].Output)
+	assert.Equal(t, "ls", session.Commands[1].Input)
+}
+
+func TestParseKey(t *testing.T) {
+	for s, want := range map[string]byte{"^]": 0x1d, "^a": 0x01, "^A": 0x01, "~": '~', "^?": 0x7f} {
+		key, err := ParseKey(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, key, s)
+	}
+	_, err := ParseKey("ctrl-x")
+	assert.Error(t, err)
+	assert.Equal(t, "Ctrl+]", KeyName(0x1d))
+	assert.Equal(t, "~", KeyName('~'))
+}
@@ -0,0 +1,138 @@
+package record
+
+import (
+	"sync"
+	"time"
+)
+
+// EventKind tells what happened in a session.
+type EventKind int
+
+const (
+	SessionStarted   EventKind = iota + 1 // the shell started; Session is set
+	CommandStarted                        // a command started; Command is set
+	OutputChunk                           // the running command printed Output
+	CommandFinished                       // a command finished, with Command.ExitCode if known
+	CommandUpdated                        // a finished command changed, e.g. its exit status came later
+	CommandDropped                        // the command with ID was dropped from the session
+	RecordingPaused                       // nothing is recorded until RecordingResumed
+	RecordingResumed                      // recording goes on after RecordingPaused
+	SessionEnded                          // nothing more will be recorded; Session is set
+)
+
+var eventKindNames = map[EventKind]string{
+	SessionStarted:   "session_started",
+	CommandStarted:   "command_started",
+	OutputChunk:      "output_chunk",
+	CommandFinished:  "command_finished",
+	CommandUpdated:   "command_updated",
+	CommandDropped:   "command_dropped",
+	RecordingPaused:  "recording_paused",
+	RecordingResumed: "recording_resumed",
+	SessionEnded:     "session_ended",
+}
+
+func (k EventKind) String() string {
+	if name, ok := eventKindNames[k]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// MarshalText names the kind in JSON and other text encodings.
+func (k EventKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Event is something that happened in a session while it was recorded.
+// Which fields are set depends on the kind.
+type Event struct {
+	Kind EventKind
+	Time time.Time
+
+	// ID identifies the command of a command or output event. It stays
+	// the same while steps before the command are dropped.
+	ID int
+	// Command is a copy of the command as it was when the event happened.
+	Command Command
+	// Typed is set on command events for commands told apart by the keys
+	// typed at the prompt, in shells without the integration.
+	Typed bool
+	// Output is a chunk of the running command's output as the shell
+	// printed it, escape sequences included, and redacted. Chunks end at
+	// the end of a line unless the command ends first or the line is long.
+	Output []byte
+	// Session is the session that started or ended. It keeps changing
+	// until it has ended.
+	Session *Session
+}
+
+// Audited reports whether audit logs record the event. A command is
+// logged as it starts, so it is on record even if the session never ends,
+// and again with its status when it finishes, changes or is dropped.
+func (e Event) Audited() bool {
+	switch e.Kind {
+	case CommandStarted, CommandFinished, CommandUpdated, CommandDropped:
+		return true
+	}
+	return false
+}
+
+// Subscriber is told about the events of a session as they happen. Events
+// are passed one at a time, in order, from the goroutines doing the
+// recording, which wait for HandleEvent to return: subscribers that do
+// slow work, such as sending events over the network, must hand it off.
+type Subscriber interface {
+	HandleEvent(e Event)
+}
+
+// SubscriberFunc lets an ordinary function be a Subscriber.
+type SubscriberFunc func(e Event)
+
+func (f SubscriberFunc) HandleEvent(e Event) {
+	f(e)
+}
+
+// WithSubscriber passes the session's events to s. Subscribers are called
+// in the order they were added.
+func WithSubscriber(s Subscriber) SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.bus.subscribers = append(cfg.bus.subscribers, s)
+	}
+}
+
+// eventBus passes events to the session's subscribers one at a time.
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers []Subscriber
+}
+
+// publish passes e to the subscribers, if any, stamping it with the
+// current time.
+func (cfg *sessionConfig) publish(e Event) {
+	if !cfg.subscribed() {
+		return
+	}
+	e.Time = time.Now()
+	cfg.bus.mu.Lock()
+	defer cfg.bus.mu.Unlock()
+	for _, s := range cfg.bus.subscribers {
+		s.HandleEvent(e)
+	}
+}
+
+// subscribed reports whether anyone is listening for events, so work done
+// only to publish them can be skipped.
+func (cfg *sessionConfig) subscribed() bool {
+	return cfg != nil && len(cfg.bus.subscribers) > 0
+}
+
+// publishCommand publishes an event about cmd.
+func (cfg *sessionConfig) publishCommand(kind EventKind, cmd Command, typed bool) {
+	cfg.publish(Event{Kind: kind, ID: cmd.id, Command: cmd, Typed: typed})
+}
+
+// start opens a session once its shell has started.
+func (cfg *sessionConfig) start(session *Session) {
+	cfg.publish(Event{Kind: SessionStarted, Session: session})
+}
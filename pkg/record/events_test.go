@@ -0,0 +1,119 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ohshell/cli/pkg/redact"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventLog records the events of a session as short strings.
+type eventLog struct {
+	events []string
+}
+
+func (l *eventLog) HandleEvent(e Event) {
+	s := e.Kind.String()
+	switch e.Kind {
+	case CommandStarted, CommandFinished, CommandUpdated, CommandDropped:
+		s += fmt.Sprintf(" %d %s", e.ID, e.Command.Input)
+		if e.Command.ExitCode != nil {
+			s += fmt.Sprintf(" (%d)", *e.Command.ExitCode)
+		}
+		if e.Typed {
+			s += " typed"
+		}
+	case OutputChunk:
+		s += fmt.Sprintf(" %d %q", e.ID, e.Output)
+	case SessionStarted, SessionEnded:
+		s += fmt.Sprintf(" %d commands", len(e.Session.Commands))
+	}
+	if e.Time.IsZero() {
+		s += " without time"
+	}
+	l.events = append(l.events, s)
+}
+
+func TestRecordStream_PublishesEvents(t *testing.T) {
+	stream := strings.NewReader("\x1b]133;A\x07$ " +
+		"\x1b]633;E;echo hi\x07\x1b]133;C\x07hi\r\n\x1b]133;D;0\x07\x1b]133;A\x07$ " +
+		"\x1b]633;E;false\x07\x1b]133;C\x07\x1b]133;D;1\x07\x1b]133;A\x07$ ")
+	var log eventLog
+	var called []string
+	RecordStream(stream, WithSubscriber(&log), WithSubscriber(SubscriberFunc(func(e Event) {
+		called = append(called, e.Kind.String())
+	})))
+
+	assert.Equal(t, []string{
+		"session_started 0 commands",
+		"command_started 1 echo hi",
+		`output_chunk 1 "hi\r\n"`,
+		"command_finished 1 echo hi (0)",
+		"command_started 2 false",
+		"command_finished 2 false (1)",
+		"session_ended 2 commands",
+	}, log.events)
+	assert.Len(t, called, len(log.events), "every subscriber gets every event")
+}
+
+func TestTracker_PublishesDropsAndPauses(t *testing.T) {
+	var log eventLog
+	session := &Session{}
+	cfg := &sessionConfig{}
+	WithSubscriber(&log)(cfg)
+	tr := newTracker(session, cfg)
+	interceptor := &StdinInterceptor{
+		reader:  strings.NewReader("ls\rrm -rf build\r"),
+		session: session,
+		cmdCh:   make(chan string, 2),
+		cfg:     cfg,
+		tracker: tr,
+	}
+	_, _ = io.ReadAll(interceptor)
+	tr.beginTyped()
+	tr.dropLast()
+	tr.setPaused(true)
+	tr.setPaused(true)
+	tr.setPaused(false)
+	tr.write([]byte("building\r\n"))
+	tr.finish()
+
+	assert.Equal(t, []string{
+		"command_started 1 ls typed",
+		"command_started 2 rm -rf build typed",
+		"recording_paused",
+		"recording_resumed",
+		"command_dropped 2 rm -rf build typed",
+	}, log.events, "the dropped command was running, so its output is not published")
+	require.Len(t, session.Commands, 1)
+}
+
+func TestTracker_PublishesRedactedOutput(t *testing.T) {
+	var log eventLog
+	cfg := &sessionConfig{redactor: redact.New(redact.DefaultRules()...)}
+	WithSubscriber(&log)(cfg)
+	tr := newTracker(&Session{}, cfg)
+	tr.write([]byte("\x1b]133;A\x07$ \x1b]633;E;env\x07\x1b]133;C\x07HOME=/root\r\nAWS_ACCESS_KEY_ID=AKIAIOSF"))
+	tr.write([]byte("ODNN7EXAMPLE\r\nPATH=/bin\r\nTERM=xt"))
+	tr.write([]byte("erm\x1b]133;D;0\x07"))
+
+	assert.Equal(t, []string{
+		"command_started 1 env",
+		`output_chunk 1 "HOME=/root\r\n"`,
+		`output_chunk 1 "AWS_ACCESS_KEY_ID=<redacted-aws-access-key-1>\r\nPATH=/bin\r\n"`,
+		`output_chunk 1 "TERM=xterm"`,
+		"command_finished 1 env (0)",
+	}, log.events, "a line is held back until it ends, so a secret is redacted whole")
+}
+
+func TestEventKind_JSON(t *testing.T) {
+	b, err := json.Marshal(Event{Kind: CommandFinished})
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"Kind":"command_finished"`)
+	assert.Equal(t, "unknown", EventKind(0).String())
+}
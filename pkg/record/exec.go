@@ -0,0 +1,207 @@
+package record
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed integration/ohsh-exec.bash
+var execIntegration string
+
+// ExecScript runs a bash script with args and records each of its
+// top-level commands with its output and exit status, for scripts run
+// where there is no terminal or no one to drive it, such as CI jobs. The
+// script's output is copied to stdout as it runs, without a terminal, so
+// programs behave as they do in a pipeline.
+//
+// Options apply as for StartSession, except those that only make sense
+// interactively, WithEscapeKey and WithCast, and WithCommand: the script
+// always runs under bash. Comments in the script narrate it as they do
+// when typed at the prompt.
+func ExecScript(script string, args []string, opts ...SessionOption) (*Session, error) {
+	return execScript(os.Stdout, script, args, opts...)
+}
+
+func execScript(out io.Writer, script string, args []string, opts ...SessionOption) (*Session, error) {
+	cfg := &sessionConfig{contextVars: DefaultContextVars}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	src, err := os.ReadFile(script)
+	if err != nil {
+		return nil, err
+	}
+	if interp := interpreter(string(src)); interp != "" && interp != "bash" && interp != "sh" {
+		return nil, fmt.Errorf("%s is a %s script: only bash and sh scripts can be recorded", script, interp)
+	}
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return nil, fmt.Errorf("bash is needed to record scripts: %w", err)
+	}
+
+	dir, err := os.MkdirTemp("", "ohsh-exec-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	prelude := filepath.Join(dir, "ohsh-exec.bash")
+	traced := filepath.Join(dir, "script.bash")
+	if err = os.WriteFile(prelude, []byte(execIntegration), 0o600); err == nil {
+		err = os.WriteFile(traced, []byte(traceScript(prelude, splitScript(bash, string(src)))), 0o600)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write traced script: %w", err)
+	}
+
+	// The script is sourced so that $0 and the arguments are its own.
+	cmd := exec.Command(bash, append([]string{"-c", ". " + shellQuote(traced), script}, args...)...)
+	cmd.Env = append(os.Environ(), cfg.env...)
+	if vars := contextEnvVars(cfg.contextVars); len(vars) > 0 {
+		cmd.Env = append(cmd.Env, "OHSH_CONTEXT_VARS="+strings.Join(vars, " "))
+	}
+	cmd.Dir = cfg.dir
+	cmd.Stdin = os.Stdin
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	cmd.Stdout, cmd.Stderr = w, w
+
+	logrus.Debugf("Tracing script: %s %v", script, args)
+	session := &Session{StartTime: time.Now(), SlackThreadTS: cfg.slackThreadTS}
+	if err := cmd.Start(); err != nil {
+		_ = w.Close()
+		return nil, fmt.Errorf("failed to start bash: %w", err)
+	}
+	_ = w.Close()
+	cfg.start(session)
+
+	tracker := newTracker(session, cfg)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		buf := make([]byte, outputChunkSize)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				// There is no terminal to turn newlines into CRLF, which
+				// the screen rendering the output expects.
+				clean := tracker.write(bytes.ReplaceAll(buf[:n], []byte("\n"), []byte("\r\n")))
+				_, _ = out.Write(bytes.ReplaceAll(clean, []byte("\r\n"), []byte("\n")))
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	exited := make(chan struct{})
+	stop := forwardSignals(cmd.Process, exited)
+	err = cmd.Wait()
+	close(exited)
+	stop()
+	wg.Wait()
+	tracker.finish()
+	session.ExitCode = exitStatus(err)
+	if n := len(session.Commands); n > 0 && session.Commands[n-1].ExitCode == nil {
+		// The script exited in the middle of its last command without
+		// reporting it, e.g. from a trap of its own.
+		last := &session.Commands[n-1]
+		last.ExitCode = &session.ExitCode
+		cfg.publishCommand(CommandUpdated, *last, false)
+	}
+	cfg.end(session)
+	return session, nil
+}
+
+// interpreter returns the name of the program a script's #! line runs it
+// with, or "" if it has none.
+func interpreter(src string) string {
+	line, _, _ := strings.Cut(src, "\n")
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if !strings.HasPrefix(line, "#!") || len(fields) == 0 {
+		return ""
+	}
+	name := filepath.Base(fields[0])
+	if name == "env" {
+		for _, f := range fields[1:] {
+			if !strings.HasPrefix(f, "-") {
+				return filepath.Base(f)
+			}
+		}
+	}
+	return name
+}
+
+// splitScript splits a script into its top-level commands, each with the
+// comments and blank lines before it. A command ends at the first line
+// where bash can parse everything so far.
+func splitScript(bash, src string) []string {
+	var chunks []string
+	var pending strings.Builder
+	for i, line := range strings.SplitAfter(src, "\n") {
+		if i == 0 && strings.HasPrefix(line, "#!") {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if pending.Len() == 0 && trimmed == "" {
+			continue
+		}
+		pending.WriteString(line)
+		if pending.Len() == len(line) && strings.HasPrefix(trimmed, "#") || parses(bash, pending.String()) {
+			chunks = append(chunks, strings.TrimRight(pending.String(), "\n"))
+			pending.Reset()
+		}
+	}
+	if pending.Len() > 0 {
+		// Not valid bash: left for bash to report when it gets there.
+		chunks = append(chunks, strings.TrimRight(pending.String(), "\n"))
+	}
+	return chunks
+}
+
+// parses reports whether bash can parse src as a complete command list.
+func parses(bash, src string) bool {
+	if strings.HasSuffix(strings.TrimRight(src, "\n"), `\`) {
+		return false
+	}
+	cmd := exec.Command(bash, "-n")
+	cmd.Stdin = strings.NewReader(src)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// An unterminated here-document is only a warning.
+	return cmd.Run() == nil && !bytes.Contains(stderr.Bytes(), []byte("here-document"))
+}
+
+// traceScript returns a script that runs the commands with marks around
+// each of them.
+func traceScript(prelude string, commands []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, ". %s\n", shellQuote(prelude))
+	for _, c := range commands {
+		// The hooks are called in && lists, where set -e leaves them be,
+		// with their xtrace output discarded.
+		fmt.Fprintf(&sb, "{ __ohsh_begin %s && :; } 2>/dev/null\n", shellQuote(escapeMarkValue(c)))
+		sb.WriteString(c)
+		sb.WriteString("\n{ __ohsh_end && :; } 2>/dev/null\n")
+	}
+	return sb.String()
+}
+
+// shellQuote quotes s as a single word for the shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
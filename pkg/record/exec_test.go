@@ -0,0 +1,97 @@
+package record
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requireBash(t *testing.T) string {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not installed")
+	}
+	return bash
+}
+
+func TestSplitScript(t *testing.T) {
+	bash := requireBash(t)
+	src := `#!/bin/bash
+set -e
+
+# Look around
+ls -la  # everything
+for f in *; do
+  echo "$f"
+done
+cat <<EOF
+a
+EOF
+make build &&
+  make test
+echo one; echo two
+`
+	assert.Equal(t, []string{
+		"set -e",
+		"# Look around",
+		"ls -la  # everything",
+		"for f in *; do\n  echo \"$f\"\ndone",
+		"cat <<EOF\na\nEOF",
+		"make build &&\n  make test",
+		"echo one; echo two",
+	}, splitScript(bash, src))
+
+	assert.Equal(t, []string{"if true; then"}, splitScript(bash, "if true; then\n"), "a command bash cannot parse is kept for bash to report")
+}
+
+func TestInterpreter(t *testing.T) {
+	assert.Equal(t, "bash", interpreter("#!/bin/bash -e\necho"))
+	assert.Equal(t, "python3", interpreter("#!/usr/bin/env -S python3 -u\n"))
+	assert.Equal(t, "", interpreter("echo hi\n"))
+}
+
+func TestExecScript(t *testing.T) {
+	requireBash(t)
+	dir := t.TempDir()
+	script := filepath.Join(dir, "job.sh")
+	require.NoError(t, os.WriteFile(script, []byte(`#!/usr/bin/env bash
+set -euo pipefail
+## Greet
+echo "hello $1"
+false || echo "status $?"
+printf 'step 1\rstep 2\n'
+cd /
+exit 4
+`), 0o755))
+
+	session, err := execScript(io.Discard, script, []string{"ci"}, WithDir(dir))
+	require.NoError(t, err)
+	assert.Equal(t, 4, session.ExitCode)
+	require.Len(t, session.Commands, 6)
+
+	greet := session.Commands[1]
+	assert.Equal(t, `echo "hello $1"`, greet.Input)
+	assert.Equal(t, "Greet", greet.Title)
+	assert.Equal(t, "hello ci", greet.Output)
+	assert.Equal(t, dir, greet.Cwd)
+	assert.Equal(t, "status 1", session.Commands[2].Output)
+	assert.Equal(t, "step 2", session.Commands[3].Output)
+	last := session.Commands[5]
+	assert.Equal(t, "exit 4", last.Input)
+	assert.Equal(t, "/", last.Cwd)
+	if assert.NotNil(t, last.ExitCode) {
+		assert.Equal(t, 4, *last.ExitCode)
+	}
+}
+
+func TestExecScript_NotBash(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "job.py")
+	require.NoError(t, os.WriteFile(script, []byte("#!/usr/bin/env python3\nprint(1)\n"), 0o755))
+	_, err := execScript(io.Discard, script, nil)
+	assert.ErrorContains(t, err, "python3 script")
+}
@@ -0,0 +1,153 @@
+package record
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	//go:embed integration/ohsh.bash
+	bashIntegration string
+	//go:embed integration/ohsh.zsh
+	zshIntegration string
+	//go:embed integration/ohsh.zshenv
+	zshEnvIntegration string
+	//go:embed integration/ohsh.fish
+	fishIntegration string
+)
+
+// shellIntegration describes how to launch a shell with ohsh's prompt hooks
+// loaded. The hooks are written to a temporary directory that is removed by
+// cleanup once the session is over.
+type shellIntegration struct {
+	args    []string
+	env     []string
+	cleanup func()
+}
+
+// shellName returns the base name of a shell path, without the leading
+// dash used for login shells.
+func shellName(shell string) string {
+	return strings.TrimPrefix(filepath.Base(shell), "-")
+}
+
+// supportsShellIntegration reports whether ohsh ships hooks for shell.
+func supportsShellIntegration(shell string) bool {
+	switch shellName(shell) {
+	case "bash", "zsh", "fish":
+		return true
+	}
+	return false
+}
+
+// setupShellIntegration writes the hook scripts for shell and returns the
+// arguments and environment needed to load them, followed by the user's
+// args.
+func setupShellIntegration(shell string, args ...string) (*shellIntegration, error) {
+	name := shellName(shell)
+	if !supportsShellIntegration(name) {
+		return nil, fmt.Errorf("no shell integration for %s", name)
+	}
+	dir, err := os.MkdirTemp("", "ohsh-integration-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create shell integration dir: %w", err)
+	}
+	si := &shellIntegration{
+		cleanup: func() { _ = os.RemoveAll(dir) },
+	}
+	write := func(file, content string) error {
+		return os.WriteFile(filepath.Join(dir, file), []byte(content), 0o600)
+	}
+
+	switch name {
+	case "bash":
+		err = write("ohsh.bash", bashIntegration)
+		si.args = []string{"--rcfile", filepath.Join(dir, "ohsh.bash")}
+		// A login shell ignores --rcfile, so the hooks load the profile
+		// themselves instead.
+		var login bool
+		args, login = withoutLogin(args)
+		if login {
+			si.env = append(si.env, "OHSH_BASH_LOGIN=1")
+		}
+	case "zsh":
+		if err = write(".zshrc", zshIntegration); err == nil {
+			err = write(".zshenv", zshEnvIntegration)
+		}
+		if zdotdir, ok := os.LookupEnv("ZDOTDIR"); ok {
+			si.env = append(si.env, "OHSH_USER_ZDOTDIR="+zdotdir)
+		}
+		si.env = append(si.env, "ZDOTDIR="+dir)
+	case "fish":
+		err = write("ohsh.fish", fishIntegration)
+		si.args = []string{"--init-command", "source '" + filepath.Join(dir, "ohsh.fish") + "'"}
+	}
+	if err != nil {
+		si.cleanup()
+		return nil, fmt.Errorf("failed to write shell integration: %w", err)
+	}
+	si.args = append(si.args, args...)
+	return si, nil
+}
+
+// withoutLogin removes bash's login flags from args and reports whether
+// there were any.
+func withoutLogin(args []string) ([]string, bool) {
+	var rest []string
+	login := false
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return append(rest, args[i:]...), login
+		case arg == "-l" || arg == "--login":
+			login = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return rest, login
+}
+
+// HookCommand writes the hooks for shell so they can be loaded into a shell
+// that is already running, such as the one in a tmux pane, and returns the
+// line to type into it to load them. Unlike at startup, the user's own
+// startup files are not read again. The line starts with a space to keep it
+// out of the shell's history. cleanup removes the hooks once they have been
+// loaded.
+func HookCommand(shell string, contextVars []string) (line string, cleanup func(), err error) {
+	name := shellName(shell)
+	if !supportsShellIntegration(name) {
+		return "", nil, fmt.Errorf("no shell integration for %s", name)
+	}
+	dir, err := os.MkdirTemp("", "ohsh-hooks-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create shell hooks dir: %w", err)
+	}
+	cleanup = func() { _ = os.RemoveAll(dir) }
+	vars := shellQuote(strings.Join(contextEnvVars(contextVars), " "))
+
+	var hooks, script, load string
+	switch name {
+	case "bash", "zsh":
+		hooks, load = bashIntegration, "."
+		if name == "zsh" {
+			hooks = zshIntegration
+		}
+		script = fmt.Sprintf("OHSH_CONTEXT_VARS=%s\nOHSH_HOOKS_ONLY=1\n. %s\nunset OHSH_HOOKS_ONLY\n", vars, shellQuote(filepath.Join(dir, "hooks")))
+	case "fish":
+		hooks, load = fishIntegration, "source"
+		script = fmt.Sprintf("set -g OHSH_CONTEXT_VARS %s\nsource %s\n", vars, shellQuote(filepath.Join(dir, "hooks")))
+	}
+	err = os.WriteFile(filepath.Join(dir, "hooks"), []byte(hooks), 0o600)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "load"), []byte(script), 0o600)
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to write shell hooks: %w", err)
+	}
+	return " " + load + " " + shellQuote(filepath.Join(dir, "load")), cleanup, nil
+}
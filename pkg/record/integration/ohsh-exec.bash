@@ -0,0 +1,46 @@
+# ohsh tracing for scripts run with ohsh exec.
+#
+# Sourced at the top of the script ohsh generates from the user's, which
+# calls __ohsh_begin before and __ohsh_end after each of its top-level
+# commands. Like the interactive integration, they report the command line,
+# its status and the context as OSC 133/633 marks on stdout. The calls are
+# written so that they keep $? for the script and do not trip set -e.
+
+__ohsh_escape() {
+	local s=$1
+	s=${s//\\/\\\\}
+	s=${s//;/\\x3b}
+	s=${s//$'\n'/\\x0a}
+	s=${s//$'\r'/\\x0d}
+	s=${s//$'\a'/\\x07}
+	s=${s//$'\e'/\\x1b}
+	__ohsh_escaped=$s
+}
+
+__ohsh_report_context() {
+	__ohsh_escape "$PWD"
+	builtin printf '\e]633;P;Cwd=%s\a' "$__ohsh_escaped"
+	builtin printf '\e]633;P;Host=%s\a\e]633;P;User=%s\a' "${HOSTNAME%%.*}" "${USER:-${LOGNAME:-}}"
+	local name
+	for name in ${OHSH_CONTEXT_VARS:-}; do
+		__ohsh_escape "${!name:-}"
+		builtin printf '\e]633;P;Env.%s=%s\a' "$name" "$__ohsh_escaped"
+	done
+}
+
+# $1 is the command line about to run, already escaped.
+__ohsh_begin() {
+	local status=$?
+	__ohsh_report_context
+	builtin printf '\e]633;E;%s\a\e]133;C\a' "$1"
+	return $status
+}
+
+__ohsh_end() {
+	local status=$?
+	builtin printf '\e]133;D;%s\a' "$status"
+	return $status
+}
+
+# Reports the status of a command that exits the script.
+trap '__ohsh_end' EXIT
@@ -0,0 +1,151 @@
+# ohsh shell integration for bash.
+#
+# Loaded with --rcfile in place of ~/.bashrc, which is sourced first (or the
+# profile files, for a login shell) so the user's prompt, aliases and
+# functions behave as usual. The hooks report the exact command line bash
+# executed and its lifecycle as OSC 133/633 marks, which the recorder strips
+# from the output stream.
+
+if [ -n "${__ohsh_loaded:-}" ]; then
+	return
+fi
+__ohsh_loaded=1
+
+if [ -n "${OHSH_HOOKS_ONLY:-}" ]; then
+	: # Loaded into a shell that is already running and set up.
+elif [ -n "${OHSH_BASH_LOGIN:-}" ]; then
+	# Asked for a login shell: read the profile files as bash -l would.
+	unset OHSH_BASH_LOGIN
+	if [ -r /etc/profile ]; then
+		. /etc/profile
+	fi
+	for __ohsh_profile in ~/.bash_profile ~/.bash_login ~/.profile; do
+		if [ -r "$__ohsh_profile" ]; then
+			. "$__ohsh_profile"
+			break
+		fi
+	done
+	unset __ohsh_profile
+elif [ -r ~/.bashrc ]; then
+	. ~/.bashrc
+fi
+
+# Escapes $1 for use in a mark into __ohsh_escaped, avoiding a subshell.
+__ohsh_escape() {
+	local s=$1
+	s=${s//\\/\\\\}
+	s=${s//;/\\x3b}
+	s=${s//$'\n'/\\x0a}
+	s=${s//$'\r'/\\x0d}
+	s=${s//$'\a'/\\x07}
+	s=${s//$'\e'/\\x1b}
+	__ohsh_escaped=$s
+}
+
+# The command line is taken from the last history entry, which is the line
+# bash just read unless the user's settings left it out. ignoredups and
+# erasedups leave out a repeat of the last entry, which is the same line.
+# ignorespace and HISTIGNORE leave out lines that cannot be told apart from
+# it, so the integration takes those settings over: bash adds every line,
+# and __ohsh_precmd deletes the entries they would have left out once the
+# command has run. HISTCONTROL and HISTIGNORE as set by the user are read
+# again at each prompt.
+__ohsh_ignorespace=
+__ohsh_histignore=
+__ohsh_histcontrol=
+
+# __ohsh_histnum and __ohsh_histline are the number and line of the last
+# history entry seen at a prompt, so only entries added since are deleted.
+__ohsh_histnum=
+__ohsh_histline=
+
+__ohsh_history_entry() {
+	local entry
+	entry=$(HISTTIMEFORMAT= builtin history 1)
+	# The number is followed by a * if the entry was edited, or a space,
+	# and a space, so the line keeps its leading spaces.
+	[[ $entry =~ ^[[:space:]]*([0-9]+)[*\ ]\ (.*)$ ]]
+}
+
+# Moves ignorespace and HISTIGNORE out of the user's history settings.
+__ohsh_take_history_settings() {
+	if [[ ${HISTCONTROL-} != "$__ohsh_histcontrol" ]]; then
+		local control=:${HISTCONTROL-}:
+		__ohsh_ignorespace=
+		if [[ $control == *:ignorespace:* || $control == *:ignoreboth:* ]]; then
+			__ohsh_ignorespace=1
+		fi
+		control=${control//:ignorespace:/:}
+		control=${control//:ignoreboth:/:ignoredups:}
+		control=${control#:}
+		HISTCONTROL=${control%:}
+		__ohsh_histcontrol=$HISTCONTROL
+	fi
+	if [[ -n ${HISTIGNORE-} ]]; then
+		__ohsh_histignore=$HISTIGNORE
+		HISTIGNORE=
+	fi
+}
+
+# Reports whether the user's settings would have kept line $1 out of
+# history.
+__ohsh_history_ignored() {
+	if [[ -n $__ohsh_ignorespace && $1 == ' '* ]]; then
+		return 0
+	fi
+	if [[ -z $__ohsh_histignore ]]; then
+		return 1
+	fi
+	local pattern patterns
+	IFS=: read -r -a patterns <<<"$__ohsh_histignore"
+	for pattern in "${patterns[@]}"; do
+		if [[ $pattern == '&' && $1 == "$__ohsh_histline" ]] || [[ $pattern != '&' && $1 == $pattern ]]; then
+			return 0
+		fi
+	done
+	return 1
+}
+
+# Runs in a subshell from PS0, after a line is read and before it executes.
+# With history turned off no command line is reported, and the recorder
+# falls back to the keystrokes it saw.
+__ohsh_preexec() {
+	if [[ -o history ]] && __ohsh_history_entry; then
+		__ohsh_escape "${BASH_REMATCH[2]}"
+		builtin printf '\e]633;E;%s\a' "$__ohsh_escaped"
+	fi
+	builtin printf '\e]133;C\a'
+}
+
+# Reports the working directory, machine, user and the variables named in
+# OHSH_CONTEXT_VARS, which apply to the next command.
+__ohsh_report_context() {
+	__ohsh_escape "$PWD"
+	builtin printf '\e]633;P;Cwd=%s\a' "$__ohsh_escaped"
+	builtin printf '\e]633;P;Host=%s\a\e]633;P;User=%s\a' "${HOSTNAME%%.*}" "${USER:-${LOGNAME:-}}"
+	local name
+	for name in ${OHSH_CONTEXT_VARS:-}; do
+		__ohsh_escape "${!name:-}"
+		builtin printf '\e]633;P;Env.%s=%s\a' "$name" "$__ohsh_escaped"
+	done
+}
+
+__ohsh_precmd() {
+	local status=$?
+	builtin printf '\e]133;D;%s\a' "$status"
+	if __ohsh_history_entry && [[ ${BASH_REMATCH[1]} != "$__ohsh_histnum" ]] &&
+		__ohsh_history_ignored "${BASH_REMATCH[2]}"; then
+		builtin history -d "${BASH_REMATCH[1]}"
+	fi
+	if __ohsh_history_entry; then
+		__ohsh_histnum=${BASH_REMATCH[1]}
+		__ohsh_histline=${BASH_REMATCH[2]}
+	fi
+	__ohsh_take_history_settings
+	__ohsh_report_context
+	builtin printf '\e]133;A\a'
+	return $status
+}
+
+PROMPT_COMMAND="__ohsh_precmd${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+PS0='$(__ohsh_preexec)'"${PS0:-}"
@@ -0,0 +1,27 @@
+# ohsh shell integration for fish.
+#
+# Loaded with --init-command after the user's config.fish. Event handlers
+# report each command as OSC 133/633 marks.
+
+function __ohsh_escape
+    string split \n -- $argv[1] | string replace -a '\\' '\\\\' | string replace -a ';' '\x3b' | string replace -a \r '\x0d' | string replace -a \a '\x07' | string replace -a \e '\x1b' | string join '\x0a'
+end
+
+function __ohsh_preexec --on-event fish_preexec
+    printf '\e]633;E;%s\a\e]133;C\a' (__ohsh_escape $argv[1])
+end
+
+function __ohsh_postexec --on-event fish_postexec
+    printf '\e]133;D;%s\a' $status
+end
+
+# Reports the working directory, machine, user and the variables named in
+# OHSH_CONTEXT_VARS, which apply to the next command.
+function __ohsh_prompt --on-event fish_prompt
+    printf '\e]633;P;Cwd=%s\a' (__ohsh_escape $PWD)
+    printf '\e]633;P;Host=%s\a\e]633;P;User=%s\a' (prompt_hostname) "$USER"
+    for name in (string split -n ' ' -- "$OHSH_CONTEXT_VARS")
+        printf '\e]633;P;Env.%s=%s\a' $name (__ohsh_escape "$$name")
+    end
+    printf '\e]133;A\a'
+end
@@ -0,0 +1,85 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupShellIntegration_Bash(t *testing.T) {
+	si, err := setupShellIntegration("/usr/bin/bash")
+	require.NoError(t, err)
+	defer si.cleanup()
+
+	require.Len(t, si.args, 2)
+	assert.Equal(t, "--rcfile", si.args[0])
+	content, err := os.ReadFile(si.args[1])
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "133;C")
+
+	si.cleanup()
+	_, err = os.Stat(filepath.Dir(si.args[1]))
+	assert.True(t, os.IsNotExist(err), "cleanup should remove the integration dir")
+}
+
+func TestSetupShellIntegration_Zsh(t *testing.T) {
+	t.Setenv("ZDOTDIR", "/home/user/.config/zsh")
+	si, err := setupShellIntegration("-zsh")
+	require.NoError(t, err)
+	defer si.cleanup()
+
+	assert.Empty(t, si.args)
+	assert.Contains(t, si.env, "OHSH_USER_ZDOTDIR=/home/user/.config/zsh")
+	var dir string
+	for _, kv := range si.env {
+		if strings.HasPrefix(kv, "ZDOTDIR=") {
+			dir = strings.TrimPrefix(kv, "ZDOTDIR=")
+		}
+	}
+	assert.FileExists(t, filepath.Join(dir, ".zshrc"))
+	assert.FileExists(t, filepath.Join(dir, ".zshenv"))
+}
+
+func TestSetupShellIntegration_Unsupported(t *testing.T) {
+	_, err := setupShellIntegration("/bin/sh")
+	assert.Error(t, err)
+	assert.False(t, supportsShellIntegration("/usr/bin/psql"))
+}
+
+func TestSetupShellIntegration_Args(t *testing.T) {
+	si, err := setupShellIntegration("/bin/bash", "-l", "--norc", "-O", "extglob")
+	require.NoError(t, err)
+	defer si.cleanup()
+
+	assert.Equal(t, []string{"--norc", "-O", "extglob"}, si.args[2:], "bash -l would ignore --rcfile")
+	assert.Contains(t, si.env, "OHSH_BASH_LOGIN=1")
+
+	si, err = setupShellIntegration("zsh", "-l")
+	require.NoError(t, err)
+	defer si.cleanup()
+	assert.Equal(t, []string{"-l"}, si.args)
+}
+
+func TestHookCommand(t *testing.T) {
+	line, cleanup, err := HookCommand("/bin/bash", []string{"KUBECONFIG"})
+	require.NoError(t, err)
+	defer cleanup()
+
+	assert.True(t, strings.HasPrefix(line, " . '"), "the leading space keeps the line out of history")
+	load := strings.Trim(strings.TrimPrefix(line, " . "), "'")
+	content, err := os.ReadFile(load)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "OHSH_CONTEXT_VARS='KUBECONFIG'")
+	assert.Contains(t, string(content), "OHSH_HOOKS_ONLY=1")
+	assert.FileExists(t, filepath.Join(filepath.Dir(load), "hooks"))
+
+	cleanup()
+	assert.NoFileExists(t, load)
+
+	_, _, err = HookCommand("sh", nil)
+	assert.Error(t, err)
+}
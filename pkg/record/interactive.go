@@ -0,0 +1,80 @@
+package record
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ohshell/cli/pkg/vt"
+	"github.com/sirupsen/logrus"
+)
+
+// InteractiveProgram is a full-screen program, such as vim, less or htop,
+// that a command ran on the terminal's alternate screen. Its output is not
+// useful as text, so only its name and how long it ran are recorded.
+type InteractiveProgram struct {
+	Name      string
+	StartTime time.Time
+	Duration  time.Duration
+	Snapshot  string // final screen, when the session was started WithScreenSnapshots
+}
+
+// WithScreenSnapshots records the last screen of each full-screen program
+// in InteractiveProgram.Snapshot.
+func WithScreenSnapshots() SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.screenSnapshots = true
+	}
+}
+
+// newScreen returns the screen that renders the output of a new command.
+func (t *tracker) newScreen() *vt.Screen {
+	screen := vt.New(t.cols, t.rows)
+	screen.OnAltEnter = t.enterProgram
+	screen.OnAltExit = t.exitProgram
+	return screen
+}
+
+// enterProgram is called when the running command switches to the
+// alternate screen.
+func (t *tracker) enterProgram() {
+	var name string
+	if t.foreground != nil {
+		name = t.foreground()
+	}
+	if name == "" {
+		t.session.mu.Lock()
+		name = programName(t.session.Commands[t.current].Input)
+		t.session.mu.Unlock()
+	}
+	logrus.Debugf("Interactive program started: %s", name)
+	t.program = &InteractiveProgram{Name: name, StartTime: time.Now()}
+}
+
+// exitProgram is called before the running command leaves the alternate
+// screen, while the program's last screen can still be captured.
+func (t *tracker) exitProgram() {
+	if t.program == nil {
+		return
+	}
+	t.program.Duration = time.Since(t.program.StartTime)
+	if t.cfg != nil && t.cfg.screenSnapshots {
+		t.program.Snapshot, _ = t.cfg.redact(t.screen.Snapshot())
+	}
+	logrus.Debugf("Interactive program finished: %s (%s)", t.program.Name, t.program.Duration)
+	t.programs = append(t.programs, *t.program)
+	t.program = nil
+}
+
+// programName guesses the program a command line runs from its first word,
+// skipping wrappers such as sudo and env.
+func programName(input string) string {
+	for _, field := range strings.Fields(input) {
+		if field == "sudo" || field == "env" || field == "exec" || field == "command" ||
+			strings.HasPrefix(field, "-") || strings.Contains(field, "=") {
+			continue
+		}
+		return filepath.Base(field)
+	}
+	return ""
+}
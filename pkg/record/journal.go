@@ -0,0 +1,42 @@
+package record
+
+import "github.com/sirupsen/logrus"
+
+// Journal keeps a durable copy of a session while it is recorded, so that
+// it survives ohsh being killed. Commands are passed to it when they start
+// and again when they finish, identified by an ID that stays the same
+// while steps before them are dropped. It must be safe for concurrent use.
+type Journal interface {
+	Update(id int, cmd Command) error
+	Remove(id int) error
+	Close(session *Session) error
+}
+
+// WithJournal writes the session to j as it is recorded.
+func WithJournal(j Journal) SessionOption {
+	return WithSubscriber(journalSubscriber{j})
+}
+
+// journalSubscriber passes the events the journal keeps to it. Failures
+// are only logged: the session goes on without a safety net rather than
+// ending.
+type journalSubscriber struct {
+	journal Journal
+}
+
+func (s journalSubscriber) HandleEvent(e Event) {
+	var err error
+	switch e.Kind {
+	case CommandStarted, CommandFinished, CommandUpdated:
+		err = s.journal.Update(e.ID, e.Command)
+	case CommandDropped:
+		err = s.journal.Remove(e.ID)
+	case SessionEnded:
+		if err := s.journal.Close(e.Session); err != nil {
+			logrus.WithError(err).Debug("Failed to close session journal")
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).Debug("Failed to update session journal")
+	}
+}
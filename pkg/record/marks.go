@@ -0,0 +1,206 @@
+package record
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Shell integration scripts report what the shell is doing through OSC
+// sequences written to the terminal, following the semantic prompt
+// convention (OSC 133) and its VS Code extension (OSC 633):
+//
+//	ESC ] 133 ; A BEL            prompt is about to be drawn
+//	ESC ] 133 ; C BEL            command line accepted, command is executing
+//	ESC ] 133 ; D ; <status> BEL command finished
+//	ESC ] 633 ; E ; <line> BEL   exact command line the shell executed
+//	ESC ] 633 ; P ; <k>=<v> BEL  property of the shell (cwd, context, ...)
+//
+// Sequences may also be terminated by ST (ESC \).
+
+const (
+	markPromptStart  = 'A'
+	markCommandStart = 'C'
+	markCommandDone  = 'D'
+	markCommandLine  = 'E'
+	markProperty     = 'P'
+)
+
+// maxOSCLen bounds how much of an OSC sequence is buffered before it is
+// given up on and passed through untouched. Command lines can be long
+// (heredocs, pasted scripts), so this is generous.
+const maxOSCLen = 64 * 1024
+
+// mark is a single shell integration event parsed from the output stream.
+// offset is the position in the cleaned output at which it occurred.
+type mark struct {
+	kind   byte
+	args   string
+	offset int
+}
+
+type markState int
+
+const (
+	stateGround markState = iota
+	stateEsc
+	stateOSC
+	stateOSCEsc
+)
+
+// markParser strips shell integration marks from a terminal output stream.
+// It keeps state between calls so sequences split across reads are handled.
+type markParser struct {
+	state markState
+	buf   []byte
+	marks []mark
+}
+
+// parse appends the bytes of p that are not shell integration marks to out
+// and returns the extended slice, along with the marks found. The returned
+// marks are only valid until the next call.
+func (m *markParser) parse(p []byte, out []byte) ([]byte, []mark) {
+	m.marks = m.marks[:0]
+	for _, b := range p {
+		out = m.step(b, out)
+	}
+	return out, m.marks
+}
+
+func (m *markParser) step(b byte, out []byte) []byte {
+	switch m.state {
+	case stateGround:
+		if b == 0x1b {
+			m.state = stateEsc
+			return out
+		}
+		return append(out, b)
+	case stateEsc:
+		switch b {
+		case ']':
+			m.state = stateOSC
+			m.buf = m.buf[:0]
+			return out
+		case 0x1b:
+			return append(out, 0x1b)
+		}
+		m.state = stateGround
+		return append(out, 0x1b, b)
+	case stateOSC:
+		switch {
+		case b == 0x07:
+			return m.finish(out, []byte{0x07})
+		case b == 0x1b:
+			m.state = stateOSCEsc
+		case len(m.buf) >= maxOSCLen:
+			out = append(out, 0x1b, ']')
+			out = append(out, m.buf...)
+			m.state = stateGround
+			return append(out, b)
+		default:
+			m.buf = append(m.buf, b)
+		}
+		return out
+	default: // stateOSCEsc
+		if b == '\\' {
+			return m.finish(out, []byte{0x1b, '\\'})
+		}
+		// Anything other than ST aborts the OSC; pass it through and
+		// treat the ESC as the start of a new sequence.
+		out = append(out, 0x1b, ']')
+		out = append(out, m.buf...)
+		m.state = stateEsc
+		return m.step(b, out)
+	}
+}
+
+// finish handles a complete OSC payload in m.buf terminated by term.
+func (m *markParser) finish(out []byte, term []byte) []byte {
+	m.state = stateGround
+	if mk, ok := parseMark(m.buf); ok {
+		mk.offset = len(out)
+		m.marks = append(m.marks, mk)
+		return out
+	}
+	out = append(out, 0x1b, ']')
+	out = append(out, m.buf...)
+	return append(out, term...)
+}
+
+// parseMark recognises the OSC 133/633 payloads emitted by the integration
+// scripts. Other OSC sequences (window titles, hyperlinks, ...) are left
+// for the terminal.
+func parseMark(payload []byte) (mark, bool) {
+	if !bytes.HasPrefix(payload, []byte("133;")) && !bytes.HasPrefix(payload, []byte("633;")) {
+		return mark{}, false
+	}
+	rest := payload[4:]
+	if len(rest) == 0 {
+		return mark{}, false
+	}
+	mk := mark{kind: rest[0]}
+	switch mk.kind {
+	case markPromptStart, markCommandStart, markCommandDone, markCommandLine, markProperty:
+	default:
+		return mark{}, false
+	}
+	if len(rest) > 1 {
+		if rest[1] != ';' {
+			return mark{}, false
+		}
+		mk.args = string(rest[2:])
+	}
+	return mk, true
+}
+
+// escapeMarkValue escapes s for use in a mark the way the integration
+// scripts do, for marks ohsh writes on a shell's behalf.
+func escapeMarkValue(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\':
+			sb.WriteString(`\\`)
+		case ';', '\n', '\r', '\a', 0x1b:
+			fmt.Fprintf(&sb, `\x%02x`, c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// unescapeMarkValue reverses the escaping applied by the integration
+// scripts: backslashes are doubled and control characters and semicolons
+// are written as \xHH.
+func unescapeMarkValue(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			sb.WriteByte(c)
+			continue
+		}
+		switch s[i+1] {
+		case '\\':
+			sb.WriteByte('\\')
+			i++
+		case 'x':
+			if i+3 < len(s) {
+				if v, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+					sb.WriteByte(byte(v))
+					i += 3
+					continue
+				}
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
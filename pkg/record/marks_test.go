@@ -0,0 +1,61 @@
+package record
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarkParser_StripsMarks(t *testing.T) {
+	var m markParser
+	out, marks := m.parse([]byte("$ \x1b]633;E;ls -la\x07\x1b]133;C\x07file1\r\n\x1b]133;D;0\x07"), nil)
+
+	assert.Equal(t, "$ file1\r\n", string(out))
+	if assert.Len(t, marks, 3) {
+		assert.Equal(t, mark{kind: markCommandLine, args: "ls -la", offset: 2}, marks[0])
+		assert.Equal(t, mark{kind: markCommandStart, offset: 2}, marks[1])
+		assert.Equal(t, mark{kind: markCommandDone, args: "0", offset: 9}, marks[2])
+	}
+}
+
+func TestMarkParser_SplitAcrossReads(t *testing.T) {
+	var m markParser
+	stream := "out\x1b]133;D;1\x1b\\more"
+	var out []byte
+	var kinds []byte
+	for i := 0; i < len(stream); i++ {
+		var marks []mark
+		out, marks = m.parse([]byte{stream[i]}, out)
+		for _, mk := range marks {
+			kinds = append(kinds, mk.kind)
+			assert.Equal(t, "1", mk.args)
+		}
+	}
+	assert.Equal(t, "outmore", string(out))
+	assert.Equal(t, []byte{markCommandDone}, kinds)
+}
+
+func TestMarkParser_PassesThroughOtherSequences(t *testing.T) {
+	var m markParser
+	in := "\x1b]0;window title\x07\x1b[31mred\x1b[0m\x1b]8;;http://x\x1b\\link"
+	out, marks := m.parse([]byte(in), nil)
+
+	assert.Equal(t, in, string(out))
+	assert.Empty(t, marks)
+}
+
+func TestUnescapeMarkValue(t *testing.T) {
+	assert.Equal(t, "plain", unescapeMarkValue("plain"))
+	assert.Equal(t, "echo a; echo b", unescapeMarkValue(`echo a\x3b echo b`))
+	assert.Equal(t, "cat <<X\nhi\nX", unescapeMarkValue(`cat <<X\x0ahi\x0aX`))
+	assert.Equal(t, `printf '\n'`, unescapeMarkValue(`printf '\\n'`))
+	assert.Equal(t, `trailing\`, unescapeMarkValue(`trailing\`))
+}
+
+func TestEscapeMarkValue(t *testing.T) {
+	s := "echo 'a;b' \\\n\tc\a\x1b\r"
+	escaped := escapeMarkValue(s)
+	assert.NotContains(t, escaped, ";")
+	assert.NotContains(t, escaped, "\n")
+	assert.Equal(t, s, unescapeMarkValue(escaped))
+}
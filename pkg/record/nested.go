@@ -0,0 +1,285 @@
+package record
+
+import (
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ohshell/cli/pkg/vt"
+	"github.com/sirupsen/logrus"
+)
+
+// nestedShell is an interactive shell started by a command of the session,
+// such as ssh bastion or sudo -i. It has no hooks of its own, so its
+// commands are told apart by its prompt: each line entered at something
+// that looks like a prompt ends the running command and starts the next.
+type nestedShell struct {
+	parent int    // index in session.Commands of the command that started it
+	host   string // machine its commands run on, "" if unknown
+	user   string // user they run as, "" if unknown
+}
+
+// promptPattern splits a line entered at a shell prompt into the prompt,
+// which ends with one of the usual prompt characters, and the command line.
+var promptPattern = regexp.MustCompile(`^(.*?[$#%>❯]) (.*)$`)
+
+// promptUserHost finds user@host in a prompt.
+var promptUserHost = regexp.MustCompile(`([A-Za-z_][\w.-]*)@([A-Za-z0-9][\w-]*)`)
+
+// splitPrompt splits line into a prompt and the command line typed at it.
+// Continuation prompts and REPL prompts such as "> " and ">>> " are not
+// taken for a shell's.
+func splitPrompt(line string) (prompt, input string, ok bool) {
+	m := promptPattern.FindStringSubmatch(line)
+	if m == nil || strings.Trim(m[1], "> .") == "" {
+		return "", "", false
+	}
+	return m[1], strings.TrimSpace(m[2]), true
+}
+
+// enterNested notes that the running command started an interactive shell
+// on host as user, either of which is "" if it is the same as before.
+func (t *tracker) enterNested(host, user string) {
+	nested := nestedShell{parent: t.current, host: t.host, user: t.user}
+	if t.nested != nil {
+		// A shell started from a nested shell, such as sudo -i after ssh,
+		// ends with the outermost one as far as the marks tell.
+		nested = *t.nested
+	}
+	if host != "" {
+		nested.host, nested.user = host, ""
+	}
+	if user != "" {
+		nested.user = user
+	}
+	logrus.Debugf("Nested shell started on %q as %q", nested.host, nested.user)
+	t.nested = &nested
+	t.entered.Store(false)
+}
+
+// nestedLine is called once a line entered in a nested shell has been
+// echoed. If it was typed at a prompt, the running command ends with the
+// output before that prompt and the line starts the next command.
+func (t *tracker) nestedLine() {
+	line := t.screen.CursorLine()
+	logrus.Debugf("Line entered in nested shell: %q", line)
+	prompt, input, ok := splitPrompt(line)
+	if !ok || input == "" {
+		return
+	}
+	if m := promptUserHost.FindStringSubmatch(prompt); m != nil {
+		t.nested.user, t.nested.host = m[1], m[2]
+	}
+	if t.current >= 0 {
+		t.atPrompt = true
+		t.finish()
+	}
+	t.begin(input)
+	if t.current < 0 {
+		// A comment, kept as a note for the next command: the prompt is
+		// still watched for it.
+		t.screen = vt.New(t.cols, t.rows)
+	}
+}
+
+// leaveNested ends the nested shell when the shell that started it reports
+// the command done: its last command ends, and the command that started it
+// gets the exit status.
+func (t *tracker) leaveNested(exitCode *int) {
+	parent := t.nested.parent
+	t.nested = nil
+	if t.current < 0 {
+		t.screen = nil
+	}
+	if parent < 0 || parent == t.current {
+		t.complete(exitCode)
+		return
+	}
+	t.finish()
+	t.session.mu.Lock()
+	if parent >= len(t.session.Commands) {
+		t.session.mu.Unlock()
+		return
+	}
+	cmd := &t.session.Commands[parent]
+	cmd.ExitCode = exitCode
+	updated := *cmd
+	t.session.mu.Unlock()
+	t.cfg.publishCommand(CommandUpdated, updated, false)
+}
+
+// nestedShellCommand reports whether input starts an interactive shell,
+// and the machine and user it runs as as far as the command line tells;
+// either is "" if it stays the same or is not known.
+func nestedShellCommand(input string) (host, user string, ok bool) {
+	fields := strings.Fields(input)
+	for len(fields) > 0 && strings.Contains(fields[0], "=") {
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return "", "", false
+	}
+	args := fields[1:]
+	switch name := filepath.Base(fields[0]); name {
+	case "ssh", "mosh":
+		return sshTarget(args)
+	case "sudo":
+		return sudoTarget(args)
+	case "su":
+		user, ok := suTarget(args)
+		return "", user, ok
+	case "docker", "podman":
+		return execTarget(args, "eu", []string{"--env", "--env-file", "--user", "--workdir", "--detach-keys"})
+	case "kubectl", "oc":
+		return execTarget(args, "cnf", []string{"--container", "--namespace", "--context", "--filename"})
+	default:
+		return "", "", isShell(name, args)
+	}
+}
+
+// isShell reports whether name with args starts an interactive shell:
+// options only, and no command to run with -c.
+func isShell(name string, args []string) bool {
+	switch strings.TrimPrefix(name, "-") {
+	case "bash", "zsh", "sh", "fish", "dash", "ksh":
+	default:
+		return false
+	}
+	for _, a := range args {
+		if !strings.HasPrefix(a, "-") || a == "--command" ||
+			!strings.HasPrefix(a, "--") && strings.ContainsRune(a, 'c') {
+			return false
+		}
+	}
+	return true
+}
+
+// sshOptionsWithValue are the ssh options that take a value.
+const sshOptionsWithValue = "BbcDEeFIiJLlmOopQRSWw"
+
+// sshTarget parses the arguments of ssh or mosh, which start a shell when
+// no remote command is given.
+func sshTarget(args []string) (host, user string, ok bool) {
+	var dest string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case dest != "":
+			return "", "", false // runs a remote command
+		case a == "-l" && i+1 < len(args):
+			user = args[i+1]
+			i++
+		case len(a) == 2 && a[0] == '-' && strings.IndexByte(sshOptionsWithValue, a[1]) >= 0:
+			i++
+		case strings.HasPrefix(a, "-"):
+		default:
+			dest = a
+		}
+	}
+	if dest == "" {
+		return "", "", false
+	}
+	dest = strings.TrimPrefix(dest, "ssh://")
+	if u, h, found := strings.Cut(dest, "@"); found {
+		user, dest = u, h
+	}
+	host, _, _ = strings.Cut(dest, ":")
+	return host, user, host != ""
+}
+
+// sudoOptionsWithValue are the sudo options that take a value.
+const sudoOptionsWithValue = "CDghprTtUu"
+
+// sudoTarget parses the arguments of sudo, which starts a shell with -i or
+// -s and no command, or when the command starts one.
+func sudoTarget(args []string) (host, user string, ok bool) {
+	user = "root"
+	shell := false
+	var command []string
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			command = args[i+1:]
+		case a == "-u" && i+1 < len(args):
+			user = args[i+1]
+			i++
+		case strings.HasPrefix(a, "--user="):
+			user = strings.TrimPrefix(a, "--user=")
+		case a == "-i" || a == "-s" || a == "--login" || a == "--shell":
+			shell = true
+		case len(a) == 2 && a[0] == '-' && strings.IndexByte(sudoOptionsWithValue, a[1]) >= 0:
+			i++
+		case strings.HasPrefix(a, "-"):
+		default:
+			command = args[i:]
+		}
+		if command != nil {
+			break
+		}
+	}
+	if len(command) == 0 {
+		return "", user, shell
+	}
+	host, as, ok := nestedShellCommand(strings.Join(command, " "))
+	if as == "" {
+		as = user
+	}
+	return host, as, ok
+}
+
+// suTarget parses the arguments of su, which starts a shell unless given a
+// command with -c.
+func suTarget(args []string) (user string, ok bool) {
+	user = "root"
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "-c" || a == "--command" || strings.HasPrefix(a, "--command="):
+			return "", false
+		case a == "-s" || a == "--shell" || a == "-g" || a == "--group":
+			i++
+		case strings.HasPrefix(a, "-"):
+		default:
+			user = a
+		}
+	}
+	return user, true
+}
+
+// execTarget parses the arguments of docker exec or kubectl exec, which
+// start a shell in a container when the command is one. Options are given
+// as the letters of the short ones and the long ones that take a value.
+func execTarget(args []string, short string, long []string) (host, user string, ok bool) {
+	if len(args) == 0 || args[0] != "exec" {
+		return "", "", false
+	}
+	var target string
+	var command []string
+	for i := 1; i < len(args) && command == nil; i++ {
+		a := args[i]
+		switch {
+		case a == "--":
+			command = args[i+1:]
+		case a == "-u" || a == "--user":
+			if i+1 < len(args) {
+				user = args[i+1]
+			}
+			i++
+		case strings.HasPrefix(a, "--user="):
+			user = strings.TrimPrefix(a, "--user=")
+		case len(a) == 2 && a[0] == '-' && strings.IndexByte(short, a[1]) >= 0,
+			strings.HasPrefix(a, "--") && !strings.Contains(a, "=") && slices.Contains(long, a):
+			i++
+		case strings.HasPrefix(a, "-"):
+		case target == "":
+			target = a
+		default:
+			command = args[i:]
+		}
+	}
+	if target == "" || len(command) == 0 || !isShell(filepath.Base(command[0]), command[1:]) {
+		return "", "", false
+	}
+	return strings.TrimPrefix(target, "pod/"), user, true
+}
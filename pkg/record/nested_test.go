@@ -0,0 +1,114 @@
+package record
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNestedShellCommand(t *testing.T) {
+	tests := []struct {
+		input      string
+		host, user string
+		ok         bool
+	}{
+		{"ssh bastion", "bastion", "", true},
+		{"ssh -p 2222 -i ~/.ssh/ops admin@db1.internal", "db1.internal", "admin", true},
+		{"ssh -l admin ssh://bastion:2222", "bastion", "admin", true},
+		{"ssh bastion uptime", "", "", false},
+		{"TERM=xterm mosh web1", "web1", "", true},
+		{"sudo -i", "", "root", true},
+		{"sudo -u postgres -s", "", "postgres", true},
+		{"sudo su - deploy", "", "deploy", true},
+		{"sudo bash", "", "root", true},
+		{"sudo systemctl restart nginx", "", "", false},
+		{"sudo -u postgres psql", "", "", false},
+		{"su", "", "root", true},
+		{"su -c id deploy", "", "", false},
+		{"bash", "", "", true},
+		{"bash -l", "", "", true},
+		{"bash --norc --noprofile", "", "", true},
+		{"bash -lc make", "", "", false},
+		{"bash deploy.sh", "", "", false},
+		{"docker exec -it -u app web sh", "web", "app", true},
+		{"docker exec web cat /etc/hosts", "", "", false},
+		{"kubectl exec -it -n prod pod/api-0 -c api -- bash", "api-0", "", true},
+		{"kubectl get pods", "", "", false},
+		{"ls -la", "", "", false},
+	}
+	for _, tt := range tests {
+		host, user, ok := nestedShellCommand(tt.input)
+		assert.Equal(t, tt.ok, ok, tt.input)
+		if tt.ok {
+			assert.Equal(t, tt.host, host, tt.input)
+			assert.Equal(t, tt.user, user, tt.input)
+		}
+	}
+}
+
+func TestSplitPrompt(t *testing.T) {
+	prompt, input, ok := splitPrompt("admin@bastion:~/app$ git log --oneline | head -n 3")
+	require.True(t, ok)
+	assert.Equal(t, "admin@bastion:~/app$", prompt)
+	assert.Equal(t, "git log --oneline | head -n 3", input)
+
+	_, input, ok = splitPrompt("[root@db1 /]# echo a > b")
+	assert.True(t, ok)
+	assert.Equal(t, "echo a > b", input)
+
+	for _, line := range []string{"[sudo] password for admin: ", "Continue? [y/N] y", "> done", ">>> print(1)", "... pass"} {
+		_, _, ok := splitPrompt(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestTracker_NestedShell(t *testing.T) {
+	session := &Session{}
+	tr := newTracker(session, nil)
+	local := "\x1b]633;P;Host=laptop\x07\x1b]633;P;User=me\x07\x1b]133;A\x07$ "
+	tr.write([]byte(local))
+
+	tr.setTyped("ssh admin@bastion")
+	tr.write([]byte("ssh admin@bastion\r\n\x1b]633;E;ssh admin@bastion\x07\x1b]133;C\x07Welcome\r\nadmin@bastion:~$ "))
+	tr.setTyped("uptime")
+	tr.write([]byte("uptime\r\nup 3 days\r\nadmin@bastion:~$ "))
+	tr.setTyped("sudo -i")
+	tr.write([]byte("sudo -i\r\n[sudo] password for admin: "))
+	// ssh keeps the terminal in raw mode, so the password is not hidden.
+	tr.setTyped("hunter2")
+	tr.write([]byte("\r\nroot@bastion:~# "))
+	tr.setTyped("# Who am I now?")
+	tr.write([]byte("# Who am I now?\r\nroot@bastion:~# "))
+	tr.setTyped("whoami")
+	tr.write([]byte("whoami\r\nroot\r\nroot@bastion:~# "))
+	tr.setTyped("exit")
+	tr.write([]byte("exit\r\nlogout\r\nadmin@bastion:~$ "))
+	tr.setTyped("exit")
+	tr.write([]byte("exit\r\nlogout\r\nConnection to bastion closed.\r\n\x1b]133;D;0\x07" + local))
+	tr.write([]byte("\x1b]633;E;ls\x07\x1b]133;C\x07file\r\n\x1b]133;D;0\x07"))
+
+	require.Len(t, session.Commands, 7)
+	want := []struct{ input, output, host, user string }{
+		{"ssh admin@bastion", "Welcome", "laptop", "me"},
+		{"uptime", "up 3 days", "bastion", "admin"},
+		{"sudo -i", "[sudo] password for admin:", "bastion", "admin"},
+		{"whoami", "root", "bastion", "root"},
+		{"exit", "logout", "bastion", "root"},
+		{"exit", "logout\nConnection to bastion closed.", "bastion", "admin"},
+		{"ls", "file", "laptop", "me"},
+	}
+	for i, w := range want {
+		cmd := session.Commands[i]
+		assert.Equal(t, w.input, cmd.Input)
+		assert.Equal(t, w.output, cmd.Output, w.input)
+		assert.Equal(t, w.host, cmd.Host, w.input)
+		assert.Equal(t, w.user, cmd.User, w.input)
+		assert.NotContains(t, cmd.Output, "hunter2")
+	}
+	assert.Equal(t, "Who am I now?", session.Commands[3].Note)
+	if assert.NotNil(t, session.Commands[0].ExitCode) {
+		assert.Equal(t, 0, *session.Commands[0].ExitCode, "ssh gets the status the shell reported")
+	}
+	assert.Nil(t, session.Commands[5].ExitCode)
+}
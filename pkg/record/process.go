@@ -0,0 +1,16 @@
+package record
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// foregroundProcess returns the name of the process group leader in the
+// foreground of the terminal whose PTY master is fd, or "" if it cannot be
+// determined.
+func foregroundProcess(fd uintptr) string {
+	pgrp, err := unix.IoctlGetInt(int(fd), unix.TIOCGPGRP)
+	if err != nil || pgrp <= 0 {
+		return ""
+	}
+	return ProcessName(pgrp)
+}
@@ -0,0 +1,17 @@
+package record
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProcessName returns the command name of the process pid, or "" if it
+// cannot be determined.
+func ProcessName(pid int) string {
+	comm, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
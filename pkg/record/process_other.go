@@ -0,0 +1,20 @@
+//go:build !linux
+
+package record
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProcessName returns the command name of the process pid, or "" if it
+// cannot be determined.
+func ProcessName(pid int) string {
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(strings.TrimSpace(string(out)))
+}
@@ -0,0 +1,42 @@
+package record
+
+import "os"
+
+// WithCommand records program, started with args, in place of the user's
+// $SHELL: another shell, a login shell or a REPL such as a database
+// console. bash, zsh and fish get the shell integration as usual, with args
+// passed after its own; any other program is recorded from the lines typed
+// into it.
+func WithCommand(program string, args ...string) SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.program = program
+		cfg.args = args
+	}
+}
+
+// WithEnv adds variables, given as KEY=VALUE, to the environment the
+// program is started with, which is otherwise ohsh's own.
+func WithEnv(env ...string) SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.env = append(cfg.env, env...)
+	}
+}
+
+// WithDir starts the program in dir instead of the current directory.
+func WithDir(dir string) SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.dir = dir
+	}
+}
+
+// command returns the program to record and its arguments: the one set
+// WithCommand, or the user's $SHELL, falling back to bash.
+func (cfg *sessionConfig) command() (string, []string) {
+	if cfg.program != "" {
+		return cfg.program, cfg.args
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell, nil
+	}
+	return "/bin/bash", nil
+}
@@ -0,0 +1,29 @@
+package record
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionConfigCommand(t *testing.T) {
+	t.Setenv("SHELL", "/usr/bin/zsh")
+	program, args := (&sessionConfig{}).command()
+	assert.Equal(t, "/usr/bin/zsh", program)
+	assert.Empty(t, args)
+
+	t.Setenv("SHELL", "")
+	program, _ = (&sessionConfig{}).command()
+	assert.Equal(t, "/bin/bash", program)
+
+	cfg := &sessionConfig{}
+	WithCommand("psql", "-h", "db")(cfg)
+	WithEnv("PGUSER=app")(cfg)
+	WithEnv("PGDATABASE=orders")(cfg)
+	WithDir("/srv")(cfg)
+	program, args = cfg.command()
+	assert.Equal(t, "psql", program)
+	assert.Equal(t, []string{"-h", "db"}, args)
+	assert.Equal(t, []string{"PGUSER=app", "PGDATABASE=orders"}, cfg.env)
+	assert.Equal(t, "/srv", cfg.dir)
+}
@@ -0,0 +1,131 @@
+package record
+
+import (
+	"io"
+
+	"github.com/sirupsen/logrus"
+)
+
+// outputChunkSize is how much of the shell's output is read at a time.
+const outputChunkSize = 32 * 1024
+
+// outputBuffers is how many chunks can be read ahead of the one being
+// handled, so the shell is not held up while output is rendered.
+const outputBuffers = 4
+
+// chunkReader reads from a reader on a goroutine of its own, so reading can
+// be waited for together with other events instead of polled. Chunks are
+// read into a few buffers that are reused once released.
+type chunkReader struct {
+	chunks chan []byte // closed once reading stops
+	free   chan []byte
+	stop   chan struct{}
+	err    error // why reading stopped; set before chunks is closed
+}
+
+func newChunkReader(r io.Reader, size, buffers int) *chunkReader {
+	c := &chunkReader{
+		chunks: make(chan []byte),
+		free:   make(chan []byte, buffers),
+		stop:   make(chan struct{}),
+	}
+	for range buffers {
+		c.free <- make([]byte, size)
+	}
+	go c.run(r)
+	return c
+}
+
+func (c *chunkReader) run(r io.Reader) {
+	defer close(c.chunks)
+	for {
+		var buf []byte
+		select {
+		case buf = <-c.free:
+		case <-c.stop:
+			return
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			select {
+			case c.chunks <- buf[:n]:
+			case <-c.stop:
+				return
+			}
+		} else {
+			c.free <- buf
+		}
+		if err != nil {
+			c.err = err
+			return
+		}
+	}
+}
+
+// release hands a chunk's buffer back to be read into again.
+func (c *chunkReader) release(chunk []byte) {
+	c.free <- chunk[:cap(chunk)]
+}
+
+// close stops reading. A read already waiting for input ends when the
+// reader is closed.
+func (c *chunkReader) close() {
+	close(c.stop)
+}
+
+// pumpOutput copies the shell's output from r to w through the tracker
+// until r ends or done is closed. Lines typed at the prompt arrive on typed
+// before they are sent to the shell, so each is handled before any output
+// read after it, such as its echo; typed is closed once input ends.
+func pumpOutput(r io.Reader, w io.Writer, tracker *tracker, typed <-chan string, done <-chan struct{}) {
+	chunks := newChunkReader(r, outputChunkSize, outputBuffers)
+	defer chunks.close()
+	for {
+		// Typed lines go first; the second select blocks until something
+		// arrives.
+		select {
+		case line, ok := <-typed:
+			if !typedLine(tracker, line, ok) {
+				typed = nil
+			}
+			continue
+		default:
+		}
+		select {
+		case <-done:
+			logrus.Debug("Output logger received done signal")
+			return
+		case line, ok := <-typed:
+			if !typedLine(tracker, line, ok) {
+				typed = nil
+			}
+		case chunk, ok := <-chunks.chunks:
+			if !ok {
+				logrus.Debugf("Output logger: read error: %v", chunks.err)
+				return
+			}
+			if out := tracker.write(chunk); len(out) > 0 {
+				_, _ = w.Write(out)
+			}
+			chunks.release(chunk)
+		}
+	}
+}
+
+// typedLine starts the command for a line typed at the prompt, or ends the
+// running one if the line is a comment. It returns false once no more lines
+// will be typed.
+func typedLine(tracker *tracker, line string, ok bool) bool {
+	if !ok {
+		logrus.Debug("Output logger: cmdCh closed, no more typed lines")
+		return false
+	}
+	if _, _, note := noteLine(line); note {
+		logrus.Debug("Output logger: comment typed, ending command")
+		tracker.finish()
+		return true
+	}
+	logrus.Debug("Output logger: new command detected")
+	tracker.beginTyped()
+	return true
+}
@@ -0,0 +1,163 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer that can be written and read at once.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestPumpOutput_TypedLinesComeFirst(t *testing.T) {
+	session := &Session{}
+	tr := newTracker(session, nil)
+	r, w := io.Pipe()
+	typed := make(chan string, 1)
+	var shown syncBuffer
+	pumped := make(chan struct{})
+	go func() {
+		pumpOutput(r, &shown, tr, typed, nil)
+		close(pumped)
+	}()
+
+	// The shell prints something, which the user sees before typing.
+	print := func(s string) {
+		_, err := w.Write([]byte(s))
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return strings.HasSuffix(shown.String(), s) }, 5*time.Second, time.Millisecond)
+	}
+	// As the StdinInterceptor does, a command is added and signalled
+	// before its line reaches the shell, which echoes the newline at once.
+	enter := func(line string) {
+		if !session.addNote(line) {
+			session.mu.Lock()
+			session.Commands = append(session.Commands, session.newCommand(line))
+			session.mu.Unlock()
+		}
+		typed <- line
+		_, err := w.Write([]byte("\r\n"))
+		require.NoError(t, err)
+	}
+	print("$ ls")
+	enter("ls")
+	print("file1\r\nfile2\r\n$ # then the date")
+	enter("# then the date")
+	print("$ date")
+	enter("date")
+	print("Mon Jan  1\r\n$ ")
+	require.NoError(t, w.Close())
+	<-pumped
+	tr.finish()
+
+	require.Len(t, session.Commands, 2)
+	assert.Equal(t, "file1\nfile2", session.Commands[0].Output)
+	assert.Equal(t, "Mon Jan  1", session.Commands[1].Output)
+	assert.Equal(t, "then the date", session.Commands[1].Note)
+	assert.Equal(t, "$ ls\r\nfile1\r\nfile2\r\n$ # then the date\r\n$ date\r\nMon Jan  1\r\n$ ", shown.String())
+}
+
+func TestPumpOutput_StopsOnDone(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+	done := make(chan struct{})
+	pumped := make(chan struct{})
+	go func() {
+		pumpOutput(r, io.Discard, newTracker(&Session{}, nil), nil, done)
+		close(pumped)
+	}()
+	close(done)
+	select {
+	case <-pumped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pumpOutput still running after done was closed")
+	}
+}
+
+// benchmarkOutput is a command's worth of build output of about size bytes,
+// with colours, between the marks of the shell integration.
+func benchmarkOutput(size int) []byte {
+	var b bytes.Buffer
+	b.WriteString("\x1b]133;A\x07$ \x1b]633;E;make\x07\x1b]133;C\x07")
+	for i := 0; b.Len() < size; i++ {
+		fmt.Fprintf(&b, "\x1b[32m[%5d/99999]\x1b[0m Compiling src/module_%d/handler.go with -O2 -Wall\r\n", i, i%97)
+	}
+	b.WriteString("\x1b]133;D;0\x07")
+	return b.Bytes()
+}
+
+// pumpBytes is the output path as it was before pumpOutput: a byte at a
+// time, written to the terminal one by one.
+func pumpBytes(r io.Reader, w io.Writer, tracker *tracker) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+		if out := tracker.write([]byte{b}); len(out) > 0 {
+			_, _ = w.Write(out)
+		}
+	}
+}
+
+// BenchmarkOutputPath measures the output path from a terminal to the
+// user's, here /dev/null, on 8 MB of output, compared with reading and
+// writing it a byte at a time.
+func BenchmarkOutputPath(b *testing.B) {
+	data := benchmarkOutput(8 << 20)
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	require.NoError(b, err)
+	defer devNull.Close()
+	paths := []struct {
+		name string
+		pump func(r io.Reader, tracker *tracker)
+	}{
+		{"chunked", func(r io.Reader, tracker *tracker) { pumpOutput(r, devNull, tracker, nil, nil) }},
+		{"bytewise", func(r io.Reader, tracker *tracker) { pumpBytes(r, devNull, tracker) }},
+	}
+	for _, path := range paths {
+		b.Run(path.name, func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for range b.N {
+				ptmx, tty, err := pty.Open()
+				if err != nil {
+					b.Skipf("no pty available: %v", err)
+				}
+				go func() {
+					_, _ = tty.Write(data)
+					_ = tty.Close()
+				}()
+				tr := newTracker(&Session{}, nil)
+				path.pump(ptmx, tr)
+				tr.finish()
+				_ = ptmx.Close()
+			}
+		})
+	}
+}
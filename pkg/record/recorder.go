@@ -1,62 +1,146 @@
 package record
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/creack/pty"
 	"github.com/creack/termios/raw"
-	"github.com/ohshell/cli/pkg/api"
+	"github.com/ohshell/cli/pkg/capture"
+	"github.com/ohshell/cli/pkg/cast"
+	"github.com/ohshell/cli/pkg/redact"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/term"
 )
 
 type Command struct {
-	Timestamp time.Time
-	Input     string
-	Output    string
-	Comment   string // parsed from bash comments
-	Redacted  bool
+	Timestamp     time.Time // when the command started
+	EndTime       time.Time // when the next prompt appeared or the shell exited
+	Duration      time.Duration
+	Input         string
+	Output        string // output as rendered on the terminal, without escape sequences
+	StyledOutput  string // Output with colours kept as SGR sequences; only set WithColors
+	Comment       string // trailing comment on the command line, describing the step
+	Title         string // from a ## comment typed before the command
+	Note          string // from the # comments typed before the command
+	Redacted      bool
+	OutputOmitted int                  // bytes of output the capture policy left out
+	OutputFile    string               // file holding the whole output, if it was spilled
+	ExitCode      *int                 // reported by the shell integration; nil if unknown
+	Cwd           string               // working directory the command ran in
+	Host          string               // machine the command ran on, e.g. over ssh
+	User          string               // user the command ran as, e.g. after sudo -i
+	Context       map[string]string    // context variables such as kube-context or AWS_PROFILE
+	Programs      []InteractiveProgram // full-screen programs the command ran, such as vim or less
+
+	id int // identifies the command to the journal
+}
+
+// Failed reports whether the command is known to have exited non-zero.
+func (c Command) Failed() bool {
+	return c.ExitCode != nil && *c.ExitCode != 0
 }
 
 type Session struct {
 	Commands      []Command
 	mu            sync.Mutex
 	SlackThreadTS string
+	StartTime     time.Time
+	EndTime       time.Time
+	ExitCode      int    // exit status of the shell
+	ClosingNote   string // comments typed after the last command
+
+	narrative narrative // comments waiting for the next command
+	lastID    int       // ID of the last command added
+}
+
+// Duration returns how long the session lasted, or zero if it has not ended.
+func (s *Session) Duration() time.Duration {
+	if s.StartTime.IsZero() || s.EndTime.IsZero() {
+		return 0
+	}
+	return s.EndTime.Sub(s.StartTime)
 }
 
 // SessionOption is a functional option for configuring a session.
 type SessionOption func(*sessionConfig)
 
 type sessionConfig struct {
-	slackAudit    bool
-	slackChannel  string
-	token         string
-	slackThreadTS string
+	slackThreadTS   string
+	contextVars     []string
+	redactor        *redact.Redactor
+	capture         *capture.Policy
+	keepColors      bool
+	screenSnapshots bool
+	castOut         io.Writer
+	escapeKey       byte
+	bus             eventBus
+	cols, rows      int      // terminal size, for sessions without one of their own
+	program         string   // recorded instead of $SHELL if set
+	args            []string // arguments to program
+	env             []string // added to the program's environment
+	dir             string   // working directory of the program
 }
 
-// WithSlackAudit enables Slack audit logging for the session.
-func WithSlackAudit(channel, token string) SessionOption {
+// WithCast writes the terminal stream to w as an asciicast v2 recording,
+// with a marker at the start of each command. Output is redacted chunk by
+// chunk, so a secret split across two reads may slip through.
+func WithCast(w io.Writer) SessionOption {
 	return func(cfg *sessionConfig) {
-		cfg.slackAudit = true
-		cfg.slackChannel = channel
-		cfg.token = token
-		ts, err := api.StartSlackAuditThread(channel, token)
-		if err != nil {
-			logrus.WithError(err).Error("Failed to start Slack audit thread")
-			// decide if we should fail hard or just log
-		} else {
-			cfg.slackThreadTS = ts
-		}
+		cfg.castOut = w
+	}
+}
+
+// WithColors keeps the colours of command output in Command.StyledOutput,
+// for exports such as HTML that can show them.
+func WithColors() SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.keepColors = true
+	}
+}
+
+// WithRedactor redacts secrets from command lines and output as they are
+// recorded, so nothing unredacted reaches the session, the audit log or an
+// upload.
+func WithRedactor(r *redact.Redactor) SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.redactor = r
+	}
+}
+
+// redact applies the configured redactor, if any, to s.
+func (cfg *sessionConfig) redact(s string) (string, bool) {
+	if cfg == nil {
+		return s, false
+	}
+	return cfg.redactor.Redact(s)
+}
+
+// WithCapturePolicy limits how much of each command's output is kept, once
+// it has been redacted. Output left out is spilled to the policy's
+// directory, if it has one.
+func WithCapturePolicy(p *capture.Policy) SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.capture = p
+	}
+}
+
+// captureStream starts applying the capture policy to the output of cmd.
+// It returns nil, which keeps everything, if there is no policy.
+func (cfg *sessionConfig) captureStream(cmd Command) *capture.Stream {
+	if cfg == nil {
+		return nil
 	}
+	return cfg.capture.Stream(cmd.Input, fmt.Sprintf("command-%d-*.txt", cmd.id))
 }
 
 // StdinInterceptor now takes a config for side effects
@@ -66,12 +150,34 @@ type StdinInterceptor struct {
 	cmdCh   chan string
 	closed  chan struct{}
 	cfg     *sessionConfig
-	lineBuf []byte // buffer for manual line buffering in raw mode
+	lineBuf []byte      // buffer for manual line buffering in raw mode
+	tracker *tracker    // takes over command detection once shell integration is active
+	hidden  func() bool // reports whether the shell's terminal is reading input without echo
+
+	escapeKey byte      // starts a recording control; see WithEscapeKey
+	escaped   bool      // the escape key was pressed and the action key is next
+	note      []byte    // note being typed after the escape key and a, nil if none
+	paused    bool      // recording is paused
+	notify    io.Writer // shows the controls' messages to the user
 }
 
 func (s *StdinInterceptor) Read(p []byte) (int, error) {
 	logrus.Debug("StdinInterceptor.Read called")
 	n, err := s.reader.Read(p)
+	if n > 0 && s.escapeKey != 0 {
+		n = s.escapes(p[:n])
+	}
+	if n > 0 && s.paused {
+		s.lineBuf = nil
+		return n, err
+	}
+	if n > 0 && s.hidden != nil && s.hidden() {
+		// Keystrokes typed at a no-echo prompt are passwords or passphrases;
+		// forward them to the shell but never record them.
+		logrus.Debug("Terminal echo is off, dropping input")
+		s.lineBuf = nil
+		return n, err
+	}
 	if n > 0 {
 		// Robust line buffering: handle backspace and only append printable characters
 		for i := 0; i < n; i++ {
@@ -105,59 +211,62 @@ func (s *StdinInterceptor) Read(p []byte) (int, error) {
 			}
 			line := s.lineBuf[:idx]
 			s.lineBuf = s.lineBuf[idx+1:]
-			trimmed := strings.TrimSpace(string(line))
-			if trimmed != "" {
-				select {
-				case <-s.closed:
-					return n, io.EOF
-				case s.cmdCh <- trimmed:
-					// Channel was successfully sent to
-				default:
-					// Channel is full or closed, skip this command
-					logrus.Debug("cmdCh is full or closed, skipping command")
-				}
-				s.session.mu.Lock()
-				s.session.Commands = append(s.session.Commands, Command{
-					Timestamp: time.Now(),
-					Input:     trimmed,
-				})
-				s.session.mu.Unlock()
-				// Slack audit side effect
-				if s.cfg != nil && s.cfg.slackAudit {
-					go api.SendSlackAudit(trimmed, s.cfg.slackChannel, s.cfg.token, s.cfg.slackThreadTS)
-				}
+			if !s.emit(strings.TrimSpace(string(line))) {
+				return n, io.EOF
 			}
 		}
 	}
 	// If EOF and buffer has data, flush as a command
 	if err == io.EOF && len(s.lineBuf) > 0 {
-		trimmed := strings.TrimSpace(string(s.lineBuf))
-		if trimmed != "" {
-			select {
-			case <-s.closed:
-				return n, io.EOF
-			case s.cmdCh <- trimmed:
-				// Channel was successfully sent to
-			default:
-				// Channel is full or closed, skip this command
-				logrus.Debug("cmdCh is full or closed, skipping command")
-			}
-			s.session.mu.Lock()
-			s.session.Commands = append(s.session.Commands, Command{
-				Timestamp: time.Now(),
-				Input:     trimmed,
-			})
-			s.session.mu.Unlock()
-			// Slack audit side effect
-			if s.cfg != nil && s.cfg.slackAudit {
-				go api.SendSlackAudit(trimmed, s.cfg.slackChannel, s.cfg.token, s.cfg.slackThreadTS)
-			}
+		if !s.emit(strings.TrimSpace(string(s.lineBuf))) {
+			return n, io.EOF
 		}
 		s.lineBuf = nil // clear buffer
 	}
 	return n, err
 }
 
+// emit records a line typed at the terminal. With shell integration active
+// the line is only kept as a fallback for the shell's own report; otherwise
+// it becomes a new command. It returns false once the session is closed.
+func (s *StdinInterceptor) emit(trimmed string) bool {
+	if trimmed == "" {
+		return true
+	}
+	if s.tracker.isIntegrated() {
+		s.tracker.setTyped(trimmed)
+		return true
+	}
+	trimmed, redacted := s.cfg.redact(trimmed)
+	if s.session.addNote(trimmed) {
+		// Still signal the output logger, which ends the running command.
+		return s.signal(trimmed)
+	}
+	// Append before signalling so the output logger sees the new command.
+	s.session.mu.Lock()
+	cmd := s.session.newCommand(trimmed)
+	cmd.Redacted = redacted
+	s.session.Commands = append(s.session.Commands, cmd)
+	s.session.mu.Unlock()
+	s.cfg.publishCommand(CommandStarted, cmd, true)
+	return s.signal(trimmed)
+}
+
+// signal tells the output logger about a line typed at the prompt. It
+// returns false once the session is closed.
+func (s *StdinInterceptor) signal(trimmed string) bool {
+	select {
+	case <-s.closed:
+		return false
+	case s.cmdCh <- trimmed:
+		// Channel was successfully sent to
+	default:
+		// Channel is full or closed, skip this command
+		logrus.Debug("cmdCh is full or closed, skipping command")
+	}
+	return true
+}
+
 // ContextReader wraps an io.Reader and a context.Context, returning on context cancellation.
 type ContextReader struct {
 	ctx context.Context
@@ -184,149 +293,213 @@ func (cr *ContextReader) Read(p []byte) (int, error) {
 	}
 }
 
-// StartSession records a shell session. Options can enable features like Slack audit.
+// end closes a session once nothing more will be recorded in it.
+func (cfg *sessionConfig) end(session *Session) {
+	session.closeNarrative()
+	session.EndTime = time.Now()
+	cfg.publish(Event{Kind: SessionEnded, Session: session})
+}
+
+// StartSession records a shell session on this process's terminal. Options
+// can enable features like Slack audit.
 func StartSession(opts ...SessionOption) *Session {
-	shell := os.Getenv("SHELL")
-	if shell == "" {
-		shell = "/bin/bash"
+	// The shell runs in ohsh's own terminal, so tmux and screen make no
+	// difference; their panes can also be recorded in place with ohsh pane.
+	if os.Getenv("ZELLIJ") != "" {
+		fmt.Fprintln(os.Stderr, "[ohsh] Warning: Running inside zellij. Command tracking may not work correctly.")
+	}
+	r := NewRecorder(os.Stdin, os.Stdout, opts...)
+	if err := r.Start(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "[ohsh] %v\n", err)
+		return &Session{ExitCode: 1}
+	}
+	defer forwardSignals(r.cmd.Process, r.exited)()
+	return r.Wait()
+}
+
+// outputDrainTimeout is how long the output left after the shell exits is
+// read for.
+const outputDrainTimeout = 250 * time.Millisecond
+
+// Recorder records a shell session run on a terminal of its own: what is
+// typed is read from in and passed on to the shell, and what the shell
+// prints is written to out. When in is a terminal it is put in raw mode for
+// the session and the shell's terminal keeps its size; otherwise the size
+// is set WithTerminalSize.
+type Recorder struct {
+	in  io.Reader
+	out io.Writer
+	cfg *sessionConfig
+
+	session *Session
+	cmd     *exec.Cmd
+	ptmx    *os.File
+	tracker *tracker
+	cancel  context.CancelFunc
+	exited  chan struct{} // closed once the shell has exited
+	done    chan struct{} // closed once the output logger is to stop
+	drained chan struct{} // closed once the output logger has stopped
+	wg      sync.WaitGroup
+	undo    []func() // run once the session is over, last first
+}
+
+// NewRecorder returns a recorder for a session typed on in and shown on
+// out. The shell is $SHELL, or bash, unless set WithCommand.
+func NewRecorder(in io.Reader, out io.Writer, opts ...SessionOption) *Recorder {
+	cfg := &sessionConfig{contextVars: DefaultContextVars, escapeKey: DefaultEscapeKey}
+	for _, opt := range opts {
+		opt(cfg)
 	}
+	return &Recorder{in: in, out: out, cfg: cfg}
+}
 
-	fmt.Fprintln(os.Stderr, "[ohsh notice] Commands entered using shell history (up arrow, CTRL-R, etc.) may not be captured correctly. Only directly typed commands are reliably recorded.\n\r")
+// terminal returns in if it is a terminal.
+func (r *Recorder) terminal() (*os.File, bool) {
+	f, ok := r.in.(*os.File)
+	return f, ok && term.IsTerminal(int(f.Fd()))
+}
 
-	if os.Getenv("ZELLIJ") != "" || os.Getenv("TMUX") != "" || os.Getenv("STY") != "" {
-		fmt.Fprintln(os.Stderr, "[archivist] Warning: Running inside a terminal multiplexer (zellij, tmux, or screen). Command tracking may not work correctly.")
+// Start starts the shell and records it until it exits. Cancelling ctx, or
+// calling Stop, hangs the shell up as closing its terminal would.
+func (r *Recorder) Start(ctx context.Context) error {
+	if r.session != nil {
+		return errors.New("recorder already started")
 	}
+	cfg := r.cfg
+	shell, shellArgs := cfg.command()
+	commandLine := strings.Join(append([]string{shell}, shellArgs...), " ")
 
-	fd := os.Stdin.Fd()
-	if term.IsTerminal(int(fd)) {
-		oldState, err := raw.MakeRaw(os.Stdin.Fd())
+	var shellEnv []string
+	integration, err := setupShellIntegration(shell, shellArgs...)
+	if err != nil {
+		logrus.Debugf("Shell integration unavailable: %v", err)
+		fmt.Fprintf(r.out, "[ohsh notice] Shell integration is not available for %s. Commands entered using shell history (up arrow, CTRL-R, etc.) may not be captured correctly. Only directly typed commands are reliably recorded.\n\r", shellName(shell))
+	} else {
+		r.undo = append(r.undo, integration.cleanup)
+		shellArgs = integration.args
+		shellEnv = integration.env
+		if vars := contextEnvVars(cfg.contextVars); len(vars) > 0 {
+			shellEnv = append(shellEnv, "OHSH_CONTEXT_VARS="+strings.Join(vars, " "))
+		}
+	}
+
+	tty, isTerminal := r.terminal()
+	if isTerminal {
+		oldState, err := raw.MakeRaw(tty.Fd())
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Failed to set terminal to raw mode: %v\n", err)
-			return &Session{}
+			r.cleanup()
+			return fmt.Errorf("failed to set terminal to raw mode: %w", err)
 		}
-		defer raw.TcSetAttr(fd, oldState)
+		r.undo = append(r.undo, func() { _ = raw.TcSetAttr(tty.Fd(), oldState) })
 	}
 
-	logrus.Debugf("Shell command: %s", shell)
+	logrus.Debugf("Shell command: %s %v", shell, shellArgs)
 
-	session := &Session{}
-	cmd := exec.Command(shell)
+	session := &Session{StartTime: time.Now(), SlackThreadTS: cfg.slackThreadTS}
+	cmd := exec.Command(shell, shellArgs...)
+	cmd.Env = append(append(os.Environ(), shellEnv...), cfg.env...)
+	cmd.Dir = cfg.dir
 
 	logrus.Debug("Starting shell process...")
-	ptmx, err := pty.Start(cmd)
+	var size *pty.Winsize
+	switch {
+	case isTerminal:
+		size, _ = pty.GetsizeFull(tty)
+	case cfg.cols > 0 && cfg.rows > 0:
+		size = &pty.Winsize{Cols: uint16(cfg.cols), Rows: uint16(cfg.rows)}
+	}
+	ptmx, err := pty.StartWithSize(cmd, size)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to start shell: %v\n", err)
-		return session
+		r.cleanup()
+		return fmt.Errorf("failed to start shell: %w", err)
 	}
-	defer func() {
+	r.undo = append(r.undo, func() {
 		logrus.Debug("Closing PTY...")
 		_ = ptmx.Close()
-	}()
+	})
 
 	logrus.Debugf("Shell PID: %d", cmd.Process.Pid)
-	fmt.Fprintf(os.Stdout, "🎥 Recording started: %s\n\r", shell)
-	fmt.Fprintf(os.Stdout, "Press Ctrl+D when done to save and exit\n")
-
-	cmdCh := make(chan string, 1)
-	done := make(chan struct{})
+	cfg.start(session)
+	fmt.Fprintf(r.out, "🎥 Recording started: %s\n\r", commandLine)
+	fmt.Fprintf(r.out, "Press Ctrl+D when done to save and exit\n")
+	if cfg.escapeKey != 0 {
+		fmt.Fprintf(r.out, "\rPress %s ? for recording controls (pause, drop last step, add a note)\n", KeyName(cfg.escapeKey))
+	}
 
-	// Apply options to a config
-	cfg := &sessionConfig{}
-	for _, opt := range opts {
-		opt(cfg)
+	tracker := newTracker(session, cfg)
+	if size != nil && size.Cols > 0 && size.Rows > 0 {
+		tracker.setSize(int(size.Cols), int(size.Rows))
+	}
+	tracker.foreground = func() string { return foregroundProcess(ptmx.Fd()) }
+	if cfg.castOut != nil {
+		castCommand := ""
+		if cfg.program != "" {
+			castCommand = commandLine
+		}
+		tracker.cast, err = cast.NewWriter(cfg.castOut, cast.Header{
+			Width:   tracker.cols,
+			Height:  tracker.rows,
+			Command: castCommand,
+			Env:     map[string]string{"SHELL": shell, "TERM": os.Getenv("TERM")},
+		})
+		if err != nil {
+			fmt.Fprintf(r.out, "[ohsh] Failed to start terminal recording: %v\n\r", err)
+		} else {
+			tracker.cast.SetFilter(func(s string) string {
+				s, _ = cfg.redact(s)
+				return s
+			})
+			r.undo = append(r.undo, func() {
+				if err := tracker.cast.Close(); err != nil {
+					fmt.Fprintf(r.out, "[ohsh] Failed to write terminal recording: %v\n\r", err)
+				}
+			})
+		}
 	}
-	session.SlackThreadTS = cfg.slackThreadTS
+	r.session, r.cmd, r.ptmx, r.tracker = session, cmd, ptmx, tracker
+	r.exited = make(chan struct{})
+	r.done = make(chan struct{})
+	r.drained = make(chan struct{})
 
-	// Setup stdin interceptor
+	// Room for a few lines typed while a chunk of output is handled, so no
+	// command boundary is missed.
+	cmdCh := make(chan string, 16)
 	interceptor := &StdinInterceptor{
-		reader:  os.Stdin,
+		reader:  r.in,
 		session: session,
 		cmdCh:   cmdCh,
-		closed:  done,
+		closed:  r.done,
 		cfg:     cfg,
-	}
-
-	var wg sync.WaitGroup
-	wg.Add(2)
+		tracker: tracker,
+		hidden:  func() bool { return inputHidden(ptmx.Fd()) },
 
-	var lastCmdIdxMu sync.Mutex
-	lastCmdIdx := -1
+		escapeKey: cfg.escapeKey,
+		notify:    r.out,
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	ctx, r.cancel = context.WithCancel(ctx)
 	ctxReader := &ContextReader{ctx: ctx, r: interceptor}
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-r.exited:
+		default:
+			logrus.Debug("Recording stopped, hanging up the shell")
+			_ = cmd.Process.Signal(syscall.SIGHUP)
+		}
+	}()
 
+	r.wg.Add(2)
 	// Output logger goroutine
 	go func() {
 		logrus.Debug("Output logger goroutine started")
 		defer func() {
-			wg.Done()
+			tracker.finish()
+			close(r.drained)
+			r.wg.Done()
 			logrus.Debug("Output logger goroutine exiting")
 		}()
-		var outputBuf bytes.Buffer
-		currentCmdIdx := -1
-		ptyReader := bufio.NewReader(ptmx)
-		for {
-			select {
-			case <-done:
-				logrus.Debug("Output logger received done signal")
-				if currentCmdIdx >= 0 {
-					session.mu.Lock()
-					session.Commands[currentCmdIdx].Output = outputBuf.String()
-					session.mu.Unlock()
-				}
-				lastCmdIdxMu.Lock()
-				lastCmdIdx = currentCmdIdx
-				lastCmdIdxMu.Unlock()
-				return
-			case _, ok := <-cmdCh:
-				if !ok {
-					logrus.Debug("Output logger: cmdCh closed, flushing and exiting")
-					if currentCmdIdx >= 0 {
-						session.mu.Lock()
-						session.Commands[currentCmdIdx].Output = outputBuf.String()
-						session.mu.Unlock()
-					}
-					lastCmdIdxMu.Lock()
-					lastCmdIdx = currentCmdIdx
-					lastCmdIdxMu.Unlock()
-					return
-				}
-				logrus.Debug("Output logger: new command detected")
-				if currentCmdIdx >= 0 {
-					session.mu.Lock()
-					session.Commands[currentCmdIdx].Output = outputBuf.String()
-					session.mu.Unlock()
-					outputBuf.Reset()
-				}
-				currentCmdIdx++
-				lastCmdIdxMu.Lock()
-				lastCmdIdx = currentCmdIdx
-				lastCmdIdxMu.Unlock()
-			default:
-				b, err := ptyReader.ReadByte()
-				if err != nil {
-					if err == io.EOF {
-						logrus.Debug("Output logger: ptyReader EOF")
-					}
-					logrus.Debugf("Output logger: ptyReader error: %v", err)
-					if currentCmdIdx >= 0 {
-						session.mu.Lock()
-						session.Commands[currentCmdIdx].Output = outputBuf.String()
-						session.mu.Unlock()
-					}
-					lastCmdIdxMu.Lock()
-					lastCmdIdx = currentCmdIdx
-					lastCmdIdxMu.Unlock()
-					logrus.Debug("Output logger: returning")
-					return
-				}
-				if currentCmdIdx >= 0 {
-					outputBuf.WriteByte(b)
-				}
-				os.Stdout.Write([]byte{b})
-			}
-		}
+		pumpOutput(ptmx, r.out, tracker, cmdCh, r.done)
 	}()
 
 	// Input proxy goroutine
@@ -335,30 +508,67 @@ func StartSession(opts ...SessionOption) *Session {
 		defer func() {
 			logrus.Debug("Input proxy goroutine exiting")
 			logrus.Debug("Closing cmdCh (input proxy)")
-			wg.Done()
+			r.wg.Done()
 			close(cmdCh) // signal no more commands
 		}()
 		_, _ = io.Copy(ptmx, ctxReader)
 		logrus.Debug("Input proxy goroutine finished")
 	}()
 
+	if isTerminal {
+		r.undo = append(r.undo, watchResize(tty, ptmx, tracker))
+	}
+	return nil
+}
+
+// Stop hangs up the shell, which ends the session.
+func (r *Recorder) Stop() {
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+// Wait waits for the shell started by Start to exit and returns the
+// session.
+func (r *Recorder) Wait() *Session {
 	logrus.Debug("Waiting for shell process to exit...")
-	err = cmd.Wait()
+	err := r.cmd.Wait()
+	close(r.exited)
+	r.session.ExitCode = exitStatus(err)
 	logrus.Debugf("Shell process exited with err: %v", err)
+	// What the shell printed just before exiting may not have been read
+	// yet. Background jobs can keep the terminal open, so the logger is
+	// only given a moment to catch up.
+	select {
+	case <-r.drained:
+	case <-time.After(outputDrainTimeout):
+	}
 	logrus.Debug("Closing PTY and cancelling context after shell exit")
-	_ = ptmx.Close()
-	cancel() // cancel context to unblock input proxy
-	close(done)
+	_ = r.ptmx.Close()
+	r.cancel() // cancel context to unblock input proxy
+	close(r.done)
 	logrus.Debug("Waiting for goroutines to finish...")
-	wg.Wait()
+	r.wg.Wait()
+	r.tracker.applyDrops() // the input proxy may have dropped a step last
+	r.cfg.end(r.session)
 
-	lastCmdIdxMu.Lock()
-	if lastCmdIdx >= 0 && lastCmdIdx < len(session.Commands) {
-		// No extra output to flush, but this is where you'd do it if needed
-	}
-	lastCmdIdxMu.Unlock()
+	fmt.Fprintf(r.out, "🛑 Recording ended.\n\r")
+	r.cleanup()
+	return r.session
+}
 
-	fmt.Fprintf(os.Stdout, "🛑 Recording ended.\n\r")
+// Record starts the shell and waits for it to exit.
+func (r *Recorder) Record(ctx context.Context) (*Session, error) {
+	if err := r.Start(ctx); err != nil {
+		return nil, err
+	}
+	return r.Wait(), nil
+}
 
-	return session
+// cleanup undoes what Start set up for the session, last first.
+func (r *Recorder) cleanup() {
+	for i := len(r.undo) - 1; i >= 0; i-- {
+		r.undo[i]()
+	}
+	r.undo = nil
 }
@@ -2,10 +2,16 @@ package record
 
 import (
 	"bytes"
+	"context"
+	"io"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/ohshell/cli/pkg/redact"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -31,37 +37,98 @@ func TestRecorderTestSuite(t *testing.T) {
 
 // TestNewRecorder tests the creation of a new recorder
 func (suite *RecorderTestSuite) TestNewRecorder() {
-	// TODO: Implement test for NewRecorder function
-	// This test should verify that a new recorder is created with proper defaults
-	suite.T().Skip("TODO: Implement NewRecorder test")
+	t := suite.T()
+	t.Setenv("SHELL", "/bin/zsh")
+	r := NewRecorder(strings.NewReader(""), io.Discard)
+	suite.Equal(DefaultContextVars, r.cfg.contextVars)
+	suite.Equal(DefaultEscapeKey, r.cfg.escapeKey)
+	shell, args := r.cfg.command()
+	suite.Equal("/bin/zsh", shell)
+	suite.Empty(args)
+	_, isTerminal := r.terminal()
+	suite.False(isTerminal)
+
+	r = NewRecorder(strings.NewReader(""), io.Discard, WithCommand("/bin/bash", "-l"), WithEscapeKey(0))
+	shell, args = r.cfg.command()
+	suite.Equal("/bin/bash", shell)
+	suite.Equal([]string{"-l"}, args)
+	suite.Zero(r.cfg.escapeKey)
 }
 
 // TestRecorderStart tests starting a recording session
 func (suite *RecorderTestSuite) TestRecorderStart() {
-	// TODO: Implement test for recorder Start method
-	// This test should verify that recording starts properly
-	suite.T().Skip("TODO: Implement Start test")
+	r := NewRecorder(strings.NewReader(""), io.Discard, WithCommand(filepath.Join(suite.T().TempDir(), "no-such-shell")))
+	suite.ErrorContains(r.Start(context.Background()), "failed to start shell")
+
+	user, in := newPipeUser(suite.T())
+	r = user.start(context.Background(), in, user.shown)
+	suite.EqualError(r.Start(context.Background()), "recorder already started")
+	user.enter("exit")
+	session := user.wait(r)
+	suite.Zero(session.ExitCode)
+	suite.False(session.StartTime.IsZero())
+	suite.Contains(user.shown.String(), "🎥 Recording started: ")
 }
 
 // TestRecorderStop tests stopping a recording session
 func (suite *RecorderTestSuite) TestRecorderStop() {
-	// TODO: Implement test for recorder Stop method
-	// This test should verify that recording stops and data is properly captured
-	suite.T().Skip("TODO: Implement Stop test")
+	user, in := newPipeUser(suite.T())
+	r := user.start(context.Background(), in, user.shown)
+	user.enter("echo before")
+	user.enter("echo running; sleep 60")
+	user.waitFor("running\r\n")
+	r.Stop()
+	session := user.wait(r)
+
+	suite.Equal(129, session.ExitCode, "killed by SIGHUP")
+	suite.Require().Len(session.Commands, 2)
+	suite.Equal("before", session.Commands[0].Output)
+	suite.Equal("echo running; sleep 60", session.Commands[1].Input)
+	suite.Nil(session.Commands[1].ExitCode)
+	suite.False(session.EndTime.IsZero())
 }
 
 // TestRecorderCommandCapture tests command capture functionality
 func (suite *RecorderTestSuite) TestRecorderCommandCapture() {
-	// TODO: Implement test for command capture
-	// This test should verify that commands are properly captured during recording
-	suite.T().Skip("TODO: Implement command capture test")
+	user, in := newPipeUser(suite.T())
+	session, err := func() (*Session, error) {
+		r := NewRecorder(in, user.shown, user.opts...)
+		go func() {
+			user.enter("true")
+			user.enter("ls /nonexistent")
+			user.enter("history -c  # keep it tidy")
+			user.enter("exit")
+		}()
+		return r.Record(context.Background())
+	}()
+	suite.Require().NoError(err)
+
+	suite.Require().Len(session.Commands, 4)
+	suite.Equal("true", session.Commands[0].Input)
+	suite.False(session.Commands[0].Failed())
+	suite.Equal("ls /nonexistent", session.Commands[1].Input)
+	suite.True(session.Commands[1].Failed())
+	suite.Equal("history -c", session.Commands[2].Input)
+	suite.Equal("keep it tidy", session.Commands[2].Comment)
+	for _, cmd := range session.Commands[:3] {
+		suite.False(cmd.Timestamp.IsZero(), cmd.Input)
+		suite.False(cmd.EndTime.IsZero(), cmd.Input)
+	}
 }
 
 // TestRecorderOutputCapture tests output capture functionality
 func (suite *RecorderTestSuite) TestRecorderOutputCapture() {
-	// TODO: Implement test for output capture
-	// This test should verify that command output is properly captured
-	suite.T().Skip("TODO: Implement output capture test")
+	user, in := newPipeUser(suite.T())
+	r := user.start(context.Background(), in, user.shown, WithColors())
+	user.enter(`printf '\033[31mred\033[0m\n'; printf 'progress  50%%\rprogress 100%%\n'`)
+	user.enter("seq 1000 | tail -n 2")
+	user.enter("exit")
+	session := user.wait(r)
+
+	suite.Require().Len(session.Commands, 3)
+	suite.Equal("red\nprogress 100%", session.Commands[0].Output)
+	suite.Contains(session.Commands[0].StyledOutput, "\x1b[0;31mred\x1b[0m")
+	suite.Equal("999\n1000", session.Commands[1].Output)
 }
 
 // TestSessionCommandAppend tests that commands are appended to a session correctly
@@ -128,20 +195,102 @@ func (suite *RecorderTestSuite) TestStdinInterceptor_AppendsCommands() {
 	suite.Equal("echo hello", session.Commands[1].Input)
 }
 
-// Example of a simple unit test without the suite
+// TestSessionDuration tests the session duration calculation
+func (suite *RecorderTestSuite) TestSessionDuration() {
+	start := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	session := &Session{StartTime: start}
+	suite.Zero(session.Duration(), "Unfinished session should have no duration")
+
+	session.EndTime = start.Add(90 * time.Second)
+	suite.Equal(90*time.Second, session.Duration())
+}
+
+// TestStdinInterceptor_RedactsCommands tests that typed commands are redacted before they are recorded
+func (suite *RecorderTestSuite) TestStdinInterceptor_RedactsCommands() {
+	session := &Session{}
+	input := "mysql --password=hunter2\nls\n"
+	interceptor := &StdinInterceptor{
+		reader:  bytes.NewBufferString(input),
+		session: session,
+		cmdCh:   make(chan string, 2),
+		closed:  make(chan struct{}),
+		cfg:     &sessionConfig{redactor: redact.New(redact.DefaultRules()...)},
+	}
+	buf := make([]byte, len(input))
+	_, err := interceptor.Read(buf)
+	suite.NoError(err)
+
+	suite.Require().Len(session.Commands, 2)
+	suite.Equal("mysql --password=<redacted-password-1>", session.Commands[0].Input)
+	suite.True(session.Commands[0].Redacted)
+	suite.False(session.Commands[1].Redacted)
+}
+
+// TestStdinInterceptor_DropsHiddenInput tests that input typed while echo is off is never recorded
+func (suite *RecorderTestSuite) TestStdinInterceptor_DropsHiddenInput() {
+	session := &Session{}
+	hidden := false
+	reader := &bytes.Buffer{}
+	interceptor := &StdinInterceptor{
+		reader:  reader,
+		session: session,
+		cmdCh:   make(chan string, 3),
+		closed:  make(chan struct{}),
+		hidden:  func() bool { return hidden },
+	}
+	read := func(input string) {
+		reader.WriteString(input)
+		buf := make([]byte, len(input))
+		n, err := interceptor.Read(buf)
+		suite.NoError(err)
+		suite.Equal(input, string(buf[:n]), "input must still reach the shell")
+	}
+
+	read("sudo ls\r")
+	hidden = true
+	read("hunter2\r")
+	hidden = false
+	read("whoami\r")
+
+	suite.Require().Len(session.Commands, 2)
+	suite.Equal("sudo ls", session.Commands[0].Input)
+	suite.Equal("whoami", session.Commands[1].Input)
+}
+
+// TestStdinInterceptor_CommentsBecomeNarrative tests that comment lines are kept as narrative for the next command
+func (suite *RecorderTestSuite) TestStdinInterceptor_CommentsBecomeNarrative() {
+	session := &Session{}
+	input := "# check the disk first\ndf -h  # root is the one to watch\nls\n"
+	cmdCh := make(chan string, 3)
+	interceptor := &StdinInterceptor{
+		reader:  bytes.NewBufferString(input),
+		session: session,
+		cmdCh:   cmdCh,
+		closed:  make(chan struct{}),
+	}
+	buf := make([]byte, len(input))
+	_, err := interceptor.Read(buf)
+	suite.NoError(err)
+
+	suite.Require().Len(session.Commands, 2)
+	suite.Equal("df -h", session.Commands[0].Input)
+	suite.Equal("root is the one to watch", session.Commands[0].Comment)
+	suite.Equal("check the disk first", session.Commands[0].Note)
+	suite.Empty(session.Commands[1].Note)
+	// The comment is still signalled so the running command ends there.
+	suite.Equal("# check the disk first", <-cmdCh)
+}
+
+// TestRecorderBasicFunctionality tests recording a program that is not a shell
 func TestRecorderBasicFunctionality(t *testing.T) {
-	// TODO: Replace with actual test implementation
-	// This is a placeholder to demonstrate basic test structure
-	t.Skip("TODO: Implement basic functionality test")
-
-	// Example test structure:
-	// // Arrange
-	// recorder := NewRecorder()
-	//
-	// // Act
-	// result := recorder.SomeMethod()
-	//
-	// // Assert
-	// assert.NotNil(t, result)
-	// assert.Equal(t, expectedValue, result.SomeField)
+	var shown syncBuffer
+	r := NewRecorder(strings.NewReader(""), &shown, WithCommand("/bin/sh", "-c", "echo hi; exit 7"), WithTerminalSize(80, 24))
+	session, err := r.Record(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 7, session.ExitCode)
+	assert.Empty(t, session.Commands, "nothing was typed")
+	assert.Contains(t, shown.String(), "Shell integration is not available for sh")
+	assert.Contains(t, shown.String(), "hi\r\n")
+	assert.Contains(t, shown.String(), "Recording ended")
 }
@@ -0,0 +1,88 @@
+package record
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// signalGrace is how long the shell has to exit after a forwarded SIGTERM
+// before it is sent SIGHUP.
+const signalGrace = 3 * time.Second
+
+// watchResize keeps the shell's terminal the same size as ours, telling
+// the tracker about every change. It returns a function that stops it.
+func watchResize(tty, ptmx *os.File, tracker *tracker) (stop func()) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	go func() {
+		for range winch {
+			if err := pty.InheritSize(tty, ptmx); err != nil {
+				logrus.Debugf("Failed to resize PTY: %v", err)
+				continue
+			}
+			cols, rows, err := term.GetSize(int(tty.Fd()))
+			if err != nil || cols <= 0 || rows <= 0 {
+				continue
+			}
+			logrus.Debugf("Terminal resized to %dx%d", cols, rows)
+			tracker.resize(cols, rows)
+		}
+	}()
+	return func() {
+		signal.Stop(winch)
+		close(winch)
+	}
+}
+
+// forwardSignals passes SIGTERM and SIGHUP on to the shell, so that ohsh
+// outlives it and still saves the session. Interactive shells ignore
+// SIGTERM, so a shell still running after signalGrace is sent SIGHUP, as if
+// its terminal had been closed. It returns a function that stops it.
+func forwardSignals(proc *os.Process, exited <-chan struct{}) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range sigs {
+			logrus.Debugf("Forwarding %v to shell", sig)
+			_ = proc.Signal(sig)
+			if sig == syscall.SIGTERM {
+				go func() {
+					select {
+					case <-exited:
+					case <-time.After(signalGrace):
+						_ = proc.Signal(syscall.SIGHUP)
+					}
+				}()
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(sigs)
+	}
+}
+
+// exitStatus converts the result of waiting for the shell into an exit
+// code, using the shell convention of 128+n for a process killed by signal
+// n.
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 1
+	}
+	if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal())
+	}
+	return exitErr.ExitCode()
+}
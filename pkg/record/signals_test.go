@@ -0,0 +1,52 @@
+package record
+
+import (
+	"bufio"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExitStatus(t *testing.T) {
+	assert.Equal(t, 0, exitStatus(exec.Command("true").Run()))
+	assert.Equal(t, 3, exitStatus(exec.Command("sh", "-c", "exit 3").Run()))
+	assert.Equal(t, 128+int(syscall.SIGKILL), exitStatus(exec.Command("sh", "-c", "kill -KILL $$").Run()))
+	assert.Equal(t, 1, exitStatus(exec.ErrNotFound))
+}
+
+func TestForwardSignals(t *testing.T) {
+	// An interactive shell ignores SIGTERM; a subshell with the signal
+	// ignored behaves the same way and only exits on the follow-up SIGHUP.
+	cmd := exec.Command("sh", "-c", "trap '' TERM; echo ready; sleep 30 & wait")
+	stdout, err := cmd.StdoutPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start())
+	_, err = bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	exited := make(chan struct{})
+	stop := forwardSignals(cmd.Process, exited)
+	defer stop()
+
+	start := time.Now()
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	err = cmd.Wait()
+	close(exited)
+	assert.Equal(t, 128+int(syscall.SIGHUP), exitStatus(err))
+	assert.GreaterOrEqual(t, time.Since(start), signalGrace)
+}
+
+func TestTracker_ResizeAppliesOnNextWrite(t *testing.T) {
+	session := &Session{}
+	tr := newTracker(session, nil)
+	tr.write([]byte("\x1b]133;A\x07\x1b]633;E;cat\x07\x1b]133;C\x07"))
+	tr.resize(120, 40)
+	assert.Equal(t, 80, tr.cols)
+	tr.write([]byte("x"))
+	cols, rows := tr.screen.Size()
+	assert.Equal(t, 120, cols)
+	assert.Equal(t, 40, rows)
+}
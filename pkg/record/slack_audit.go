@@ -1,11 +1,62 @@
-//go:build slack_audit
-
 package record
 
-import "github.com/ohshell/cli/pkg/api"
+import (
+	"context"
+	"strings"
+
+	"github.com/ohshell/cli/pkg/api"
+	"github.com/ohshell/cli/pkg/delivery"
+	"github.com/sirupsen/logrus"
+)
+
+// WithSlackAudit enables Slack audit logging for the session.
+func WithSlackAudit(channel, token string) SessionOption {
+	return func(cfg *sessionConfig) {
+		ts, err := api.StartSlackAuditThread(channel, token)
+		if err != nil {
+			// Without a thread there is nowhere to post the commands.
+			logrus.WithError(err).Error("Failed to start Slack audit thread, commands will not be sent to Slack")
+			return
+		}
+		cfg.slackThreadTS = ts
+		WithSubscriber(newSlackAudit(channel, token, ts, delivery.DefaultOptions))(cfg)
+	}
+}
+
+// slackAudit posts the commands of a session to a Slack thread, for the
+// events Event.Audited picks: as each starts, and again with its status.
+// Entries are posted in order, retried if the backend cannot be reached,
+// and all sent before the session ends, so they come before the message
+// completing the thread.
+type slackAudit struct {
+	queue *delivery.Queue[api.SlackAuditCommand]
+}
+
+func newSlackAudit(channel, token, threadTS string, opts delivery.Options) *slackAudit {
+	send := func(ctx context.Context, cmd api.SlackAuditCommand) error {
+		return api.SendSlackAuditCommandContext(ctx, cmd, channel, token, threadTS)
+	}
+	return &slackAudit{queue: delivery.New("the Slack audit log", send, opts)}
+}
 
-func sendSlackAuditIfEnabled(trimmed string, cfg *sessionConfig) {
-	if cfg != nil && cfg.slackAudit {
-		go api.SendSlackAudit(trimmed, cfg.slackChannel, cfg.token, cfg.slackThreadTS)
+func (a *slackAudit) HandleEvent(e Event) {
+	switch {
+	case e.Audited():
+		a.queue.Push(api.SlackAuditCommand{
+			Command:       e.Command.Input,
+			ExecutionTime: e.Command.Timestamp,
+			ExitCode:      e.Command.ExitCode,
+			Event:         e.Kind.String(),
+		})
+	case e.Kind == SessionEnded:
+		undelivered := a.queue.Close(delivery.DefaultFlushTimeout)
+		if len(undelivered) == 0 {
+			return
+		}
+		cmds := make([]string, len(undelivered))
+		for i, cmd := range undelivered {
+			cmds[i] = cmd.Command
+		}
+		logrus.Warnf("Commands not sent to the Slack audit log: %s", strings.Join(cmds, "; "))
 	}
 }
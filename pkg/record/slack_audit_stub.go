@@ -1,5 +0,0 @@
-package record
-
-func sendSlackAuditIfEnabled(trimmed string, cfg *sessionConfig) {
-	// No-op: Slack audit disabled in this build
-}
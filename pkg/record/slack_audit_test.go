@@ -0,0 +1,76 @@
+package record
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ohshell/cli/pkg/delivery"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlackAudit_DeliversInOrderBeforeTheSessionEnds(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	failures := 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case body["command"] == "ls" && failures > 0:
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case body["command"] == "cat forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			got = append(got, body["event"].(string)+" "+body["command"].(string))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("OHSH_API_URL", server.URL)
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	cfg := &sessionConfig{}
+	WithSubscriber(newSlackAudit("#ops", "token", "123.456", delivery.Options{Buffer: 10, Attempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}))(cfg)
+	cfg.publishCommand(CommandFinished, Command{Input: "ls"}, false)
+	cfg.publishCommand(CommandStarted, Command{Input: "cat forbidden"}, true)
+	cfg.publishCommand(CommandStarted, Command{Input: "uptime"}, true)
+	cfg.publishCommand(CommandFinished, Command{Input: "uptime"}, true)
+	cfg.publishCommand(CommandStarted, Command{Input: "bash"}, false)
+	cfg.publishCommand(CommandFinished, Command{Input: "bash"}, false)
+	cfg.publishCommand(CommandUpdated, Command{Input: "bash"}, false)
+	cfg.publishCommand(CommandStarted, Command{Input: "cat .env"}, false)
+	cfg.publishCommand(CommandDropped, Command{Input: "cat .env"}, false)
+	cfg.end(&Session{})
+
+	assert.Equal(t, []string{
+		"command_finished ls",
+		"command_started uptime", "command_finished uptime",
+		"command_started bash", "command_finished bash", "command_updated bash",
+		"command_started cat .env", "command_dropped cat .env",
+	}, got, "typed and integrated commands alike sent as they start and with their status, in order, retried, and before the session ended")
+	require.NotNil(t, hook.LastEntry())
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Equal(t, "Commands not sent to the Slack audit log: cat forbidden", hook.LastEntry().Message)
+}
+
+func TestSlackAudit_NotRetriedWithoutCredentials(t *testing.T) {
+	cfg := &sessionConfig{}
+	WithSlackAudit("#ops", "")(cfg)
+	assert.False(t, cfg.subscribed(), "no thread to post to")
+
+	WithSubscriber(newSlackAudit("#ops", "", "123.456", delivery.DefaultOptions))(cfg)
+	start := time.Now()
+	cfg.publishCommand(CommandFinished, Command{Input: "ls"}, false)
+	cfg.end(&Session{})
+	assert.Less(t, time.Since(start), delivery.DefaultOptions.Backoff, "given up on at once")
+}
@@ -0,0 +1,49 @@
+package record
+
+import (
+	"io"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithTerminalSize sets the size of the terminal the recorded shell writes
+// to, for RecordStream, which has no terminal of its own to ask.
+func WithTerminalSize(cols, rows int) SessionOption {
+	return func(cfg *sessionConfig) {
+		cfg.cols, cfg.rows = cols, rows
+	}
+}
+
+// RecordStream records a session from the output of a shell running
+// elsewhere, such as in a tmux pane, until r ends. The shell must have the
+// hooks from HookCommand loaded: nothing typed into it passes through ohsh,
+// so commands are told apart by the hooks' marks alone.
+func RecordStream(r io.Reader, opts ...SessionOption) *Session {
+	cfg := &sessionConfig{contextVars: DefaultContextVars}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	session := &Session{StartTime: time.Now(), SlackThreadTS: cfg.slackThreadTS}
+	cfg.start(session)
+	tracker := newTracker(session, cfg)
+	if cfg.cols > 0 && cfg.rows > 0 {
+		tracker.setSize(cfg.cols, cfg.rows)
+	}
+	buf := make([]byte, outputChunkSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			tracker.write(buf[:n])
+		}
+		if err != nil {
+			if err != io.EOF {
+				logrus.WithError(err).Debug("Failed to read the recorded stream")
+			}
+			break
+		}
+	}
+	tracker.finish()
+	cfg.end(session)
+	return session
+}
@@ -0,0 +1,29 @@
+package record
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordStream(t *testing.T) {
+	stream := strings.NewReader("$ ls\r\nfile\r\n" +
+		"\x1b]133;D;0\x07\x1b]633;P;Cwd=/srv\x07\x1b]133;A\x07$ " +
+		"\x1b]633;E;echo hi\x07\x1b]133;C\x07hi\r\n\x1b]133;D;0\x07\x1b]133;A\x07$ " +
+		"\x1b]633;E;false\x07\x1b]133;C\x07\x1b]133;D;1\x07\x1b]133;A\x07$ " +
+		"\x1b]633;E;sleep 100\x07\x1b]133;C\x07")
+	session := RecordStream(stream)
+
+	require.Len(t, session.Commands, 3, "output before the hooks are loaded is not a command")
+	assert.Equal(t, "echo hi", session.Commands[0].Input)
+	assert.Equal(t, "hi", session.Commands[0].Output)
+	assert.Equal(t, "/srv", session.Commands[0].Cwd)
+	if assert.NotNil(t, session.Commands[1].ExitCode) {
+		assert.Equal(t, 1, *session.Commands[1].ExitCode)
+	}
+	assert.Equal(t, "sleep 100", session.Commands[2].Input)
+	assert.Nil(t, session.Commands[2].ExitCode, "still running when the stream ended")
+	assert.False(t, session.EndTime.IsZero())
+}
@@ -0,0 +1,19 @@
+package record
+
+import (
+	"syscall"
+
+	"github.com/creack/termios/raw"
+)
+
+// inputHidden reports whether the terminal on fd is reading a line without
+// echoing it back, which is what sudo, ssh and mysql do for passwords. Line
+// editors such as readline switch echo off as well, but they also leave
+// canonical mode and echo the input themselves, so both flags are checked.
+func inputHidden(fd uintptr) bool {
+	t, err := raw.TcGetAttr(fd)
+	if err != nil {
+		return false
+	}
+	return t.Lflag&syscall.ECHO == 0 && t.Lflag&syscall.ICANON != 0
+}
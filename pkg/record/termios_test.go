@@ -0,0 +1,38 @@
+//go:build linux
+
+package record
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/creack/pty"
+	"github.com/creack/termios/raw"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputHidden(t *testing.T) {
+	ptmx, tty, err := pty.Open()
+	if err != nil {
+		t.Skipf("no pty available: %v", err)
+	}
+	defer ptmx.Close()
+	defer tty.Close()
+
+	set := func(on, off uint) {
+		attr, err := raw.TcGetAttr(tty.Fd())
+		require.NoError(t, err)
+		attr.Lflag |= uint32(on)
+		attr.Lflag &^= uint32(off)
+		require.NoError(t, raw.TcSetAttr(tty.Fd(), attr))
+	}
+
+	set(syscall.ECHO|syscall.ICANON, 0)
+	require.False(t, inputHidden(ptmx.Fd()), "cooked mode with echo")
+
+	set(0, syscall.ECHO|syscall.ICANON)
+	require.False(t, inputHidden(ptmx.Fd()), "line editor at a prompt")
+
+	set(syscall.ICANON, syscall.ECHO)
+	require.True(t, inputHidden(ptmx.Fd()), "password prompt")
+}
@@ -0,0 +1,529 @@
+package record
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+
+	"github.com/ohshell/cli/pkg/capture"
+	"github.com/ohshell/cli/pkg/cast"
+	"github.com/ohshell/cli/pkg/vt"
+	"github.com/sirupsen/logrus"
+)
+
+// tracker attributes the shell's output stream to the commands of a
+// session. Once the shell integration reports its first mark, command
+// boundaries and command lines come from the marks. Until then, or for
+// shells without integration, the StdinInterceptor decides from keystrokes
+// and signals each new command on cmdCh. Commands run in a shell nested in
+// the recorded one, such as over ssh, are told apart by its prompt.
+type tracker struct {
+	session *Session
+	cfg     *sessionConfig
+	marks   markParser
+
+	integrated atomic.Bool
+
+	mu    sync.Mutex
+	typed string // last line typed at the prompt, used when no E mark arrives
+	drops []int  // indexes of commands to remove from the session, from dropLast
+
+	paused  atomic.Bool // recording is paused: no commands start and output is ignored
+	entered atomic.Bool // a line was typed since the last one a nested shell echoed
+
+	current     int                  // index of the running command in session.Commands, -1 if none
+	screen      *vt.Screen           // renders the running command's output, or a nested shell's prompt
+	cols, rows  int                  // size of the user's terminal
+	newSize     atomic.Uint64        // cols<<32 | rows from resize, applied by the next write
+	program     *InteractiveProgram  // full-screen program the running command is showing
+	programs    []InteractiveProgram // full-screen programs the running command has shown
+	foreground  func() string        // names the terminal's foreground process
+	cast        *cast.Writer         // records the terminal stream, if enabled
+	cmdline     string               // command line from the last E mark
+	cwd         string               // working directory reported at the last prompt
+	env         map[string]string    // context variables reported at the last prompt
+	host, user  string               // machine and user reported at the last prompt
+	nested      *nestedShell         // shell without hooks started by a command, if any
+	atPrompt    bool                 // the running command's output ends with the next prompt
+	unpublished []byte               // output of the running command not yet published, up to a line end
+	capture     *capture.Stream      // applies the capture policy to the running command's output as it scrolls away
+	captured    bool                 // output handed to capture was redacted
+	clean       []byte               // the chunk being written with its marks removed, set by write
+	attributed  int                  // how much of clean attribute has handed out so far
+}
+
+// maxUnpublished is how much of a line of output is held back from
+// subscribers before it is published without waiting for the line to end.
+const maxUnpublished = 4096
+
+// scrollbackKept is how many lines of the running command's scrollback
+// stay on its screen once older ones are handed to the capture policy:
+// enough for a long command line or prompt wrapped above the cursor.
+const scrollbackKept = 64
+
+func newTracker(session *Session, cfg *sessionConfig) *tracker {
+	return &tracker{session: session, cfg: cfg, current: -1, cols: vt.DefaultCols, rows: vt.DefaultRows}
+}
+
+// setSize sets the terminal size used to render command output.
+func (t *tracker) setSize(cols, rows int) {
+	t.cols, t.rows = cols, rows
+	if t.screen != nil {
+		t.screen.Resize(cols, rows)
+	}
+}
+
+// resize is like setSize but may be called while output is being written,
+// e.g. from a signal handler. The new size applies from the next write.
+func (t *tracker) resize(cols, rows int) {
+	t.newSize.Store(uint64(cols)<<32 | uint64(uint32(rows)))
+	if t.cast != nil {
+		t.cast.Resize(cols, rows)
+	}
+}
+
+// applyResize applies the size last passed to resize, if any.
+func (t *tracker) applyResize() {
+	if size := t.newSize.Swap(0); size != 0 {
+		t.setSize(int(size>>32), int(uint32(size)))
+	}
+}
+
+// setPaused pauses or resumes recording. The command running when
+// recording is paused ends with the output it has so far.
+func (t *tracker) setPaused(paused bool) {
+	if t == nil || t.paused.Swap(paused) == paused {
+		return
+	}
+	if paused {
+		t.cfg.publish(Event{Kind: RecordingPaused})
+	} else {
+		t.cfg.publish(Event{Kind: RecordingResumed})
+	}
+}
+
+// dropLast removes the most recent command from the session and returns
+// it. The removal is applied by the goroutine writing output, which owns
+// the running command, so only the command line is available here.
+func (t *tracker) dropLast() (Command, bool) {
+	if t == nil {
+		return Command{}, false
+	}
+	t.session.mu.Lock()
+	defer t.session.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i := len(t.session.Commands) - 1 - len(t.drops)
+	if i < 0 {
+		return Command{}, false
+	}
+	t.drops = append(t.drops, i)
+	return t.session.Commands[i], true
+}
+
+// steps returns the number of commands in the session, not counting those
+// about to be dropped.
+func (t *tracker) steps() int {
+	if t == nil {
+		return 0
+	}
+	t.session.mu.Lock()
+	defer t.session.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.session.Commands) - len(t.drops)
+}
+
+// applyDrops removes the commands passed to dropLast from the session.
+func (t *tracker) applyDrops() {
+	t.mu.Lock()
+	drops := t.drops
+	t.drops = nil
+	t.mu.Unlock()
+	for _, i := range drops {
+		switch {
+		case i == t.current:
+			t.current = -1
+			t.unpublished = t.unpublished[:0]
+			t.capture.Discard()
+			t.capture, t.captured = nil, false
+			t.screen = nil
+			t.program, t.programs = nil, nil
+		case i < t.current:
+			t.current--
+		}
+		if t.nested != nil {
+			switch {
+			case i == t.nested.parent:
+				t.nested.parent = -1
+			case i < t.nested.parent:
+				t.nested.parent--
+			}
+		}
+		t.session.mu.Lock()
+		if i >= len(t.session.Commands) {
+			t.session.mu.Unlock()
+			continue
+		}
+		dropped := t.session.Commands[i]
+		t.session.Commands = slices.Delete(t.session.Commands, i, i+1)
+		t.session.mu.Unlock()
+		t.cfg.publishCommand(CommandDropped, dropped, !t.integrated.Load())
+	}
+}
+
+// isIntegrated reports whether the shell integration is driving command
+// boundaries.
+func (t *tracker) isIntegrated() bool {
+	return t != nil && t.integrated.Load()
+}
+
+// setTyped remembers the last line typed at the prompt. It is only used as
+// the command line when the shell does not report one itself, or to tell
+// the commands of a nested shell apart.
+func (t *tracker) setTyped(line string) {
+	t.mu.Lock()
+	t.typed = line
+	t.mu.Unlock()
+	t.entered.Store(true)
+}
+
+// takeTyped returns the last line typed at the prompt and forgets it. A line
+// holding control characters, such as the escape sequence of the up arrow
+// recalling a history entry, is not what the shell ran, so none is
+// returned.
+func (t *tracker) takeTyped() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	line := t.typed
+	t.typed = ""
+	if strings.ContainsFunc(line, func(r rune) bool { return r != '\t' && unicode.IsControl(r) }) {
+		return ""
+	}
+	return line
+}
+
+// write feeds a chunk of shell output through the tracker and returns the
+// bytes that should reach the user's terminal, with the marks removed. The
+// returned slice is only valid until the next call.
+func (t *tracker) write(p []byte) []byte {
+	t.applyResize()
+	t.applyDrops()
+	if t.paused.Load() {
+		t.finish()
+	}
+	var marks []mark
+	t.attributed = 0
+	t.clean, marks = t.marks.parse(p, t.clean[:0])
+	for _, mk := range marks {
+		t.attribute(mk.offset)
+		t.handleMark(mk)
+	}
+	t.attribute(len(t.clean))
+	return t.clean
+}
+
+// attribute feeds the cleaned output up to end to the running command's
+// screen and the asciicast recording.
+func (t *tracker) attribute(end int) {
+	if t.paused.Load() {
+		t.attributed = end
+		return
+	}
+	if t.cast != nil && end > t.attributed {
+		t.cast.Output(t.clean[t.attributed:end])
+	}
+	if t.current >= 0 && end > t.attributed && t.cfg.subscribed() {
+		t.unpublished = append(t.unpublished, t.clean[t.attributed:end]...)
+		t.publishOutput(false)
+	}
+	// A line entered in a nested shell is complete once its newline is
+	// echoed.
+	for t.screen != nil && t.nested != nil && t.entered.Load() {
+		i := bytes.IndexByte(t.clean[t.attributed:end], '\n')
+		if i < 0 {
+			break
+		}
+		_, _ = t.screen.Write(t.clean[t.attributed : t.attributed+i])
+		t.attributed += i
+		t.entered.Store(false)
+		t.nestedLine()
+	}
+	if t.screen != nil {
+		_, _ = t.screen.Write(t.clean[t.attributed:end])
+		t.takeScrollback()
+	}
+	t.attributed = end
+}
+
+// takeScrollback hands the running command's output that scrolled well
+// out of view to the capture policy, redacted, so the screen never holds
+// more of a long output than the policy keeps.
+func (t *tracker) takeScrollback() {
+	if t.current < 0 || !t.capture.Cuts() || t.screen.ScrollbackLen() < 2*scrollbackKept {
+		return
+	}
+	keepColors := t.cfg != nil && t.cfg.keepColors
+	lines := t.screen.TakeScrollback(t.screen.ScrollbackLen()-scrollbackKept, keepColors)
+	if len(lines) == 0 {
+		return
+	}
+	texts := make([]string, len(lines))
+	styles := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i], styles[i] = l.Text, l.Styled
+	}
+	// Lines are redacted together, so secrets spanning lines are found.
+	text, redacted := t.cfg.redact(strings.Join(texts, "\n"))
+	styled, styledRedacted := t.cfg.redact(strings.Join(styles, "\n"))
+	t.captured = t.captured || redacted || styledRedacted
+	texts, styles = strings.Split(text, "\n"), strings.Split(styled, "\n")
+	if !keepColors || len(styles) != len(texts) {
+		styles = make([]string, len(texts))
+	}
+	partial := lines[len(lines)-1].Partial
+	for i := range texts {
+		t.capture.Add(texts[i], styles[i], partial && i == len(texts)-1)
+	}
+}
+
+// publishOutput publishes the running command's output held back so far,
+// redacted. Output is published a line at a time, so secrets are redacted
+// whole, unless all is set or the line is too long to hold back.
+func (t *tracker) publishOutput(all bool) {
+	n := len(t.unpublished)
+	if !all && n < maxUnpublished {
+		n = bytes.LastIndexByte(t.unpublished, '\n') + 1
+	}
+	if n == 0 {
+		return
+	}
+	t.session.mu.Lock()
+	id := t.session.Commands[t.current].id
+	t.session.mu.Unlock()
+	output, _ := t.cfg.redact(string(t.unpublished[:n]))
+	t.unpublished = append(t.unpublished[:0], t.unpublished[n:]...)
+	t.cfg.publish(Event{Kind: OutputChunk, ID: id, Output: []byte(output)})
+}
+
+func (t *tracker) handleMark(mk mark) {
+	if !t.integrated.Load() {
+		logrus.Debug("Shell integration active")
+		t.integrated.Store(true)
+		// The first mark is sent before the first prompt, so any lines
+		// typed earlier are still waiting in the shell's input and will be
+		// reported again once it executes them. Comments typed earlier are
+		// kept, as the shell executes nothing for them.
+		t.current = -1
+		t.unpublished = t.unpublished[:0]
+		t.capture.Discard()
+		t.capture, t.captured = nil, false
+		t.screen = nil
+		t.program, t.programs = nil, nil
+		t.session.mu.Lock()
+		typedEarly := slices.Clone(t.session.Commands)
+		t.session.Commands = t.session.Commands[:0]
+		t.session.mu.Unlock()
+		for _, cmd := range typedEarly {
+			t.cfg.publishCommand(CommandDropped, cmd, true)
+		}
+		t.mu.Lock()
+		t.drops = nil
+		t.mu.Unlock()
+	}
+	switch mk.kind {
+	case markCommandLine:
+		t.cmdline = unescapeMarkValue(mk.args)
+	case markCommandStart:
+		input := t.cmdline
+		t.cmdline = ""
+		typed := t.takeTyped()
+		if input == "" {
+			input = typed
+		}
+		t.begin(strings.TrimSpace(input))
+	case markCommandDone:
+		// A line typed at the prompt that ran nothing, such as a comment,
+		// leaves no command running. Anything typed while a command ran
+		// was its input.
+		if typed := t.takeTyped(); t.current < 0 && typed != "" && !t.paused.Load() {
+			typed, _ = t.cfg.redact(typed)
+			t.session.addNote(typed)
+		}
+		var exitCode *int
+		if code, err := strconv.Atoi(mk.args); err == nil {
+			exitCode = &code
+		}
+		if t.nested != nil {
+			t.leaveNested(exitCode)
+		} else {
+			t.complete(exitCode)
+		}
+	case markPromptStart:
+		t.finish()
+	case markProperty:
+		t.setProperty(unescapeMarkValue(mk.args))
+	}
+}
+
+// setProperty records a property reported by the prompt hook. They apply to
+// the commands run from that prompt on.
+func (t *tracker) setProperty(prop string) {
+	key, value, ok := strings.Cut(prop, "=")
+	if !ok {
+		return
+	}
+	switch key {
+	case "Cwd":
+		t.cwd = value
+		return
+	case "Host":
+		t.host = value
+		return
+	case "User":
+		t.user = value
+		return
+	}
+	if name, ok := strings.CutPrefix(key, "Env."); ok {
+		if t.env == nil {
+			t.env = map[string]string{}
+		}
+		t.env[name] = value
+	}
+}
+
+// begin starts a new command reported by the shell integration.
+func (t *tracker) begin(input string) {
+	t.finish()
+	if input == "" || t.paused.Load() {
+		return
+	}
+	logrus.Debugf("Command started: %q", input)
+	var vars map[string]string
+	if t.cfg != nil && t.env != nil {
+		vars = resolveContext(t.cfg.contextVars, t.env)
+	}
+	input, redacted := t.cfg.redact(input)
+	if t.session.addNote(input) {
+		// Shells without interactive comments run comment lines.
+		return
+	}
+	t.session.mu.Lock()
+	cmd := t.session.newCommand(input)
+	cmd.Redacted = redacted
+	cmd.Cwd = t.cwd
+	cmd.Context = vars
+	cmd.Host, cmd.User = t.host, t.user
+	if t.nested != nil {
+		// The nested shell reports neither its directory nor variables.
+		cmd.Cwd, cmd.Context = "", nil
+		cmd.Host, cmd.User = t.nested.host, t.nested.user
+	}
+	t.session.Commands = append(t.session.Commands, cmd)
+	t.current = len(t.session.Commands) - 1
+	t.session.mu.Unlock()
+	t.capture = t.cfg.captureStream(cmd)
+	t.cfg.publishCommand(CommandStarted, cmd, false)
+	if host, user, ok := nestedShellCommand(input); ok {
+		t.enterNested(host, user)
+	}
+	t.screen = t.newScreen()
+	if t.cast != nil {
+		t.cast.Marker(cmd.Input)
+	}
+}
+
+// beginTyped switches output attribution to the command the
+// StdinInterceptor just appended to the session.
+func (t *tracker) beginTyped() {
+	t.applyResize()
+	t.applyDrops()
+	t.finish()
+	t.session.mu.Lock()
+	t.current = len(t.session.Commands) - 1
+	cmd := t.session.Commands[t.current]
+	t.session.mu.Unlock()
+	t.capture = t.cfg.captureStream(cmd)
+	t.screen = t.newScreen()
+	if t.cast != nil {
+		t.cast.Marker(cmd.Input)
+	}
+}
+
+// finish stores the output collected for the running command, if any.
+func (t *tracker) finish() {
+	t.complete(nil)
+}
+
+// complete ends the running command with the given exit status, which is
+// nil when the shell did not report one.
+func (t *tracker) complete(exitCode *int) {
+	if t.current < 0 {
+		return
+	}
+	if t.screen.AltScreen() {
+		// The program never left the alternate screen, e.g. it was killed.
+		t.exitProgram()
+	}
+	t.publishOutput(true)
+	output, styled := t.render()
+	output, redacted := t.cfg.redact(output)
+	styled, styledRedacted := t.cfg.redact(styled)
+	// Output left out is spilled to disk without holding up the session.
+	output, styled, omitted, path, err := t.capture.Finish(exitCode, output, styled)
+	if err != nil {
+		logrus.WithError(err).Debug("Failed to spill command output")
+	}
+	t.session.mu.Lock()
+	cmd := &t.session.Commands[t.current]
+	cmd.Output = output
+	cmd.StyledOutput = styled
+	cmd.OutputOmitted = omitted
+	cmd.OutputFile = path
+	cmd.Programs = t.programs
+	cmd.Redacted = cmd.Redacted || redacted || styledRedacted || t.captured
+	cmd.ExitCode = exitCode
+	cmd.EndTime = time.Now()
+	if !cmd.Timestamp.IsZero() {
+		cmd.Duration = cmd.EndTime.Sub(cmd.Timestamp)
+	}
+	finished := *cmd
+	t.session.mu.Unlock()
+	t.capture, t.captured = nil, false
+	t.screen = nil
+	t.programs = nil
+	t.current = -1
+	t.atPrompt = false
+	t.cfg.publishCommand(CommandFinished, finished, !t.integrated.Load())
+}
+
+// render returns the running command's output as plain text and, if the
+// session keeps colours, as styled text.
+func (t *tracker) render() (string, string) {
+	output := t.screen.Text()
+	var styled string
+	if t.cfg != nil && t.cfg.keepColors {
+		styled = t.screen.StyledText()
+	}
+	if !t.integrated.Load() || t.atPrompt {
+		// Keystroke-detected commands, and those of nested shells, start
+		// before the shell echoes the newline and end once the next
+		// command line has been typed at the prompt, which is the last
+		// line of the output.
+		output, styled = trimPrompt(output), trimPrompt(styled)
+	}
+	return strings.Trim(output, "\n"), strings.Trim(styled, "\n")
+}
+
+// trimPrompt removes the last line of s.
+func trimPrompt(s string) string {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return ""
+}
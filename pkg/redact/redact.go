@@ -0,0 +1,144 @@
+// Package redact finds secrets in recorded commands and output and replaces
+// them with stable placeholders before anything leaves the machine.
+package redact
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Rule is a named pattern whose matches are replaced by a placeholder.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Group selects the submatch holding the secret; 0 replaces the whole
+	// match. This keeps context such as "password=" readable.
+	Group int
+	// MinEntropy, if set, only redacts matches with at least this many bits
+	// of Shannon entropy per character.
+	MinEntropy float64
+}
+
+// DefaultRules returns the built-in detectors.
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: "private-key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----`)},
+		{Name: "aws-access-key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[0-9A-Z]{16}\b`)},
+		{Name: "aws-secret-key", Pattern: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[=:]\s*["']?([A-Za-z0-9/+=]{40})`), Group: 1},
+		{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{5,}\.eyJ[A-Za-z0-9_-]{5,}\.[A-Za-z0-9_-]{5,}`)},
+		{Name: "github-token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+		{Name: "slack-token", Pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+		{Name: "bearer-token", Pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/=-]{8,})`), Group: 1},
+		{Name: "url-credentials", Pattern: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:([^/\s@]+)@`), Group: 1},
+		{Name: "password", Pattern: regexp.MustCompile(`(?i)(?:password|passwd|pwd|secret|token|api[_-]?key)["']?\s*[=:]\s*["']?([^\s"'&;,]+)`), Group: 1},
+		{Name: "high-entropy", Pattern: regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`), MinEntropy: 4.3},
+	}
+}
+
+// CustomRule compiles a user-supplied regular expression. If the pattern
+// has capture groups, only the first group is redacted.
+func CustomRule(name, pattern string) (Rule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+	}
+	rule := Rule{Name: name, Pattern: re}
+	if re.NumSubexp() > 0 {
+		rule.Group = 1
+	}
+	return rule, nil
+}
+
+// Redactor replaces secrets with placeholders such as
+// <redacted-aws-access-key-1>. The same secret always maps to the same
+// placeholder, so a document stays readable where a key is used twice, and
+// the placeholder syntax matches the one `ohsh run` prompts for.
+type Redactor struct {
+	rules []Rule
+
+	mu     sync.Mutex
+	seen   map[string]string // secret -> placeholder
+	counts map[string]int    // rule name -> placeholders handed out
+}
+
+// New returns a Redactor applying rules in order.
+func New(rules ...Rule) *Redactor {
+	return &Redactor{
+		rules:  rules,
+		seen:   map[string]string{},
+		counts: map[string]int{},
+	}
+}
+
+// Redact returns s with every secret replaced, and whether anything was.
+func (r *Redactor) Redact(s string) (string, bool) {
+	if r == nil || s == "" {
+		return s, false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	redacted := false
+	for _, rule := range r.rules {
+		matches := rule.Pattern.FindAllStringSubmatchIndex(s, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		var sb strings.Builder
+		last := 0
+		for _, m := range matches {
+			start, end := m[2*rule.Group], m[2*rule.Group+1]
+			if start < 0 {
+				continue
+			}
+			secret := s[start:end]
+			if strings.HasPrefix(secret, "<redacted-") {
+				// Already replaced by an earlier rule, as with the
+				// provider token in GITHUB_TOKEN=ghp_….
+				continue
+			}
+			if rule.MinEntropy > 0 && entropy(secret) < rule.MinEntropy {
+				continue
+			}
+			sb.WriteString(s[last:start])
+			sb.WriteString(r.placeholder(rule.Name, secret))
+			last = end
+			redacted = true
+		}
+		sb.WriteString(s[last:])
+		s = sb.String()
+	}
+	return s, redacted
+}
+
+func (r *Redactor) placeholder(rule, secret string) string {
+	if p, ok := r.seen[secret]; ok {
+		return p
+	}
+	r.counts[rule]++
+	p := fmt.Sprintf("<redacted-%s-%d>", rule, r.counts[rule])
+	r.seen[secret] = p
+	return p
+}
+
+// entropy returns the Shannon entropy of s in bits per character.
+func entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	freq := map[rune]float64{}
+	n := 0.0
+	for _, c := range s {
+		freq[c]++
+		n++
+	}
+	var h float64
+	for _, count := range freq {
+		p := count / n
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,290 @@
+// Package replay plays back a terminal recording on a terminal, with
+// controls for speed, pausing, seeking and jumping between steps.
+package replay
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ohshell/cli/pkg/cast"
+)
+
+// Control is a playback command, usually read from the keyboard with Keys.
+type Control int
+
+const (
+	TogglePause Control = iota
+	SeekForward
+	SeekBackward
+	NextStep
+	PrevStep
+	SpeedUp
+	SlowDown
+	Quit
+)
+
+// seekStep is how far SeekForward and SeekBackward move.
+const seekStep = 5 * time.Second
+
+// clearScreen leaves any alternate screen, resets colours and clears the
+// terminal before the recording is redrawn from the start.
+const clearScreen = "\x1b[0m\x1b[?1049l\x1b[H\x1b[2J\x1b[3J"
+
+// Options control playback.
+type Options struct {
+	Speed     float64       // playback speed multiplier; 1 if zero
+	IdleLimit time.Duration // pauses between events are shortened to this; 0 keeps them
+	Step      int           // step to start at, counting from 1; 0 starts at the beginning
+}
+
+// Player plays back the output and marker events of a recording. Markers
+// are the boundaries of the recorded commands, which are its steps.
+type Player struct {
+	out    io.Writer
+	events []cast.Event
+	steps  []time.Duration // time of each marker
+	speed  float64
+	start  int
+
+	now    time.Duration // position in the recording
+	next   int           // index of the next event to play
+	paused bool
+}
+
+// New returns a player writing to out.
+func New(events []cast.Event, out io.Writer, opts Options) *Player {
+	p := &Player{out: out, speed: opts.Speed, start: opts.Step}
+	if p.speed <= 0 {
+		p.speed = 1
+	}
+	var prev, shift time.Duration
+	for _, e := range events {
+		if e.Type != cast.EventOutput && e.Type != cast.EventMarker {
+			continue
+		}
+		if gap := e.Time - prev; opts.IdleLimit > 0 && gap > opts.IdleLimit {
+			shift += gap - opts.IdleLimit
+		}
+		prev = e.Time
+		e.Time -= shift
+		p.events = append(p.events, e)
+		if e.Type == cast.EventMarker {
+			p.steps = append(p.steps, e.Time)
+		}
+	}
+	return p
+}
+
+// Steps returns the number of steps in the recording.
+func (p *Player) Steps() int {
+	return len(p.steps)
+}
+
+// Duration returns the length of the recording after idle compression.
+func (p *Player) Duration() time.Duration {
+	if len(p.events) == 0 {
+		return 0
+	}
+	return p.events[len(p.events)-1].Time
+}
+
+// Play plays the recording until it ends, ctx is cancelled or Quit is
+// received on controls. controls may be nil.
+func (p *Player) Play(ctx context.Context, controls <-chan Control) error {
+	if p.start > 0 {
+		if p.start > len(p.steps) {
+			return fmt.Errorf("step %d does not exist, the recording has %d steps", p.start, len(p.steps))
+		}
+		p.seek(p.steps[p.start-1])
+	}
+	for p.next < len(p.events) {
+		var timer *time.Timer
+		var fire <-chan time.Time
+		waitStart := time.Now()
+		if !p.paused {
+			wait := time.Duration(float64(p.events[p.next].Time-p.now) / p.speed)
+			timer = time.NewTimer(max(wait, 0))
+			fire = timer.C
+		}
+		select {
+		case <-ctx.Done():
+			stop(timer)
+			return ctx.Err()
+		case <-fire:
+			p.now = p.events[p.next].Time
+			p.play(p.events[p.next])
+			p.next++
+		case c, ok := <-controls:
+			stop(timer)
+			if !ok {
+				controls = nil
+				continue
+			}
+			if !p.paused {
+				elapsed := time.Duration(float64(time.Since(waitStart)) * p.speed)
+				p.now = min(p.now+elapsed, p.events[p.next].Time)
+			}
+			if c == Quit {
+				return nil
+			}
+			p.control(c)
+		}
+	}
+	return nil
+}
+
+func stop(t *time.Timer) {
+	if t != nil {
+		t.Stop()
+	}
+}
+
+func (p *Player) control(c Control) {
+	switch c {
+	case TogglePause:
+		p.paused = !p.paused
+		p.status()
+	case SeekForward:
+		p.seek(p.now + seekStep)
+	case SeekBackward:
+		p.seek(p.now - seekStep)
+	case NextStep:
+		for _, t := range p.steps {
+			if t > p.now {
+				p.seek(t)
+				break
+			}
+		}
+	case PrevStep:
+		// Go to the start of the current step, or of the previous one when
+		// already at the start.
+		target := time.Duration(0)
+		for _, t := range p.steps {
+			if t < p.now-time.Second/2 {
+				target = t
+			}
+		}
+		p.seek(target)
+	case SpeedUp:
+		p.speed = min(p.speed*2, 64)
+		p.status()
+	case SlowDown:
+		p.speed = max(p.speed/2, 1.0/16)
+		p.status()
+	}
+}
+
+// seek moves playback to t, redrawing the recording from the start when
+// going backwards.
+func (p *Player) seek(t time.Duration) {
+	t = max(t, 0)
+	var sb strings.Builder
+	if t < p.now {
+		sb.WriteString(clearScreen)
+		p.next = 0
+	}
+	// Include the events at t itself, such as the marker a step starts at.
+	for p.next < len(p.events) && p.events[p.next].Time <= t {
+		if e := p.events[p.next]; e.Type == cast.EventOutput {
+			sb.WriteString(e.Data)
+		}
+		p.next++
+	}
+	p.now = t
+	_, _ = io.WriteString(p.out, sb.String())
+	p.status()
+}
+
+func (p *Player) play(e cast.Event) {
+	if e.Type == cast.EventMarker {
+		p.status()
+		return
+	}
+	_, _ = io.WriteString(p.out, e.Data)
+}
+
+// step returns the step playing at the current position, counting from 1,
+// or 0 before the first step.
+func (p *Player) step() int {
+	n := 0
+	for i, t := range p.steps {
+		if t <= p.now {
+			n = i + 1
+		}
+	}
+	return n
+}
+
+// status shows the playback state in the terminal's title, where it does
+// not disturb the recording being played.
+func (p *Player) status() {
+	state := "playing"
+	if p.paused {
+		state = "paused"
+	}
+	title := fmt.Sprintf("ohsh replay: step %d/%d, %s at %gx", p.step(), len(p.steps), state, p.speed)
+	_, _ = io.WriteString(p.out, "\x1b]2;"+title+"\x07")
+}
+
+// Keys reads key presses from r and sends the matching controls until r
+// returns an error:
+//
+//	space         pause and resume
+//	right, l      seek forward 5s
+//	left, h       seek back 5s
+//	n, ]          next step
+//	p, [          previous step (or start of the current one)
+//	+, =          double the speed
+//	-             halve the speed
+//	q, Ctrl-C     quit
+func Keys(r io.Reader, controls chan<- Control) {
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		for _, c := range parseKeys(buf[:n]) {
+			controls <- c
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func parseKeys(b []byte) []Control {
+	var controls []Control
+	for len(b) > 0 {
+		switch {
+		case strings.HasPrefix(string(b), "\x1b[C"), strings.HasPrefix(string(b), "\x1bOC"):
+			controls = append(controls, SeekForward)
+			b = b[3:]
+			continue
+		case strings.HasPrefix(string(b), "\x1b[D"), strings.HasPrefix(string(b), "\x1bOD"):
+			controls = append(controls, SeekBackward)
+			b = b[3:]
+			continue
+		}
+		switch b[0] {
+		case ' ':
+			controls = append(controls, TogglePause)
+		case 'l':
+			controls = append(controls, SeekForward)
+		case 'h':
+			controls = append(controls, SeekBackward)
+		case 'n', ']':
+			controls = append(controls, NextStep)
+		case 'p', '[':
+			controls = append(controls, PrevStep)
+		case '+', '=':
+			controls = append(controls, SpeedUp)
+		case '-':
+			controls = append(controls, SlowDown)
+		case 'q', 0x03:
+			controls = append(controls, Quit)
+		}
+		b = b[1:]
+	}
+	return controls
+}
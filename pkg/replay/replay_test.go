@@ -0,0 +1,95 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/ohshell/cli/pkg/cast"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var titles = regexp.MustCompile("\x1b]2;[^\x07]*\x07")
+
+func events() []cast.Event {
+	return []cast.Event{
+		{Time: 0, Type: cast.EventOutput, Data: "$ "},
+		{Time: 10 * time.Millisecond, Type: cast.EventMarker, Data: "ls"},
+		{Time: 10 * time.Millisecond, Type: cast.EventOutput, Data: "ls\r\nfile\r\n$ "},
+		{Time: 20 * time.Millisecond, Type: cast.EventResize, Data: "100x30"},
+		{Time: time.Hour, Type: cast.EventMarker, Data: "pwd"},
+		{Time: time.Hour, Type: cast.EventOutput, Data: "pwd\r\n/tmp\r\n"},
+		{Time: time.Hour + 10*time.Millisecond, Type: cast.EventOutput, Data: "$ "},
+	}
+}
+
+func TestPlayer_PlaysWithIdleCompression(t *testing.T) {
+	var out bytes.Buffer
+	p := New(events(), &out, Options{IdleLimit: 20 * time.Millisecond})
+	assert.Equal(t, 2, p.Steps())
+	assert.Equal(t, 40*time.Millisecond, p.Duration())
+
+	start := time.Now()
+	require.NoError(t, p.Play(context.Background(), nil))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, "$ ls\r\nfile\r\n$ pwd\r\n/tmp\r\n$ ", titles.ReplaceAllString(out.String(), ""))
+	assert.Contains(t, out.String(), "ohsh replay: step 2/2, playing at 1x")
+}
+
+func TestPlayer_StartsAtStep(t *testing.T) {
+	var out bytes.Buffer
+	p := New(events(), &out, Options{Speed: 1000, Step: 2})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, p.Play(ctx, nil))
+	// Everything up to step 2 is drawn at once, then it plays on.
+	assert.Equal(t, "$ ls\r\nfile\r\n$ pwd\r\n/tmp\r\n$ ", titles.ReplaceAllString(out.String(), ""))
+
+	err := New(events(), &out, Options{Step: 3}).Play(ctx, nil)
+	assert.EqualError(t, err, "step 3 does not exist, the recording has 2 steps")
+}
+
+func TestPlayer_Controls(t *testing.T) {
+	var out bytes.Buffer
+	p := New(events(), &out, Options{})
+	controls := make(chan Control, 4)
+	controls <- NextStep // jumps to ls
+	controls <- NextStep // jumps over the hour of idle time to pwd
+	controls <- PrevStep // already at the start of pwd, so back to ls
+	controls <- Quit
+
+	done := make(chan error)
+	go func() { done <- p.Play(context.Background(), controls) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay did not quit")
+	}
+
+	plain := titles.ReplaceAllString(out.String(), "")
+	assert.Equal(t, "$ ls\r\nfile\r\n$ pwd\r\n/tmp\r\n"+clearScreen+"$ ls\r\nfile\r\n$ ", plain)
+	assert.Equal(t, 1, p.step())
+}
+
+func TestPlayer_PauseAndSpeed(t *testing.T) {
+	p := New(events(), &bytes.Buffer{}, Options{})
+	p.control(TogglePause)
+	assert.True(t, p.paused)
+	p.control(SpeedUp)
+	p.control(SpeedUp)
+	assert.Equal(t, 4.0, p.speed)
+	p.control(SlowDown)
+	assert.Equal(t, 2.0, p.speed)
+	p.control(TogglePause)
+	assert.False(t, p.paused)
+}
+
+func TestParseKeys(t *testing.T) {
+	assert.Equal(t,
+		[]Control{TogglePause, SeekForward, SeekBackward, NextStep, PrevStep, SpeedUp, SlowDown, SeekForward, Quit},
+		parseKeys([]byte(" \x1b[C\x1b[Dnp+-lq")))
+}
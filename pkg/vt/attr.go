@@ -0,0 +1,132 @@
+package vt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// color is a foreground or background colour: 0 is the terminal default,
+// 1-256 are palette indexes offset by one and colorRGB|rgb is a 24-bit
+// colour.
+type color uint32
+
+const colorRGB color = 1 << 24
+
+// Text attribute flags.
+const (
+	attrBold uint16 = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrReverse
+	attrHidden
+	attrStrike
+)
+
+// attr is the graphic rendition of a cell.
+type attr struct {
+	fg, bg color
+	flags  uint16
+}
+
+// apply updates a from the parameters of an SGR (CSI ... m) sequence.
+func (a *attr) apply(args []int) {
+	if len(args) == 0 {
+		*a = attr{}
+		return
+	}
+	for i := 0; i < len(args); i++ {
+		switch n := args[i]; {
+		case n == 0:
+			*a = attr{}
+		case n >= 1 && n <= 9:
+			a.flags |= [...]uint16{attrBold, attrDim, attrItalic, attrUnderline, attrBlink, attrBlink, attrReverse, attrHidden, attrStrike}[n-1]
+		case n == 21 || n == 22:
+			a.flags &^= attrBold | attrDim
+		case n == 23:
+			a.flags &^= attrItalic
+		case n == 24:
+			a.flags &^= attrUnderline
+		case n == 25:
+			a.flags &^= attrBlink
+		case n == 27:
+			a.flags &^= attrReverse
+		case n == 28:
+			a.flags &^= attrHidden
+		case n == 29:
+			a.flags &^= attrStrike
+		case n >= 30 && n <= 37:
+			a.fg = color(n-30) + 1
+		case n == 38:
+			var c color
+			c, i = extendedColor(args, i)
+			a.fg = c
+		case n == 39:
+			a.fg = 0
+		case n >= 40 && n <= 47:
+			a.bg = color(n-40) + 1
+		case n == 48:
+			var c color
+			c, i = extendedColor(args, i)
+			a.bg = c
+		case n == 49:
+			a.bg = 0
+		case n >= 90 && n <= 97:
+			a.fg = color(n-90+8) + 1
+		case n >= 100 && n <= 107:
+			a.bg = color(n-100+8) + 1
+		}
+	}
+}
+
+// extendedColor parses the 256-colour (5;n) or 24-bit (2;r;g;b) form that
+// follows an SGR 38 or 48 at args[i]. It returns the colour and the index
+// of the last parameter consumed.
+func extendedColor(args []int, i int) (color, int) {
+	if i+1 >= len(args) {
+		return 0, i
+	}
+	switch args[i+1] {
+	case 5:
+		if i+2 < len(args) {
+			return color(args[i+2]&0xff) + 1, i + 2
+		}
+	case 2:
+		if i+4 < len(args) {
+			rgb := (args[i+2]&0xff)<<16 | (args[i+3]&0xff)<<8 | args[i+4]&0xff
+			return colorRGB | color(rgb), i + 4
+		}
+	}
+	return 0, len(args)
+}
+
+// sgr returns the escape sequence that sets exactly this rendition.
+func (a attr) sgr() string {
+	var sb strings.Builder
+	sb.WriteString("\x1b[0")
+	for i, code := range []string{"1", "2", "3", "4", "5", "7", "8", "9"} {
+		if a.flags&(1<<i) != 0 {
+			sb.WriteString(";" + code)
+		}
+	}
+	writeColor(&sb, a.fg, 30, 90, 38)
+	writeColor(&sb, a.bg, 40, 100, 48)
+	sb.WriteByte('m')
+	return sb.String()
+}
+
+func writeColor(sb *strings.Builder, c color, base, bright, extended int) {
+	switch {
+	case c == 0:
+	case c&colorRGB != 0:
+		rgb := int(c &^ colorRGB)
+		sb.WriteString(";" + strconv.Itoa(extended) + ";2;" + strconv.Itoa(rgb>>16) + ";" + strconv.Itoa(rgb>>8&0xff) + ";" + strconv.Itoa(rgb&0xff))
+	case c <= 8:
+		sb.WriteString(";" + strconv.Itoa(base+int(c)-1))
+	case c <= 16:
+		sb.WriteString(";" + strconv.Itoa(bright+int(c)-9))
+	default:
+		sb.WriteString(";" + strconv.Itoa(extended) + ";5;" + strconv.Itoa(int(c)-1))
+	}
+}
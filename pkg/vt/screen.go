@@ -0,0 +1,718 @@
+// Package vt implements enough of an xterm-compatible screen to turn the
+// raw output of a terminal program into the text a person would have seen:
+// cursor movement, carriage returns, erases and scrolling are applied, so
+// progress bars collapse to their final state and redraws don't repeat.
+package vt
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// Size used when the real terminal size is unknown.
+const (
+	DefaultCols = 80
+	DefaultRows = 24
+)
+
+// maxSeqLen bounds how much of a control sequence is buffered before it is
+// abandoned.
+const maxSeqLen = 256
+
+// Screen is a virtual terminal. Lines that scroll off the top of the primary
+// screen are kept as scrollback, so Text returns everything the program
+// printed, not only the last screenful.
+type Screen struct {
+	cols, rows int
+
+	lines      []line // visible screen, always rows long
+	scrollback []line
+
+	x, y     int
+	wrapNext bool // cursor is past the last column; the next rune wraps
+	autowrap bool
+	attr     attr
+	saved    cursor
+
+	top, bottom int // scroll region, inclusive
+
+	alt        bool   // alternate screen is active
+	primary    []line // primary screen while the alternate one is shown
+	altSaved   cursor // cursor to restore when leaving the alternate screen
+	OnAltEnter func() // called after switching to the alternate screen
+	OnAltExit  func() // called before switching back to the primary screen
+
+	state   parseState
+	seq     []byte // parameters of the sequence being parsed
+	pending []byte // incomplete UTF-8 sequence
+}
+
+type cursor struct {
+	x, y int
+	attr attr
+}
+
+type line struct {
+	cells   []cell
+	wrapped bool // the line was soft-wrapped and continues on the next one
+}
+
+type cell struct {
+	r rune // 0 for a blank cell, -1 for the second half of a wide rune
+	a attr
+}
+
+type parseState int
+
+const (
+	stateGround parseState = iota
+	stateEscape
+	stateEscapeSkip // ESC followed by an intermediate byte: skip the final byte
+	stateCSI
+	stateString    // OSC, DCS, SOS, PM and APC, terminated by BEL or ST
+	stateStringEsc // ESC seen inside a string
+)
+
+// New returns a blank screen of the given size. Sizes below 2x1 are raised
+// to that minimum.
+func New(cols, rows int) *Screen {
+	s := &Screen{autowrap: true}
+	s.cols, s.rows = max(cols, 2), max(rows, 1)
+	s.lines = make([]line, s.rows)
+	s.bottom = s.rows - 1
+	return s
+}
+
+// Size returns the number of columns and rows of the screen.
+func (s *Screen) Size() (cols, rows int) {
+	return s.cols, s.rows
+}
+
+// Resize changes the size of the screen. Content is not reflowed; when the
+// screen gets shorter, lines above the cursor move to the scrollback. The
+// primary screen is resized the same way while the alternate one is shown.
+func (s *Screen) Resize(cols, rows int) {
+	cols, rows = max(cols, 2), max(rows, 1)
+	toScrollback := func(l line) { s.scrollback = append(s.scrollback, l) }
+	if s.alt {
+		s.lines, s.y = fitLines(s.lines, s.y, rows, nil)
+		s.primary, s.altSaved.y = fitLines(s.primary, s.altSaved.y, rows, toScrollback)
+		s.altSaved.x, s.altSaved.y = min(s.altSaved.x, cols-1), clamp(s.altSaved.y, 0, rows-1)
+	} else {
+		s.lines, s.y = fitLines(s.lines, s.y, rows, toScrollback)
+	}
+	s.cols, s.rows = cols, rows
+	s.top, s.bottom = 0, rows-1
+	s.x, s.y = min(s.x, cols-1), clamp(s.y, 0, rows-1)
+	s.wrapNext = false
+}
+
+// fitLines makes lines rows long, with the cursor on row y, and returns
+// them with the cursor's new row. Blank lines below the cursor are dropped
+// first, then lines scroll off the top, passed to scrolled if it is set.
+func fitLines(lines []line, y, rows int, scrolled func(line)) ([]line, int) {
+	for len(lines) > rows {
+		if last := len(lines) - 1; last > y && lines[last].blank() {
+			lines = lines[:last]
+			continue
+		}
+		if scrolled != nil {
+			scrolled(lines[0])
+		}
+		lines = lines[1:]
+		y--
+	}
+	for len(lines) < rows {
+		lines = append(lines, line{})
+	}
+	return lines, y
+}
+
+// AltScreen reports whether the alternate screen, used by full-screen
+// programs such as vim and less, is active.
+func (s *Screen) AltScreen() bool {
+	return s.alt
+}
+
+// Write feeds terminal output to the screen. It never fails.
+func (s *Screen) Write(p []byte) (int, error) {
+	for _, b := range p {
+		s.step(b)
+	}
+	return len(p), nil
+}
+
+func (s *Screen) step(b byte) {
+	switch s.state {
+	case stateGround:
+		switch {
+		case b >= 0x80:
+			s.pending = append(s.pending, b)
+			if utf8.FullRune(s.pending) {
+				r, _ := utf8.DecodeRune(s.pending)
+				s.pending = s.pending[:0]
+				s.put(r)
+			}
+			return
+		case len(s.pending) > 0:
+			s.pending = s.pending[:0]
+			s.put(utf8.RuneError)
+		}
+		if b < 0x20 || b == 0x7f {
+			s.control(b)
+			return
+		}
+		s.put(rune(b))
+	case stateEscape:
+		s.escape(b)
+	case stateEscapeSkip:
+		if b >= 0x30 {
+			s.state = stateGround
+		}
+	case stateCSI:
+		switch {
+		case b >= 0x40 && b <= 0x7e:
+			s.state = stateGround
+			s.csi(b)
+		case b == 0x1b:
+			s.state = stateEscape
+		case b < 0x20:
+			s.control(b)
+		case len(s.seq) >= maxSeqLen:
+			s.state = stateGround
+		default:
+			s.seq = append(s.seq, b)
+		}
+	case stateString:
+		switch b {
+		case 0x07:
+			s.state = stateGround
+		case 0x1b:
+			s.state = stateStringEsc
+		}
+	case stateStringEsc:
+		if b == '\\' {
+			s.state = stateGround
+		} else {
+			s.state = stateString
+		}
+	}
+}
+
+func (s *Screen) control(b byte) {
+	switch b {
+	case 0x1b:
+		s.state = stateEscape
+	case '\b':
+		s.wrapNext = false
+		if s.x > 0 {
+			s.x--
+		}
+	case '\t':
+		s.wrapNext = false
+		s.x = min((s.x/8+1)*8, s.cols-1)
+	case '\n', '\v', '\f':
+		s.wrapNext = false
+		s.index()
+	case '\r':
+		s.wrapNext = false
+		s.x = 0
+	}
+}
+
+func (s *Screen) escape(b byte) {
+	s.state = stateGround
+	switch b {
+	case '[':
+		s.state = stateCSI
+		s.seq = s.seq[:0]
+	case ']', 'P', 'X', '^', '_':
+		s.state = stateString
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.index()
+	case 'E':
+		s.x = 0
+		s.index()
+	case 'M':
+		s.reverseIndex()
+	case 'c':
+		s.reset()
+	default:
+		if b >= 0x20 && b <= 0x2f {
+			// Character set designation and the like.
+			s.state = stateEscapeSkip
+		}
+	}
+}
+
+func (s *Screen) csi(final byte) {
+	var private byte
+	params := s.seq
+	if len(params) > 0 && params[0] >= '<' && params[0] <= '?' {
+		private = params[0]
+		params = params[1:]
+	}
+	if i := strings.IndexFunc(string(params), func(r rune) bool { return r < '0' || r > ';' }); i >= 0 {
+		// Intermediate bytes: none of the sequences we handle use them.
+		return
+	}
+	args := parseParams(params)
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+
+	if private != 0 {
+		if private == '?' && (final == 'h' || final == 'l') {
+			for _, mode := range args {
+				s.setMode(mode, final == 'h')
+			}
+		}
+		return
+	}
+
+	s.wrapNext = false
+	switch final {
+	case 'A':
+		s.y = max(s.y-arg(0, 1), s.regionTop())
+	case 'B', 'e':
+		s.y = min(s.y+arg(0, 1), s.regionBottom())
+	case 'C', 'a':
+		s.x = min(s.x+arg(0, 1), s.cols-1)
+	case 'D':
+		s.x = max(s.x-arg(0, 1), 0)
+	case 'E':
+		s.y = min(s.y+arg(0, 1), s.regionBottom())
+		s.x = 0
+	case 'F':
+		s.y = max(s.y-arg(0, 1), s.regionTop())
+		s.x = 0
+	case 'G', '`':
+		s.x = clamp(arg(0, 1)-1, 0, s.cols-1)
+	case 'H', 'f':
+		s.y = clamp(arg(0, 1)-1, 0, s.rows-1)
+		s.x = clamp(arg(1, 1)-1, 0, s.cols-1)
+	case 'd':
+		s.y = clamp(arg(0, 1)-1, 0, s.rows-1)
+	case 'J':
+		s.eraseDisplay(arg(0, 0))
+	case 'K':
+		s.eraseLine(arg(0, 0))
+	case 'X':
+		s.clearCells(s.y, s.x, s.x+arg(0, 1))
+	case '@':
+		s.insertCells(arg(0, 1))
+	case 'P':
+		s.deleteCells(arg(0, 1))
+	case 'L':
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollDown(s.y, arg(0, 1))
+		}
+	case 'M':
+		if s.y >= s.top && s.y <= s.bottom {
+			s.scrollUp(s.y, arg(0, 1))
+		}
+	case 'S':
+		s.scrollUp(s.top, arg(0, 1))
+	case 'T':
+		s.scrollDown(s.top, arg(0, 1))
+	case 'm':
+		s.attr.apply(args)
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, s.rows)-1
+		if top < bottom && bottom < s.rows {
+			s.top, s.bottom = top, bottom
+			s.x, s.y = 0, 0
+		}
+	case 's':
+		s.saveCursor()
+	case 'u':
+		s.restoreCursor()
+	}
+}
+
+// parseParams splits CSI parameters. Sub-parameters separated by colons
+// are treated like ordinary parameters. Missing values are zero.
+func parseParams(p []byte) []int {
+	if len(p) == 0 {
+		return nil
+	}
+	fields := strings.Split(strings.ReplaceAll(string(p), ":", ";"), ";")
+	args := make([]int, len(fields))
+	for i, f := range fields {
+		args[i], _ = strconv.Atoi(f)
+	}
+	return args
+}
+
+func (s *Screen) setMode(mode int, on bool) {
+	switch mode {
+	case 7:
+		s.autowrap = on
+	case 47, 1047, 1049:
+		if on == s.alt {
+			return
+		}
+		if on {
+			if mode == 1049 {
+				s.altSaved = cursor{s.x, s.y, s.attr}
+			}
+			s.primary = s.lines
+			s.lines = make([]line, s.rows)
+			s.alt = true
+			if s.OnAltEnter != nil {
+				s.OnAltEnter()
+			}
+			return
+		}
+		if s.OnAltExit != nil {
+			s.OnAltExit()
+		}
+		s.lines = s.primary
+		s.primary = nil
+		s.alt = false
+		if mode == 1049 {
+			s.x, s.y, s.attr = min(s.altSaved.x, s.cols-1), clamp(s.altSaved.y, 0, s.rows-1), s.altSaved.attr
+		}
+		s.top, s.bottom = 0, s.rows-1
+	}
+}
+
+func (s *Screen) regionTop() int {
+	if s.y >= s.top {
+		return s.top
+	}
+	return 0
+}
+
+func (s *Screen) regionBottom() int {
+	if s.y <= s.bottom {
+		return s.bottom
+	}
+	return s.rows - 1
+}
+
+func (s *Screen) saveCursor() {
+	s.saved = cursor{s.x, s.y, s.attr}
+}
+
+func (s *Screen) restoreCursor() {
+	s.x, s.y, s.attr = min(s.saved.x, s.cols-1), min(s.saved.y, s.rows-1), s.saved.attr
+	s.wrapNext = false
+}
+
+func (s *Screen) reset() {
+	for i := range s.lines {
+		s.lines[i] = line{}
+	}
+	s.x, s.y, s.attr = 0, 0, attr{}
+	s.top, s.bottom = 0, s.rows-1
+	s.autowrap = true
+	s.wrapNext = false
+}
+
+// put writes r at the cursor and advances it, wrapping at the right margin.
+func (s *Screen) put(r rune) {
+	w := runewidth.RuneWidth(r)
+	if w == 0 {
+		// Combining marks and other zero-width runes are dropped.
+		return
+	}
+	if s.wrapNext || s.x+w > s.cols {
+		if s.autowrap {
+			s.lines[s.y].wrapped = true
+			s.x = 0
+			s.index()
+		} else {
+			s.x = s.cols - w
+		}
+	}
+	s.wrapNext = false
+	s.setCell(s.y, s.x, cell{r: r, a: s.attr})
+	if w == 2 {
+		s.setCell(s.y, s.x+1, cell{r: -1, a: s.attr})
+	}
+	s.x += w
+	if s.x >= s.cols {
+		s.x = s.cols - 1
+		s.wrapNext = true
+	}
+}
+
+func (s *Screen) setCell(y, x int, c cell) {
+	l := &s.lines[y]
+	for len(l.cells) <= x {
+		l.cells = append(l.cells, cell{})
+	}
+	l.cells[x] = c
+}
+
+// index moves the cursor down a line, scrolling the region if the cursor
+// is on its bottom line.
+func (s *Screen) index() {
+	switch {
+	case s.y == s.bottom:
+		s.scrollUp(s.top, 1)
+	case s.y < s.rows-1:
+		s.y++
+	}
+}
+
+func (s *Screen) reverseIndex() {
+	if s.y == s.top {
+		s.scrollDown(s.top, 1)
+	} else if s.y > 0 {
+		s.y--
+	}
+}
+
+// scrollUp moves the lines from top to the bottom of the scroll region up
+// by n. Lines leaving the top of the primary screen go to the scrollback.
+func (s *Screen) scrollUp(top, n int) {
+	n = min(n, s.bottom-top+1)
+	if top == 0 && !s.alt {
+		s.scrollback = append(s.scrollback, s.lines[:n]...)
+	}
+	region := s.lines[top : s.bottom+1]
+	copy(region, region[n:])
+	for i := len(region) - n; i < len(region); i++ {
+		region[i] = line{}
+	}
+}
+
+// scrollDown moves the lines from top to the bottom of the scroll region
+// down by n, inserting blank lines at top.
+func (s *Screen) scrollDown(top, n int) {
+	region := s.lines[top : s.bottom+1]
+	n = min(n, len(region))
+	copy(region[n:], region)
+	for i := 0; i < n; i++ {
+		region[i] = line{}
+	}
+}
+
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.eraseLine(0)
+		for y := s.y + 1; y < s.rows; y++ {
+			s.lines[y] = line{}
+		}
+	case 1:
+		for y := 0; y < s.y; y++ {
+			s.lines[y] = line{}
+		}
+		s.eraseLine(1)
+	case 2:
+		for y := range s.lines {
+			s.lines[y] = line{}
+		}
+	case 3:
+		s.scrollback = nil
+	}
+}
+
+func (s *Screen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		s.clearCells(s.y, s.x, s.cols)
+		s.lines[s.y].wrapped = false
+	case 1:
+		s.clearCells(s.y, 0, s.x+1)
+	case 2:
+		s.lines[s.y] = line{}
+	}
+}
+
+// clearCells blanks the cells [from, to) of line y.
+func (s *Screen) clearCells(y, from, to int) {
+	l := &s.lines[y]
+	to = min(to, len(l.cells))
+	for x := from; x < to; x++ {
+		l.cells[x] = cell{a: attr{bg: s.attr.bg}}
+	}
+	if to == len(l.cells) && s.attr.bg == 0 {
+		l.cells = l.cells[:min(from, len(l.cells))]
+	}
+}
+
+func (s *Screen) insertCells(n int) {
+	l := &s.lines[s.y]
+	if s.x >= len(l.cells) {
+		return
+	}
+	n = min(n, s.cols-s.x)
+	blank := make([]cell, n)
+	l.cells = append(l.cells[:s.x], append(blank, l.cells[s.x:]...)...)
+	if len(l.cells) > s.cols {
+		l.cells = l.cells[:s.cols]
+	}
+}
+
+func (s *Screen) deleteCells(n int) {
+	l := &s.lines[s.y]
+	if s.x >= len(l.cells) {
+		return
+	}
+	n = min(n, len(l.cells)-s.x)
+	l.cells = append(l.cells[:s.x], l.cells[s.x+n:]...)
+}
+
+// Text returns the scrollback and the primary screen as plain text, with
+// soft-wrapped lines joined and trailing blank lines removed.
+func (s *Screen) Text() string {
+	return s.render(s.content(), false)
+}
+
+// StyledText is like Text but keeps colours and text attributes as SGR
+// escape sequences, for exports that can display them.
+func (s *Screen) StyledText() string {
+	return s.render(s.content(), true)
+}
+
+// Snapshot returns the visible screen, which is the alternate screen while
+// a full-screen program is running.
+func (s *Screen) Snapshot() string {
+	return s.render(s.lines, false)
+}
+
+// CursorLine returns the text of the line the cursor is on, joined with
+// the lines it soft-wrapped from, such as a prompt and the command line
+// typed at it. It is empty while the alternate screen is shown.
+func (s *Screen) CursorLine() string {
+	if s.alt {
+		return ""
+	}
+	lines := s.content()
+	end := len(s.scrollback) + s.y
+	start := end
+	for start > 0 && lines[start-1].wrapped {
+		start--
+	}
+	return s.render(lines[start:end+1], false)
+}
+
+// Line is a line of text taken from the screen.
+type Line struct {
+	Text    string
+	Styled  string // Text with colours and attributes as SGR sequences, if asked for
+	Partial bool   // the line goes on in the next one
+}
+
+// ScrollbackLen returns the number of lines in the scrollback.
+func (s *Screen) ScrollbackLen() int {
+	return len(s.scrollback)
+}
+
+// TakeScrollback removes up to n of the oldest lines from the scrollback
+// and returns them as text, so a long output need not be held whole.
+// Soft-wrapped lines are joined, and a line wrapping onto the lines left
+// behind is not taken, unless none of the n ends, as with minified JSON:
+// they are then returned as a Partial line.
+func (s *Screen) TakeScrollback(n int, styled bool) []Line {
+	n = min(n, len(s.scrollback))
+	end := n
+	for end > 0 && s.scrollback[end-1].wrapped {
+		end--
+	}
+	if end == 0 {
+		end = n
+	}
+	var lines []Line
+	start := 0
+	for i := 0; i < end; i++ {
+		if s.scrollback[i].wrapped && i < end-1 {
+			continue
+		}
+		group := s.scrollback[start : i+1]
+		l := Line{Text: s.render(group, false), Partial: s.scrollback[i].wrapped}
+		if styled {
+			l.Styled = s.render(group, true)
+		}
+		lines = append(lines, l)
+		start = i + 1
+	}
+	// Copied, so the lines taken can be freed.
+	s.scrollback = append([]line(nil), s.scrollback[end:]...)
+	return lines
+}
+
+func (s *Screen) content() []line {
+	lines := s.lines
+	if s.alt {
+		lines = s.primary
+	}
+	return append(s.scrollback[:len(s.scrollback):len(s.scrollback)], lines...)
+}
+
+func (s *Screen) render(lines []line, styled bool) string {
+	for len(lines) > 0 && lines[len(lines)-1].blank() {
+		lines = lines[:len(lines)-1]
+	}
+	var sb strings.Builder
+	for i, l := range lines {
+		l.write(&sb, styled)
+		if !l.wrapped && i < len(lines)-1 {
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+func (l line) blank() bool {
+	for _, c := range l.cells {
+		if c.r > 0 && c.r != ' ' {
+			return false
+		}
+	}
+	return true
+}
+
+func (l line) write(sb *strings.Builder, styled bool) {
+	cells := l.cells
+	for len(cells) > 0 && (cells[len(cells)-1].r == 0 ||
+		!l.wrapped && cells[len(cells)-1].r == ' ' && cells[len(cells)-1].a == attr{}) {
+		cells = cells[:len(cells)-1]
+	}
+	if !styled {
+		var text strings.Builder
+		for _, c := range cells {
+			if c.r >= 0 {
+				text.WriteRune(max(c.r, ' '))
+			}
+		}
+		if l.wrapped {
+			sb.WriteString(text.String())
+		} else {
+			sb.WriteString(strings.TrimRight(text.String(), " "))
+		}
+		return
+	}
+	var current attr
+	for _, c := range cells {
+		if c.r < 0 {
+			continue
+		}
+		if c.a != current {
+			sb.WriteString(c.a.sgr())
+			current = c.a
+		}
+		sb.WriteRune(max(c.r, ' '))
+	}
+	if current != (attr{}) {
+		sb.WriteString(attr{}.sgr())
+	}
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
@@ -0,0 +1,176 @@
+package vt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func render(cols, rows int, input string) *Screen {
+	s := New(cols, rows)
+	_, _ = s.Write([]byte(input))
+	return s
+}
+
+func TestScreen_PlainText(t *testing.T) {
+	s := render(80, 24, "file1\r\nfile2\r\n")
+	assert.Equal(t, "file1\nfile2", s.Text())
+}
+
+func TestScreen_ProgressBarCollapses(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i <= 100; i += 10 {
+		fmt.Fprintf(&sb, "\rDownloading [%-10s] %3d%%", strings.Repeat("#", i/10), i)
+	}
+	sb.WriteString("\r\ndone\r\n")
+	s := render(80, 24, sb.String())
+	assert.Equal(t, "Downloading [##########] 100%\ndone", s.Text())
+}
+
+func TestScreen_EraseLineAndCursorUp(t *testing.T) {
+	// Multi-line progress as printed by docker pull: move up and redraw.
+	input := "layer1: waiting\r\nlayer2: waiting\r\n" +
+		"\x1b[2A\x1b[2Klayer1: done\r\n\x1b[2Klayer2: done\r\n"
+	s := render(80, 24, input)
+	assert.Equal(t, "layer1: done\nlayer2: done", s.Text())
+}
+
+func TestScreen_ColorsStrippedFromText(t *testing.T) {
+	s := render(80, 24, "\x1b[1;31merror\x1b[0m: \x1b[38;5;208mwarn\x1b[m\r\n")
+	assert.Equal(t, "error: warn", s.Text())
+	assert.Equal(t, "\x1b[0;1;31merror\x1b[0m: \x1b[0;38;5;208mwarn\x1b[0m", s.StyledText())
+}
+
+func TestScreen_TrueColor(t *testing.T) {
+	s := render(80, 24, "\x1b[38;2;1;2;3;48;5;4mx")
+	assert.Equal(t, "\x1b[0;38;2;1;2;3;44mx\x1b[0m", s.StyledText())
+}
+
+func TestScreen_ScrollbackKeepsEverything(t *testing.T) {
+	var sb strings.Builder
+	var want []string
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&sb, "line %d\r\n", i)
+		want = append(want, fmt.Sprintf("line %d", i))
+	}
+	s := render(80, 5, sb.String())
+	assert.Equal(t, strings.Join(want, "\n"), s.Text())
+}
+
+func TestScreen_SoftWrapIsJoined(t *testing.T) {
+	s := render(10, 5, "abcdefghijklmnopqrstuvwxy\r\nz\r\n")
+	assert.Equal(t, "abcdefghijklmnopqrstuvwxy\nz", s.Text())
+}
+
+func TestScreen_ExactWidthLineDoesNotWrap(t *testing.T) {
+	s := render(5, 5, "abcde\r\nf")
+	assert.Equal(t, "abcde\nf", s.Text())
+}
+
+func TestScreen_WideRunes(t *testing.T) {
+	s := render(80, 5, "日本語\x1b[2D!\r\n")
+	assert.Equal(t, "日本!", s.Text())
+}
+
+func TestScreen_UTF8SplitAcrossWrites(t *testing.T) {
+	s := New(80, 5)
+	b := []byte("héllo")
+	_, _ = s.Write(b[:2])
+	_, _ = s.Write(b[2:])
+	assert.Equal(t, "héllo", s.Text())
+}
+
+func TestScreen_OSCIgnored(t *testing.T) {
+	s := render(80, 5, "\x1b]0;title\x07a\x1b]8;;http://x\x1b\\b\x1b]8;;\x1b\\")
+	assert.Equal(t, "ab", s.Text())
+}
+
+func TestScreen_BackspaceOverwrite(t *testing.T) {
+	s := render(80, 5, "abc\b\bX\r\n")
+	assert.Equal(t, "aXc", s.Text())
+}
+
+func TestScreen_InsertDeleteChars(t *testing.T) {
+	s := render(80, 5, "abcdef\r\x1b[2C\x1b[2P\r\n12345\r\x1b[C\x1b[2@")
+	assert.Equal(t, "abef\n1  2345", s.Text())
+}
+
+func TestScreen_AlternateScreenIsNotText(t *testing.T) {
+	var entered, exited int
+	s := New(80, 5)
+	s.OnAltEnter = func() { entered++ }
+	s.OnAltExit = func() {
+		exited++
+		assert.Equal(t, "~ vim buffer", s.Snapshot())
+	}
+	_, _ = s.Write([]byte("before\r\n\x1b[?1049h\x1b[H\x1b[2J~ vim buffer"))
+	assert.True(t, s.AltScreen())
+	assert.Equal(t, "before", s.Text())
+	_, _ = s.Write([]byte("\x1b[?1049lafter\r\n"))
+	assert.False(t, s.AltScreen())
+	assert.Equal(t, "before\nafter", s.Text())
+	assert.Equal(t, 1, entered)
+	assert.Equal(t, 1, exited)
+}
+
+func TestScreen_ScrollRegion(t *testing.T) {
+	// Status line pinned at the bottom while the region above scrolls.
+	s := render(80, 4, "\x1b[4;1Hstatus\x1b[1;3r\x1b[1;1Ha\r\nb\r\nc\r\nd")
+	assert.Equal(t, "b\nc\nd\nstatus", s.Snapshot())
+}
+
+func TestScreen_Resize(t *testing.T) {
+	s := render(80, 5, "1\r\n2\r\n3\r\n4\r\n5")
+	s.Resize(40, 2)
+	cols, rows := s.Size()
+	assert.Equal(t, 40, cols)
+	assert.Equal(t, 2, rows)
+	assert.Equal(t, "4\n5", s.Snapshot())
+	assert.Equal(t, "1\n2\n3\n4\n5", s.Text())
+}
+
+func TestScreen_ResizeOnAlternateScreen(t *testing.T) {
+	var lines []string
+	for i := 1; i <= 39; i++ {
+		lines = append(lines, fmt.Sprint(i))
+	}
+	s := render(80, 40, strings.Join(lines, "\r\n")+"\r\n\x1b[?1049h~ less")
+	s.Resize(80, 20)
+	_, _ = s.Write([]byte("\x1b[?1049l"))
+	_, _ = s.Write([]byte("done\r\n"))
+
+	assert.Equal(t, strings.Join(lines, "\n")+"\ndone", s.Text(), "the cursor is back below the output")
+	cols, rows := s.Size()
+	assert.Equal(t, 80, cols)
+	assert.Equal(t, 20, rows)
+}
+
+func TestScreen_TakeScrollback(t *testing.T) {
+	s := render(10, 2, "a\r\nbbbbbbbbbbbbbbb\r\n\x1b[1mc\x1b[0m\r\nd\r\ne\r\nf")
+	assert.Equal(t, 5, s.ScrollbackLen())
+	assert.Equal(t, []Line{{Text: "a"}}, s.TakeScrollback(2, false), "a line wrapping onto the lines left is not taken")
+	assert.Equal(t, []Line{
+		{Text: "bbbbbbbbbbbbbbb", Styled: "bbbbbbbbbbbbbbb"},
+		{Text: "c", Styled: "\x1b[0;1mc\x1b[0m"},
+	}, s.TakeScrollback(3, true))
+	assert.Equal(t, 1, s.ScrollbackLen())
+	assert.Equal(t, "d\ne\nf", s.Text())
+
+	s = render(10, 2, strings.Repeat("x", 35))
+	assert.Equal(t, []Line{{Text: strings.Repeat("x", 20), Partial: true}}, s.TakeScrollback(2, false), "unless no line ends")
+	assert.Equal(t, strings.Repeat("x", 15), s.Text())
+}
+
+func TestScreen_CursorLine(t *testing.T) {
+	s := render(10, 3, "motd\r\nbob@db:~$ echo hello")
+	assert.Equal(t, "bob@db:~$ echo hello", s.CursorLine(), "soft-wrapped lines are joined")
+	_, _ = s.Write([]byte("\r"))
+	assert.Equal(t, "bob@db:~$ echo hello", s.CursorLine())
+	_, _ = s.Write([]byte("\n"))
+	assert.Equal(t, "", s.CursorLine())
+
+	_, _ = s.Write([]byte("\x1b[?1049h$ vim"))
+	assert.Equal(t, "", s.CursorLine())
+}